@@ -0,0 +1,444 @@
+// Package arm generates assembly for 32-bit ARM Linux from IR.
+//
+// Functions follow the ARM procedure call standard (AAPCS). Every value
+// takes a word. The first four words of arguments are passed in r0-r3,
+// and the rest on the stack, the fifth at the lowest address. A single
+// result is returned in r0. Multiple results are returned like a struct
+// that doesn't fit in a register: the caller passes the address of
+// space for them as a hidden first argument, and the callee stores them
+// there. r4-r11 and sp are preserved across calls.
+//
+// Each function has a frame with a word for each of its variables,
+// below the frame pointer r7. Instructions load their operands into
+// r6 and r5, and r4 holds addresses, and the offsets of the slots that
+// are too far from r7 for an ldr or str to reach.
+package arm
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/samertm/chompy/ir"
+)
+
+// nlabels numbers the assembly labels, which have to be unique across
+// every package of the program.
+var nlabels = 2
+
+func nextLabel() string {
+	l := fmt.Sprintf(".L%d", nlabels)
+	nlabels++
+	return l
+}
+
+func bprintf(format string, a ...interface{}) []byte {
+	return []byte(fmt.Sprintf(format, a...))
+}
+
+// gen generates the assembly for a package.
+type gen struct {
+	// strs are the string constants that the code refers to, in the
+	// order that they were labeled, and strLabels maps them to their
+	// labels. They're emitted after the code.
+	strs      []string
+	strLabels map[string]string
+}
+
+// Gen generates the assembly for p. Package main also gets the entry
+// point of the program and the runtime.
+func Gen(p *ir.Package) []byte {
+	g := &gen{strLabels: make(map[string]string)}
+	var code []byte
+	if p.Main {
+		code = emitStart()
+		code = append(code, g.emitRuntime()...)
+	}
+	for _, f := range p.Funcs {
+		code = append(code, g.emitFunc(f)...)
+	}
+	code = append(code, emitGlobals(p.Globals)...)
+	return append(code, g.emitStrings()...)
+}
+
+func emitStart() []byte {
+	code := emitFuncHeader("_start")
+	code = append(code, bprintf("\tbl\t%s\n"+
+		"\tbl\tmain\n"+
+		"\tmov\tr0, #0\n"+
+		"\tmov\tr7, #1\n"+
+		"\tswi\t#0\n", ir.InitName("main"))...)
+	return code
+}
+
+func emitFuncHeader(name string) []byte {
+	return []byte("\t.align\t2\n" +
+		"\t.global\t" + name + "\n" +
+		name + ":\n")
+}
+
+// emitGlobals emits the storage of the package level variables.
+// Variables that start out as zero go in the bss section.
+func emitGlobals(globals []*ir.Global) []byte {
+	var data, bss []byte
+	for _, g := range globals {
+		if g.Init != 0 {
+			data = append(data, bprintf("\t.align\t2\n%s:\n\t.word\t%d\n", g.Name, int32(g.Init))...)
+			continue
+		}
+		bss = append(bss, bprintf("\t.align\t2\n%s:\n\t.space\t%d\n", g.Name, g.Size)...)
+	}
+	var code []byte
+	if len(data) != 0 {
+		code = append(code, "\t.data\n"...)
+		code = append(code, data...)
+	}
+	if len(bss) != 0 {
+		code = append(code, "\t.bss\n"...)
+		code = append(code, bss...)
+	}
+	if code == nil {
+		return nil
+	}
+	return append(code, "\t.text\n"...)
+}
+
+// frame is the frame of the function being generated.
+type frame struct {
+	f *ir.Func
+	// slots maps the function's variables to their offsets from r7.
+	slots map[*ir.Var]int
+	// results is the offset of the address of the caller's space for
+	// multiple results.
+	results int
+	labels  map[*ir.Label]string
+}
+
+// emitFunc emits f. The arguments in registers are stored in the
+// frame, and the ones on the stack are left where they are, above the
+// saved registers.
+func (g *gen) emitFunc(f *ir.Func) []byte {
+	fr := &frame{f: f, slots: make(map[*ir.Var]int), labels: make(map[*ir.Label]string)}
+	words := len(f.Params)
+	hidden := 0
+	if f.Results > 1 {
+		hidden = 1
+		words++
+	}
+	var size int
+	var params []byte
+	for i := 0; i < words; i++ {
+		var off int
+		if i < 4 {
+			size += 4
+			off = -size
+			params = append(params, bprintf("\tstr\tr%d, [r7, #%d]\n", i, off)...)
+		} else {
+			// above r7 and the registers saved before it
+			off = 20 + 4*(i-4)
+		}
+		if i < hidden {
+			fr.results = off
+		} else {
+			fr.slots[f.Params[i-hidden]] = off
+		}
+	}
+	for _, v := range f.Locals {
+		size += 4
+		fr.slots[v] = -size
+	}
+	code := emitFuncHeader(f.Name)
+	code = append(code, "\tpush\t{r4, r5, r6, lr}\n"+
+		"\tpush\t{r7}\n"+
+		"\tmov\tr7, sp\n"...)
+	if immediate(size) {
+		code = append(code, bprintf("\tsub\tsp, sp, #%d\n", size)...)
+	} else {
+		code = append(code, bprintf("\tldr\tr4, =%d\n"+
+			"\tsub\tsp, sp, r4\n", size)...)
+	}
+	code = append(code, params...)
+	for _, in := range f.Code {
+		code = append(code, g.emitInstr(fr, in)...)
+	}
+	// the constants loaded with ldr =, within reach of the code
+	return append(code, "\t.ltorg\n"...)
+}
+
+// immediate reports whether n can be the immediate operand of a data
+// processing instruction: an 8 bit value rotated right by an even
+// number of bits.
+func immediate(n int) bool {
+	u := uint32(n)
+	for r := uint(0); r < 32; r += 2 {
+		if (u<<r|u>>(32-r))&^0xff == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// label returns the assembly label of l.
+func (fr *frame) label(l *ir.Label) string {
+	s, ok := fr.labels[l]
+	if !ok {
+		s = nextLabel()
+		fr.labels[l] = s
+	}
+	return s
+}
+
+// slot returns the offset of v from r7.
+func (fr *frame) slot(v *ir.Var) int {
+	off, ok := fr.slots[v]
+	if !ok {
+		log.Fatalf("%s isn't a variable of %s", v, fr.f.Name)
+	}
+	return off
+}
+
+// addr returns the address of v's slot as an operand of ldr and str.
+// Offsets that don't fit in the instruction are loaded into scratch
+// first, by the code that addr also returns.
+func (fr *frame) addr(v *ir.Var, scratch string) ([]byte, string) {
+	off := fr.slot(v)
+	if off >= -4095 && off <= 4095 {
+		return nil, fmt.Sprintf("[r7, #%d]", off)
+	}
+	return bprintf("\tldr\t%s, =%d\n", scratch, off), fmt.Sprintf("[r7, %s]", scratch)
+}
+
+// emitLoad loads the value v into reg.
+func (g *gen) emitLoad(fr *frame, reg string, v ir.Value) []byte {
+	switch v := v.(type) {
+	case *ir.Var:
+		code, addr := fr.addr(v, reg)
+		return append(code, bprintf("\tldr\t%s, %s\n", reg, addr)...)
+	case ir.Const:
+		if v.Val >= 0 && v.Val < 256 {
+			return bprintf("\tmov\t%s, #%d\n", reg, v.Val)
+		}
+		return bprintf("\tldr\t%s, =%d\n", reg, int32(v.Val))
+	case *ir.Global:
+		return bprintf("\tldr\t%s, =%s\n", reg, v.Name)
+	case ir.Str:
+		return bprintf("\tldr\t%s, =%s\n", reg, g.stringLabel(v.S))
+	}
+	log.Fatalf("I don't handle %T values yet", v)
+	return nil
+}
+
+// emitStore stores reg in the variable v. It uses r4 for the slot's
+// offset if it has to, so reg can't be r4.
+func emitStore(fr *frame, reg string, v *ir.Var) []byte {
+	code, addr := fr.addr(v, "r4")
+	return append(code, bprintf("\tstr\t%s, %s\n", reg, addr)...)
+}
+
+func (g *gen) emitInstr(fr *frame, in ir.Instr) []byte {
+	switch in := in.(type) {
+	case *ir.Label:
+		return bprintf("%s:\n", fr.label(in))
+	case *ir.Assign:
+		code := g.emitLoad(fr, "r6", in.X)
+		if in.Y != nil {
+			code = append(code, g.emitLoad(fr, "r5", in.Y)...)
+		}
+		code = append(code, emitOp(in)...)
+		return append(code, emitStore(fr, "r6", in.Dst)...)
+	case *ir.Load:
+		code := g.emitLoad(fr, "r4", in.Addr)
+		code = append(code, bprintf("\tldr\tr6, [r4, #%d]\n", in.Off)...)
+		return append(code, emitStore(fr, "r6", in.Dst)...)
+	case *ir.Store:
+		code := g.emitLoad(fr, "r4", in.Addr)
+		code = append(code, g.emitLoad(fr, "r6", in.Val)...)
+		return append(code, bprintf("\tstr\tr6, [r4, #%d]\n", in.Off)...)
+	case *ir.Goto:
+		return bprintf("\tb\t%s\n", fr.label(in.Label))
+	case *ir.IfZ:
+		code := g.emitLoad(fr, "r6", in.Cond)
+		return append(code, bprintf("\tcmp\tr6, #0\n"+
+			"\tbeq\t%s\n", fr.label(in.Label))...)
+	case *ir.Call:
+		return g.emitCall(fr, in)
+	case *ir.Return:
+		return g.emitReturn(fr, in)
+	}
+	log.Fatalf("I don't handle %T yet", in)
+	return nil
+}
+
+// emitCall calls c.Func. The arguments are stored on the stack, and the
+// first four words of them popped into registers.
+func (g *gen) emitCall(fr *frame, c *ir.Call) []byte {
+	var code []byte
+	hidden := 0
+	if len(c.Dsts) > 1 {
+		hidden = 1
+		code = bprintf("\tsub\tsp, sp, #%d\n", 4*len(c.Dsts))
+	}
+	words := len(c.Args) + hidden
+	if words > 0 {
+		code = append(code, bprintf("\tsub\tsp, sp, #%d\n", 4*words)...)
+	}
+	if hidden == 1 {
+		code = append(code, bprintf("\tadd\tr6, sp, #%d\n"+
+			"\tstr\tr6, [sp]\n", 4*words)...)
+	}
+	for i, a := range c.Args {
+		code = append(code, g.emitLoad(fr, "r6", a)...)
+		code = append(code, bprintf("\tstr\tr6, [sp, #%d]\n", 4*(i+hidden))...)
+	}
+	if words > 0 {
+		code = append(code, "\tpop\t{r0"...)
+		for i := 1; i < words && i < 4; i++ {
+			code = append(code, bprintf(", r%d", i)...)
+		}
+		code = append(code, "}\n"...)
+	}
+	code = append(code, bprintf("\tbl\t%s\n", c.Func)...)
+	if words > 4 {
+		code = append(code, bprintf("\tadd\tsp, sp, #%d\n", 4*(words-4))...)
+	}
+	switch {
+	case len(c.Dsts) == 1:
+		if c.Dsts[0] != nil {
+			code = append(code, emitStore(fr, "r0", c.Dsts[0])...)
+		}
+	case len(c.Dsts) > 1:
+		for _, d := range c.Dsts {
+			code = append(code, "\tpop\t{r6}\n"...)
+			if d != nil {
+				code = append(code, emitStore(fr, "r6", d)...)
+			}
+		}
+	}
+	return code
+}
+
+// emitReturn returns r.Vals from the function.
+func (g *gen) emitReturn(fr *frame, r *ir.Return) []byte {
+	var code []byte
+	switch len(r.Vals) {
+	case 0:
+	case 1:
+		code = g.emitLoad(fr, "r0", r.Vals[0])
+	default:
+		for i, v := range r.Vals {
+			code = append(code, g.emitLoad(fr, "r6", v)...)
+			code = append(code, bprintf("\tldr\tr5, [r7, #%d]\n"+
+				"\tstr\tr6, [r5, #%d]\n", fr.results, 4*i)...)
+		}
+	}
+	return append(code, "\tmov\tsp, r7\n"+
+		"\tpop\t{r7}\n"+
+		"\tpop\t{r4, r5, r6, pc}\n"...)
+}
+
+// condCodes are the condition codes that the comparisons hold under,
+// for signed and unsigned operands.
+var condCodes = map[string][2]string{
+	"==": {"eq", "eq"},
+	"!=": {"ne", "ne"},
+	"<":  {"lt", "lo"},
+	"<=": {"le", "ls"},
+	">":  {"gt", "hi"},
+	">=": {"ge", "hs"},
+}
+
+// emitOp emits r6 = r6 op r5, or r6 = op r6 for unary ops, for the
+// operation of a.
+func emitOp(a *ir.Assign) []byte {
+	switch {
+	case a.Op == "":
+		return nil
+	case a.Op == ir.Conv:
+		// integers are kept in registers sign or zero extended from
+		// their size, so only narrowing conversions need code
+		return emitWrap(a.Type)
+	case ir.Comparison(a.Op):
+		cc := condCodes[a.Op][0]
+		if !a.Type.Signed() {
+			cc = condCodes[a.Op][1]
+		}
+		return bprintf("\tcmp\tr6, r5\n"+
+			"\tmov\tr6, #0\n"+
+			"\tmov%s\tr6, #1\n", cc)
+	case a.Y == nil:
+		switch a.Op {
+		case "-":
+			return append([]byte("\trsb\tr6, r6, #0\n"), emitWrap(a.Type)...)
+		case "^":
+			return append([]byte("\tmvn\tr6, r6\n"), emitWrap(a.Type)...)
+		case "!":
+			return []byte("\teor\tr6, r6, #1\n")
+		}
+	}
+	return emitArith(a.Op, a.Type)
+}
+
+// emitArith emits r6 = r6 op r5 for operands of the type typ, wrapping
+// the result around to fit it. Shifts by 32 or more shift every bit
+// out, and division panics if r5 is 0.
+func emitArith(op string, typ ir.Type) []byte {
+	switch op {
+	case "+":
+		return append([]byte("\tadd\tr6, r6, r5\n"), emitWrap(typ)...)
+	case "-":
+		return append([]byte("\tsub\tr6, r6, r5\n"), emitWrap(typ)...)
+	case "*":
+		return append([]byte("\tmul\tr6, r5, r6\n"), emitWrap(typ)...)
+	case "/", "%":
+		div := "runtime.divmod"
+		if !typ.Signed() {
+			div = "runtime.udivmod"
+		}
+		res := "r0"
+		if op == "%" {
+			res = "r1"
+		}
+		return append(bprintf("\tcmp\tr5, #0\n"+
+			"\tbleq\truntime.panicdivide\n"+
+			"\tmov\tr0, r6\n"+
+			"\tmov\tr1, r5\n"+
+			"\tbl\t%s\n"+
+			"\tmov\tr6, %s\n", div, res), emitWrap(typ)...)
+	case "&":
+		return []byte("\tand\tr6, r6, r5\n")
+	case "|":
+		return []byte("\torr\tr6, r6, r5\n")
+	case "^":
+		return []byte("\teor\tr6, r6, r5\n")
+	case "&^":
+		return []byte("\tbic\tr6, r6, r5\n")
+	case "<<":
+		return append([]byte("\tcmp\tr5, #32\n"+
+			"\tmovhs\tr5, #32\n"+
+			"\tmov\tr6, r6, lsl r5\n"), emitWrap(typ)...)
+	case ">>":
+		shift := "asr"
+		if !typ.Signed() {
+			shift = "lsr"
+		}
+		return bprintf("\tcmp\tr5, #32\n"+
+			"\tmovhs\tr5, #32\n"+
+			"\tmov\tr6, r6, %s r5\n", shift)
+	}
+	log.Fatalf("I don't handle %s yet", op)
+	return nil
+}
+
+// emitWrap truncates r6 to the type t, extending it back to 32 bits.
+// Booleans are always 0 or 1.
+func emitWrap(t ir.Type) []byte {
+	bits := 32 - t.Bits()
+	if t == ir.Bool || bits == 0 {
+		return nil
+	}
+	shift := "asr"
+	if !t.Signed() {
+		shift = "lsr"
+	}
+	return bprintf("\tmov\tr6, r6, lsl #%d\n"+
+		"\tmov\tr6, r6, %s #%d\n", bits, shift, bits)
+}
@@ -0,0 +1,57 @@
+package arm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/samertm/chompy/ir"
+)
+
+func TestImmediate(t *testing.T) {
+	for n, want := range map[int]bool{
+		0:          true,
+		255:        true,
+		256:        true,
+		1020:       true,
+		4096:       true,
+		0xff000000: true,
+		0xf000000f: true,
+		257:        false,
+		4100:       false,
+		7204:       false,
+		0x1fe:      false,
+		0x102:      false,
+	} {
+		if got := immediate(n); got != want {
+			t.Errorf("immediate(%#x) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+// TestLargeFrame checks that a frame too big for the immediate of sub,
+// with slots too far from r7 for the offset of ldr and str, gets its
+// sizes and offsets through registers.
+func TestLargeFrame(t *testing.T) {
+	f := &ir.Func{Name: "big"}
+	for i := 0; i < 1801; i++ {
+		f.NewVar(fmt.Sprintf("v%d", i))
+	}
+	near, far := f.Locals[0], f.Locals[len(f.Locals)-1]
+	f.Code = []ir.Instr{
+		&ir.Assign{Dst: far, X: near},
+		&ir.Assign{Dst: near, X: far},
+		&ir.Return{},
+	}
+	asm := string(Gen(&ir.Package{Path: "main", Funcs: []*ir.Func{f}}))
+	for _, want := range []string{
+		"\tldr\tr4, =7204\n\tsub\tsp, sp, r4\n",
+		"\tldr\tr6, [r7, #-4]\n\tldr\tr4, =-7204\n\tstr\tr6, [r7, r4]\n",
+		"\tldr\tr6, =-7204\n\tldr\tr6, [r7, r6]\n\tstr\tr6, [r7, #-4]\n",
+		"\t.ltorg\n",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("no\n%s\nin\n%s", want, asm)
+		}
+	}
+}
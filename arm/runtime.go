@@ -0,0 +1,233 @@
+package arm
+
+// emitRuntime emits the routines that the IR calls, and the ones that
+// the generated code calls itself. They follow the calling convention:
+// arguments in r0-r3, and r4-r11 are preserved.
+func (g *gen) emitRuntime() []byte {
+	// runtime.write writes r2 bytes at r1 to the file descriptor r0.
+	code := emitFuncHeader("runtime.write")
+	code = append(code, "\tpush\t{r7}\n"+
+		"\tmov\tr7, #4\n"+
+		"\tswi\t#0\n"+
+		"\tpop\t{r7}\n"+
+		"\tbx\tlr\n"...)
+	// runtime.printuint writes the unsigned integer r1 in decimal to
+	// the file descriptor r0, with the digits of runtime.printint.
+	code = append(code, emitFuncHeader("runtime.printuint")...)
+	code = append(code, "\tpush\t{r4, r5, r6, lr}\n"+
+		"\tsub\tsp, sp, #12\n"+
+		"\tadd\tr5, sp, #12\n"+
+		"\tmov\tr6, r1\n"+
+		"\tmov\tr1, #0\n"+
+		"\tb\truntime.printint.digits\n"...)
+	// runtime.printint writes the signed integer r1 in decimal to the
+	// file descriptor r0. The digits are divided out by multiplying
+	// by 2^35/10, since there's no divide instruction.
+	code = append(code, emitFuncHeader("runtime.printint")...)
+	code = append(code, "\tpush\t{r4, r5, r6, lr}\n"+
+		"\tsub\tsp, sp, #12\n"+
+		"\tadd\tr5, sp, #12\n"+
+		"\tmovs\tr6, r1\n"+
+		"\trsbmi\tr6, r6, #0\n"+
+		"runtime.printint.digits:\n"+
+		"\tldr\tr4, =0xcccccccd\n"+
+		"runtime.printint.digit:\n"+
+		"\tumull\tr2, r3, r6, r4\n"+
+		"\tmov\tr3, r3, lsr #3\n"+
+		"\tadd\tr2, r3, r3, lsl #2\n"+
+		"\tsub\tr2, r6, r2, lsl #1\n"+
+		"\tadd\tr2, r2, #48\n"+
+		"\tsub\tr5, r5, #1\n"+
+		"\tstrb\tr2, [r5]\n"+
+		"\tmovs\tr6, r3\n"+
+		"\tbne\truntime.printint.digit\n"+
+		"\tcmp\tr1, #0\n"+
+		"\tbge\truntime.printint.write\n"+
+		"\tmov\tr2, #45\n"+
+		"\tsub\tr5, r5, #1\n"+
+		"\tstrb\tr2, [r5]\n"+
+		"runtime.printint.write:\n"+
+		"\tmov\tr1, r5\n"+
+		"\tadd\tr2, sp, #12\n"+
+		"\tsub\tr2, r2, r5\n"+
+		"\tbl\truntime.write\n"+
+		"\tadd\tsp, sp, #12\n"+
+		"\tpop\t{r4, r5, r6, pc}\n"...)
+	// runtime.udivmod divides r0 by r1, unsigned, leaving the quotient
+	// in r0 and the remainder in r1. ARMv6 has no divide instruction,
+	// so it's long division: the divisor is shifted up to the top of
+	// the dividend, then subtracted out one bit at a time.
+	code = append(code, emitFuncHeader("runtime.udivmod")...)
+	code = append(code, "\tmov\tr2, #0\n"+
+		"\tmov\tr3, #1\n"+
+		"runtime.udivmod.align:\n"+
+		"\tcmp\tr1, #0x80000000\n"+
+		"\tcmplo\tr1, r0\n"+
+		"\tmovlo\tr1, r1, lsl #1\n"+
+		"\tmovlo\tr3, r3, lsl #1\n"+
+		"\tblo\truntime.udivmod.align\n"+
+		"runtime.udivmod.bit:\n"+
+		"\tcmp\tr0, r1\n"+
+		"\tsubhs\tr0, r0, r1\n"+
+		"\torrhs\tr2, r2, r3\n"+
+		"\tmovs\tr3, r3, lsr #1\n"+
+		"\tmovne\tr1, r1, lsr #1\n"+
+		"\tbne\truntime.udivmod.bit\n"+
+		"\tmov\tr1, r0\n"+
+		"\tmov\tr0, r2\n"+
+		"\tbx\tlr\n"...)
+	// runtime.divmod is the signed runtime.udivmod. Like Go, it
+	// truncates towards zero, so the remainder has the sign of the
+	// dividend.
+	code = append(code, emitFuncHeader("runtime.divmod")...)
+	code = append(code, "\tpush\t{r4, r5, lr}\n"+
+		"\tmov\tr4, r0\n"+
+		"\teor\tr5, r0, r1\n"+
+		"\tcmp\tr0, #0\n"+
+		"\trsblt\tr0, r0, #0\n"+
+		"\tcmp\tr1, #0\n"+
+		"\trsblt\tr1, r1, #0\n"+
+		"\tbl\truntime.udivmod\n"+
+		"\tcmp\tr5, #0\n"+
+		"\trsblt\tr0, r0, #0\n"+
+		"\tcmp\tr4, #0\n"+
+		"\trsblt\tr1, r1, #0\n"+
+		"\tpop\t{r4, r5, pc}\n"...)
+	// runtime.decoderune decodes the UTF-8 encoded rune at r1, which
+	// has r2 bytes left, and returns the rune and its width. Like Go,
+	// it decodes anything that isn't valid UTF-8 as one byte of
+	// U+FFFD: overlong encodings and surrogates included.
+	code = append(code, emitFuncHeader("runtime.decoderune")...)
+	code = append(code, "\tpush\t{r4, lr}\n"+
+		"\tmov\tr4, r0\n"+
+		"\tmov\tr0, r1\n"+
+		"\tmov\tr1, r2\n"+
+		"\tbl\truntime.decoderune.regs\n"+
+		"\tstr\tr0, [r4]\n"+
+		"\tstr\tr1, [r4, #4]\n"+
+		"\tpop\t{r4, pc}\n"+
+		// the decoding itself takes the rune's address in r0 and the
+		// bytes left in r1, and leaves the rune in r0 and its width
+		// in r1
+		"runtime.decoderune.regs:\n"+
+		"\tpush\t{r4, r5, lr}\n"+
+		"\tldrb\tr2, [r0]\n"+
+		"\tcmp\tr2, #0x80\n"+
+		"\tmovlo\tr0, r2\n"+
+		"\tmovlo\tr1, #1\n"+
+		"\tpoplo\t{r4, r5, pc}\n"+
+		"\tcmp\tr2, #0xc0\n"+
+		"\tblo\truntime.decoderune.bad\n"+
+		// r3 is the width, r4 the rune so far, and r5 the least
+		// rune that needs the width
+		"\tcmp\tr2, #0xe0\n"+
+		"\tmovlo\tr3, #2\n"+
+		"\tandlo\tr4, r2, #0x1f\n"+
+		"\tmovlo\tr5, #0x80\n"+
+		"\tblo\truntime.decoderune.cont\n"+
+		"\tcmp\tr2, #0xf0\n"+
+		"\tmovlo\tr3, #3\n"+
+		"\tandlo\tr4, r2, #0x0f\n"+
+		"\tmovlo\tr5, #0x800\n"+
+		"\tblo\truntime.decoderune.cont\n"+
+		"\tcmp\tr2, #0xf8\n"+
+		"\tbhs\truntime.decoderune.bad\n"+
+		"\tmov\tr3, #4\n"+
+		"\tand\tr4, r2, #0x07\n"+
+		"\tmov\tr5, #0x10000\n"+
+		"runtime.decoderune.cont:\n"+
+		"\tcmp\tr1, r3\n"+
+		"\tblo\truntime.decoderune.bad\n"+
+		"\tmov\tr1, #1\n"+
+		"runtime.decoderune.next:\n"+
+		"\tldrb\tr2, [r0, r1]\n"+
+		"\tand\tr12, r2, #0xc0\n"+
+		"\tcmp\tr12, #0x80\n"+
+		"\tbne\truntime.decoderune.bad\n"+
+		"\tand\tr2, r2, #0x3f\n"+
+		"\torr\tr4, r2, r4, lsl #6\n"+
+		"\tadd\tr1, r1, #1\n"+
+		"\tcmp\tr1, r3\n"+
+		"\tblo\truntime.decoderune.next\n"+
+		"\tcmp\tr4, r5\n"+
+		"\tblo\truntime.decoderune.bad\n"+
+		"\tldr\tr2, =0x10ffff\n"+
+		"\tcmp\tr4, r2\n"+
+		"\tbhi\truntime.decoderune.bad\n"+
+		"\tsub\tr2, r4, #0xd800\n"+
+		"\tcmp\tr2, #0x800\n"+
+		"\tblo\truntime.decoderune.bad\n"+
+		"\tmov\tr0, r4\n"+
+		"\tmov\tr1, r3\n"+
+		"\tpop\t{r4, r5, pc}\n"+
+		"runtime.decoderune.bad:\n"+
+		"\tldr\tr0, =0xfffd\n"+
+		"\tmov\tr1, #1\n"+
+		"\tpop\t{r4, r5, pc}\n"...)
+	// runtime.panicdivide is called when an integer is divided by
+	// zero.
+	code = append(code, emitFuncHeader("runtime.panicdivide")...)
+	code = append(code, g.emitWriteString(2, "panic: runtime error: integer divide by zero\n")...)
+	code = append(code, "\tb\truntime.panic\n"...)
+	// runtime.panicshift is called when an integer is shifted by a
+	// negative amount.
+	code = append(code, emitFuncHeader("runtime.panicshift")...)
+	code = append(code, g.emitWriteString(2, "panic: runtime error: negative shift amount\n")...)
+	// and falls through to runtime.panic, which exits with status 2
+	// after a panic's message.
+	code = append(code, emitFuncHeader("runtime.panic")...)
+	code = append(code, "\tmov\tr0, #2\n"...)
+	// runtime.exit exits with the status code r0.
+	code = append(code, emitFuncHeader("runtime.exit")...)
+	code = append(code, "\tmov\tr7, #1\n"+
+		"\tswi\t#0\n"...)
+	return code
+}
+
+// emitWriteString writes the constant s to the file descriptor fd.
+func (g *gen) emitWriteString(fd int, s string) []byte {
+	return bprintf("\tmov\tr0, #%d\n"+
+		"\tldr\tr1, =%s\n"+
+		"\tldr\tr2, =%d\n"+
+		"\tbl\truntime.write\n", fd, g.stringLabel(s), len(s))
+}
+
+// stringLabel returns the label of the string constant s.
+func (g *gen) stringLabel(s string) string {
+	l, ok := g.strLabels[s]
+	if !ok {
+		l = nextLabel()
+		g.strs = append(g.strs, s)
+		g.strLabels[s] = l
+	}
+	return l
+}
+
+// emitStrings emits the string constants into the data section.
+func (g *gen) emitStrings() []byte {
+	if len(g.strs) == 0 {
+		return nil
+	}
+	code := []byte("\t.data\n")
+	for _, s := range g.strs {
+		code = append(code, bprintf("%s:\n\t.ascii\t%s\n", g.strLabels[s], asmString(s))...)
+	}
+	return append(code, "\t.text\n"...)
+}
+
+// asmString quotes s for the assembler, which doesn't understand all of
+// Go's escapes.
+func asmString(s string) string {
+	q := []byte{'"'}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			q = append(q, '\\', c)
+		case c < ' ' || c > '~':
+			q = append(q, bprintf("\\%03o", c)...)
+		default:
+			q = append(q, c)
+		}
+	}
+	return string(append(q, '"'))
+}
@@ -0,0 +1,186 @@
+// Package dump writes the token stream and the parse tree of a file as
+// JSON, for debugging and for tools that want to consume them.
+//
+// The schema is versioned; fields may be added within a version, but
+// never renamed or removed. A token dump looks like
+//
+//	{"version": 1, "file": "a.mo", "tokens": [
+//		{"kind": "Keyword", "value": "package", "pos": {"line": 1, "col": 1}},
+//		...
+//	]}
+//
+// and ends with the EOF token (or the Error token that stopped the
+// lexer). An AST dump looks like
+//
+//	{"version": 1, "file": "a.mo", "ast": node}
+//
+// where every node is an object with a "kind", which is the name of
+// its type in package parse, a "pos" if the node records its own
+// position, and then one member for each exported field of the node in
+// declaration order. Child nodes are objects (or null), lists are
+// arrays, and strings and flags are JSON strings and booleans.
+// Information added by the semantic package is not included.
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/samertm/chompy/lex"
+	"github.com/samertm/chompy/parse"
+)
+
+// Version is the version of the schema written by this package.
+const Version = 1
+
+// Tokens reads toks until the lexer is done and writes them to w.
+func Tokens(w io.Writer, name string, toks chan lex.Token) error {
+	d := newDumper(name)
+	d.buf.WriteString(`"tokens":[`)
+	first := true
+	for t := range toks {
+		if !first {
+			d.buf.WriteByte(',')
+		}
+		first = false
+		d.buf.WriteString(`{"kind":`)
+		d.str(t.Typ.String())
+		d.buf.WriteString(`,"value":`)
+		d.str(t.Val)
+		d.buf.WriteString(`,"pos":`)
+		d.pos(t.Pos)
+		d.buf.WriteByte('}')
+		if t.Typ == lex.EOF || t.Typ == lex.Error {
+			break
+		}
+	}
+	d.buf.WriteByte(']')
+	return d.flush(w)
+}
+
+// AST writes the tree rooted at n to w.
+func AST(w io.Writer, name string, n parse.Node) error {
+	d := newDumper(name)
+	d.buf.WriteString(`"ast":`)
+	if err := d.node(reflect.ValueOf(n)); err != nil {
+		return err
+	}
+	return d.flush(w)
+}
+
+type dumper struct {
+	buf bytes.Buffer
+}
+
+func newDumper(name string) *dumper {
+	d := &dumper{}
+	fmt.Fprintf(&d.buf, `{"version":%d,"file":`, Version)
+	d.str(name)
+	d.buf.WriteByte(',')
+	return d
+}
+
+// flush closes the document and writes it to w, indented.
+func (d *dumper) flush(w io.Writer) error {
+	d.buf.WriteByte('}')
+	var out bytes.Buffer
+	if err := json.Indent(&out, d.buf.Bytes(), "", "\t"); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func (d *dumper) str(s string) {
+	b, _ := json.Marshal(s)
+	d.buf.Write(b)
+}
+
+func (d *dumper) pos(p lex.Pos) {
+	fmt.Fprintf(&d.buf, `{"line":%d,"col":%d}`, p.Line, p.Col)
+}
+
+var (
+	nodeType = reflect.TypeOf((*parse.Node)(nil)).Elem()
+	posType  = reflect.TypeOf(lex.Pos{})
+)
+
+// node writes v, which holds a parse.Node (possibly nil, or an
+// interface holding one).
+func (d *dumper) node(v reflect.Value) error {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.IsNil() {
+		d.buf.WriteString("null")
+		return nil
+	}
+	s := v.Elem()
+	t := s.Type()
+	d.buf.WriteString(`{"kind":`)
+	d.str(t.Name())
+	if f := s.FieldByName("Pos"); f.IsValid() && f.Type() == posType {
+		if p := f.Interface().(lex.Pos); p.IsValid() {
+			d.buf.WriteString(`,"pos":`)
+			d.pos(p)
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Type == posType {
+			continue // unexported, or already written
+		}
+		fv := s.Field(i)
+		mark := d.buf.Len()
+		d.buf.WriteByte(',')
+		d.str(f.Name)
+		d.buf.WriteByte(':')
+		ok, err := d.value(fv)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			d.buf.Truncate(mark)
+		}
+	}
+	d.buf.WriteByte('}')
+	return nil
+}
+
+// value writes the field value v. It returns false (and writes
+// nothing) for fields that aren't part of the schema.
+func (d *dumper) value(v reflect.Value) (bool, error) {
+	if v.Type().Implements(nodeType) || v.Type() == nodeType {
+		return true, d.node(v)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		d.str(v.String())
+	case reflect.Bool:
+		fmt.Fprint(&d.buf, v.Bool())
+	case reflect.Slice:
+		if !v.Type().Elem().Implements(nodeType) && v.Type().Elem() != nodeType {
+			return false, fmt.Errorf("dump: unexpected slice type %s", v.Type())
+		}
+		d.buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i != 0 {
+				d.buf.WriteByte(',')
+			}
+			if err := d.node(v.Index(i)); err != nil {
+				return false, err
+			}
+		}
+		d.buf.WriteByte(']')
+	case reflect.Ptr:
+		// pointers to anything other than nodes (stable info)
+		return false, nil
+	default:
+		return false, fmt.Errorf("dump: unexpected field type %s", v.Type())
+	}
+	return true, nil
+}
@@ -0,0 +1,59 @@
+package dump
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/samertm/chompy/lex"
+	"github.com/samertm/chompy/parse"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with the file testdata/name, or rewrites the file
+// with it under -update.
+func golden(t *testing.T, name string, got []byte) {
+	name = "testdata/" + name
+	if *update {
+		if err := os.WriteFile(name, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the dump differs from %s; got\n%s", name, got)
+	}
+}
+
+// TestDumps dumps the tokens and the tree of testdata/prog.go, and
+// compares them with the golden files next to it. go test -update
+// rewrites those.
+func TestDumps(t *testing.T) {
+	const name = "prog.go"
+	src, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_, tokens := lex.Lex(name, string(src))
+	if err := Tokens(&buf, name, tokens); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "prog.tokens.json", buf.Bytes())
+
+	buf.Reset()
+	_, tokens = lex.Lex(name, string(src))
+	tree, err := parse.Start(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AST(&buf, name, tree); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "prog.ast.json", buf.Bytes())
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+)
+
+const limit = 1 << 4
+
+type celsius int16
+
+var names = "héllo"
+
+// add adds a and b.
+func add(a, b int) (int, bool) {
+	return a + b*2, a < b
+}
+
+func main() {
+	var c celsius = 100
+	n, ok := add(3, 'x')
+outer:
+	for i := 0; i < limit; i++ {
+		if i%2 == 0 && ok {
+			continue outer
+		}
+		n += i
+	}
+	for _, r := range names {
+		println(r, -n, !ok)
+	}
+	fmt.Println(c)
+}
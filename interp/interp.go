@@ -0,0 +1,307 @@
+// Package interp runs programs by interpreting their IR, so that what
+// they do can be checked on machines that can't run ARM code.
+//
+// It runs the IR the way the ARM backend does: every value is a word,
+// and operations only look at the bits that their type has. Package
+// level variables and string constants live in a memory of their own,
+// and the runtime functions that the IR calls are built in.
+package interp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/samertm/chompy/ir"
+)
+
+// Run runs the program made of pkgs, one of which must be package
+// main, and returns its exit status. print and println write to stdout,
+// and panics to stderr. The error is about the IR, which can't be run,
+// or about writing the output.
+func Run(pkgs []*ir.Package, stdout, stderr io.Writer) (status int, err error) {
+	m := &machine{
+		funcs:   make(map[string]*function),
+		globals: make(map[string]uint32),
+		strs:    make(map[string]uint32),
+		// address 0 is left out, so that nothing is at nil
+		mem:    make([]byte, 4),
+		stdout: stdout,
+		stderr: stderr,
+	}
+	var main *ir.Package
+	for _, p := range pkgs {
+		if p.Main {
+			main = p
+		}
+		for _, g := range p.Globals {
+			m.global(g)
+		}
+		for _, f := range p.Funcs {
+			m.funcs[f.Name] = newFunction(f)
+		}
+	}
+	if main == nil {
+		return 0, fmt.Errorf("no package main")
+	}
+	defer func() {
+		switch e := recover().(type) {
+		case nil:
+		case exit:
+			status = int(e)
+		case failure:
+			err = e
+		default:
+			panic(e)
+		}
+	}()
+	m.call(ir.InitName(main.Path), nil)
+	m.call("main", nil)
+	return 0, nil
+}
+
+// exit is panicked with to stop the program with an exit status.
+type exit int
+
+// failure is panicked with when the IR can't be run.
+type failure struct {
+	error
+}
+
+func failf(format string, a ...interface{}) {
+	panic(failure{fmt.Errorf(format, a...)})
+}
+
+// machine is the state of a running program.
+type machine struct {
+	funcs map[string]*function
+	// mem holds the package level variables and the string constants.
+	// globals maps the names of the variables to their addresses,
+	// since every package has its own *ir.Global for the ones that it
+	// imports, and strs maps the strings to theirs.
+	mem            []byte
+	globals        map[string]uint32
+	strs           map[string]uint32
+	stdout, stderr io.Writer
+}
+
+// function is a function with its labels worked out.
+type function struct {
+	*ir.Func
+	labels map[*ir.Label]int
+}
+
+func newFunction(f *ir.Func) *function {
+	fn := &function{Func: f, labels: make(map[*ir.Label]int)}
+	for i, in := range f.Code {
+		if l, ok := in.(*ir.Label); ok {
+			fn.labels[l] = i
+		}
+	}
+	return fn
+}
+
+// alloc allocates size bytes of memory, aligned to a word, and returns
+// their address.
+func (m *machine) alloc(size int) uint32 {
+	addr := uint32(len(m.mem))
+	m.mem = append(m.mem, make([]byte, (size+3)&^3)...)
+	return addr
+}
+
+// global allocates the variable g, which starts out as g.Init.
+func (m *machine) global(g *ir.Global) {
+	addr := m.alloc(g.Size)
+	m.globals[g.Name] = addr
+	if g.Init != 0 {
+		m.store(addr, g.Init)
+	}
+}
+
+// str returns the address of the bytes of the string constant s.
+func (m *machine) str(s string) uint32 {
+	if addr, ok := m.strs[s]; ok {
+		return addr
+	}
+	addr := m.alloc(len(s))
+	copy(m.mem[addr:], s)
+	m.strs[s] = addr
+	return addr
+}
+
+// bytes returns the n bytes of memory at addr.
+func (m *machine) bytes(addr uint32, n int64) []byte {
+	if addr == 0 || n < 0 || int64(addr)+n > int64(len(m.mem)) {
+		failf("%d bytes at %#x are out of bounds", n, addr)
+	}
+	return m.mem[addr : int64(addr)+n]
+}
+
+func (m *machine) load(addr uint32) int64 {
+	return int64(binary.LittleEndian.Uint32(m.bytes(addr, 4)))
+}
+
+func (m *machine) store(addr uint32, v int64) {
+	binary.LittleEndian.PutUint32(m.bytes(addr, 4), uint32(v))
+}
+
+// frame is a call of a function that's running.
+type frame struct {
+	m    *machine
+	f    *function
+	vars map[*ir.Var]int64
+}
+
+// value returns the value of v, as a word.
+func (fr *frame) value(v ir.Value) int64 {
+	switch v := v.(type) {
+	case *ir.Var:
+		return fr.vars[v]
+	case ir.Const:
+		return v.Val
+	case *ir.Global:
+		addr, ok := fr.m.globals[v.Name]
+		if !ok {
+			failf("no variable %s", v.Name)
+		}
+		return int64(addr)
+	case ir.Str:
+		return int64(fr.m.str(v.S))
+	}
+	failf("I don't handle %T values", v)
+	return 0
+}
+
+// call calls the function called name with args, and returns its
+// results.
+func (m *machine) call(name string, args []int64) []int64 {
+	if rt, ok := runtime[name]; ok {
+		return rt(m, args)
+	}
+	f, ok := m.funcs[name]
+	if !ok {
+		failf("no function %s", name)
+	}
+	if len(args) != len(f.Params) {
+		failf("%s called with %d arguments, but it has %d parameters", name, len(args), len(f.Params))
+	}
+	fr := &frame{m: m, f: f, vars: make(map[*ir.Var]int64)}
+	for i, p := range f.Params {
+		fr.vars[p] = args[i]
+	}
+	for pc := 0; pc < len(f.Code); pc++ {
+		switch in := f.Code[pc].(type) {
+		case *ir.Label:
+		case *ir.Assign:
+			fr.vars[in.Dst] = fr.assign(in)
+		case *ir.Load:
+			fr.vars[in.Dst] = m.load(uint32(fr.value(in.Addr)) + uint32(in.Off))
+		case *ir.Store:
+			m.store(uint32(fr.value(in.Addr))+uint32(in.Off), fr.value(in.Val))
+		case *ir.Goto:
+			pc = fr.jump(in.Label)
+		case *ir.IfZ:
+			if uint32(fr.value(in.Cond)) == 0 {
+				pc = fr.jump(in.Label)
+			}
+		case *ir.Call:
+			var args []int64
+			for _, a := range in.Args {
+				args = append(args, fr.value(a))
+			}
+			results := m.call(in.Func, args)
+			if len(results) != len(in.Dsts) {
+				failf("%s returned %d results, but %d were expected", in.Func, len(results), len(in.Dsts))
+			}
+			for i, d := range in.Dsts {
+				if d != nil {
+					fr.vars[d] = results[i]
+				}
+			}
+		case *ir.Return:
+			var results []int64
+			for _, v := range in.Vals {
+				results = append(results, fr.value(v))
+			}
+			return results
+		default:
+			failf("I don't handle %T", in)
+		}
+	}
+	failf("%s ran off the end of its code", name)
+	return nil
+}
+
+// jump returns the index of the instruction at label l.
+func (fr *frame) jump(l *ir.Label) int {
+	pc, ok := fr.f.labels[l]
+	if !ok {
+		failf("%s has no label %s", fr.f.Name, l.Name)
+	}
+	return pc
+}
+
+// assign returns the value that a gives its Dst.
+func (fr *frame) assign(a *ir.Assign) int64 {
+	x := fr.value(a.X)
+	var y int64
+	if a.Y != nil {
+		y = fr.value(a.Y)
+	}
+	v, ok := a.Eval(x, y)
+	if !ok {
+		fr.m.panic("runtime error: integer divide by zero")
+	}
+	return v
+}
+
+// panic stops the program like the runtime does when it panics.
+func (m *machine) panic(msg string) {
+	m.write(2, []byte("panic: "+msg+"\n"))
+	panic(exit(2))
+}
+
+// write writes b to the file descriptor fd.
+func (m *machine) write(fd int64, b []byte) {
+	var w io.Writer
+	switch fd {
+	case 1:
+		w = m.stdout
+	case 2:
+		w = m.stderr
+	default:
+		failf("write to file descriptor %d", fd)
+	}
+	if _, err := w.Write(b); err != nil {
+		panic(failure{err})
+	}
+}
+
+// runtime holds the functions that the backend provides, which the IR
+// calls.
+var runtime = map[string]func(m *machine, args []int64) []int64{
+	"runtime.write": func(m *machine, args []int64) []int64 {
+		m.write(args[0], m.bytes(uint32(args[1]), int64(int32(args[2]))))
+		return nil
+	},
+	"runtime.printint": func(m *machine, args []int64) []int64 {
+		m.write(args[0], []byte(fmt.Sprint(int32(args[1]))))
+		return nil
+	},
+	"runtime.printuint": func(m *machine, args []int64) []int64 {
+		m.write(args[0], []byte(fmt.Sprint(uint32(args[1]))))
+		return nil
+	},
+	"runtime.panicshift": func(m *machine, args []int64) []int64 {
+		m.panic("runtime error: negative shift amount")
+		return nil
+	},
+	"runtime.exit": func(m *machine, args []int64) []int64 {
+		panic(exit(int32(args[0])))
+	},
+	"runtime.decoderune": func(m *machine, args []int64) []int64 {
+		r, w := utf8.DecodeRune(m.bytes(uint32(args[0]), int64(int32(args[1]))))
+		return []int64{int64(r), int64(w)}
+	},
+}
@@ -0,0 +1,261 @@
+package ir
+
+import "fmt"
+
+// Block is a basic block: a run of instructions that's only entered at
+// the top and only left at the bottom.
+type Block struct {
+	// Index is the block's index in CFG.Blocks.
+	Index int
+	// Label is the label that the block starts with, or nil.
+	Label *Label
+	// Instrs are the block's instructions, without its label. Only
+	// the last one can be a Goto, IfZ or Return.
+	Instrs []Instr
+	// Succs are the blocks that control goes to next. For a block that
+	// ends in an IfZ, the first is the one it falls through to, and
+	// the second the one it jumps to.
+	Succs []*Block
+	Preds []*Block
+}
+
+func (b *Block) String() string {
+	return fmt.Sprintf("b%d", b.Index)
+}
+
+// Last returns the block's last instruction, or nil if it's empty.
+func (b *Block) Last() Instr {
+	if len(b.Instrs) == 0 {
+		return nil
+	}
+	return b.Instrs[len(b.Instrs)-1]
+}
+
+// CFG is the control flow graph of a function.
+type CFG struct {
+	Func *Func
+	// Blocks are in the order of the code. The first is the entry.
+	// Blocks that can't be reached are kept, with no predecessors but
+	// each other.
+	Blocks []*Block
+}
+
+// Entry returns the block that the function starts in.
+func (g *CFG) Entry() *Block {
+	return g.Blocks[0]
+}
+
+// NewCFG splits the code of f into basic blocks, and links them up. A
+// block starts at each label and after each jump or return.
+func NewCFG(f *Func) *CFG {
+	g := &CFG{Func: f}
+	labels := make(map[*Label]*Block)
+	var b *Block
+	newBlock := func() {
+		b = &Block{Index: len(g.Blocks)}
+		g.Blocks = append(g.Blocks, b)
+	}
+	newBlock()
+	for _, in := range f.Code {
+		switch in := in.(type) {
+		case *Label:
+			if b.Label != nil || len(b.Instrs) != 0 {
+				newBlock()
+			}
+			b.Label = in
+			labels[in] = b
+			continue
+		}
+		if b.endsBlock() {
+			newBlock()
+		}
+		b.Instrs = append(b.Instrs, in)
+	}
+	for i, b := range g.Blocks {
+		var next *Block
+		if i+1 < len(g.Blocks) {
+			next = g.Blocks[i+1]
+		}
+		switch in := b.Last().(type) {
+		case *Goto:
+			b.addSucc(labels[in.Label])
+		case *IfZ:
+			b.addSucc(next)
+			b.addSucc(labels[in.Label])
+		case *Return:
+		default:
+			if next != nil {
+				b.addSucc(next)
+			}
+		}
+	}
+	return g
+}
+
+// endsBlock reports whether b's last instruction leaves it.
+func (b *Block) endsBlock() bool {
+	switch b.Last().(type) {
+	case *Goto, *IfZ, *Return:
+		return true
+	}
+	return false
+}
+
+func (b *Block) addSucc(s *Block) {
+	b.Succs = append(b.Succs, s)
+	s.Preds = append(s.Preds, b)
+}
+
+// Code returns the code of the blocks of g, in order. Labels that
+// nothing jumps to any more are dropped, and so are jumps to the next
+// block. A block that used to fall through to one that isn't next any
+// more jumps to it instead.
+func (g *CFG) Code() []Instr {
+	gotos := make(map[*Block]*Goto)
+	for i, b := range g.Blocks {
+		if s := b.fallsTo(); s != nil && (i+1 == len(g.Blocks) || g.Blocks[i+1] != s) {
+			gotos[b] = &Goto{Label: g.label(s)}
+		}
+	}
+	// the blocks' code, without jumps to the next block
+	instrs := make([][]Instr, len(g.Blocks))
+	used := make(map[*Label]bool)
+	for i, b := range g.Blocks {
+		instrs[i] = b.Instrs
+		switch in := b.Last().(type) {
+		case *Goto:
+			if i+1 < len(g.Blocks) && g.Blocks[i+1] == b.Succs[0] {
+				instrs[i] = b.Instrs[:len(b.Instrs)-1]
+			} else {
+				used[in.Label] = true
+			}
+		case *IfZ:
+			used[in.Label] = true
+		}
+		if j, ok := gotos[b]; ok {
+			instrs[i] = append(instrs[i][:len(instrs[i]):len(instrs[i])], j)
+			used[j.Label] = true
+		}
+	}
+	var code []Instr
+	for i, b := range g.Blocks {
+		if b.Label != nil && used[b.Label] {
+			code = append(code, b.Label)
+		}
+		code = append(code, instrs[i]...)
+	}
+	return code
+}
+
+// fallsTo returns the block that b goes to without jumping, or nil.
+func (b *Block) fallsTo() *Block {
+	switch b.Last().(type) {
+	case *Goto, *Return:
+		return nil
+	case *IfZ:
+		return b.Succs[0]
+	}
+	if len(b.Succs) == 0 {
+		return nil
+	}
+	return b.Succs[0]
+}
+
+// label returns b's label, giving it a new one if it hasn't one.
+func (g *CFG) label(b *Block) *Label {
+	if b.Label != nil {
+		return b.Label
+	}
+	names := make(map[string]bool)
+	for _, b := range g.Blocks {
+		if b.Label != nil {
+			names[b.Label.Name] = true
+		}
+	}
+	for i := 0; ; i++ {
+		if name := fmt.Sprintf("L%d", i); !names[name] {
+			b.Label = &Label{Name: name}
+			return b.Label
+		}
+	}
+}
+
+// RemoveUnreachable removes the blocks that can't be reached from the
+// entry, and renumbers the rest.
+func (g *CFG) RemoveUnreachable() {
+	r := g.Reachable()
+	for _, b := range g.Blocks {
+		if r[b.Index] {
+			continue
+		}
+		for _, s := range b.Succs {
+			if r[s.Index] {
+				s.removePred(b)
+			}
+		}
+	}
+	var blocks []*Block
+	for _, b := range g.Blocks {
+		if r[b.Index] {
+			b.Index = len(blocks)
+			blocks = append(blocks, b)
+		}
+	}
+	g.Blocks = blocks
+}
+
+// removePred removes the edges from p to b, along with the arguments
+// of b's phis for them.
+func (b *Block) removePred(p *Block) {
+	var preds []*Block
+	var keep []bool
+	for _, q := range b.Preds {
+		keep = append(keep, q != p)
+		if q != p {
+			preds = append(preds, q)
+		}
+	}
+	b.Preds = preds
+	for _, in := range b.Instrs {
+		phi, ok := in.(*Phi)
+		if !ok {
+			break
+		}
+		var args []Value
+		for j, a := range phi.Args {
+			if keep[j] {
+				args = append(args, a)
+			}
+		}
+		phi.Args = args
+	}
+}
+
+// postorder returns the blocks that can be reached from the entry, in
+// postorder.
+func (g *CFG) postorder() []*Block {
+	var order []*Block
+	seen := make([]bool, len(g.Blocks))
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		seen[b.Index] = true
+		for _, s := range b.Succs {
+			if !seen[s.Index] {
+				visit(s)
+			}
+		}
+		order = append(order, b)
+	}
+	visit(g.Entry())
+	return order
+}
+
+// Reachable reports which blocks can be reached from the entry,
+// indexed by Block.Index.
+func (g *CFG) Reachable() []bool {
+	r := make([]bool, len(g.Blocks))
+	for _, b := range g.postorder() {
+		r[b.Index] = true
+	}
+	return r
+}
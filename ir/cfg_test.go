@@ -0,0 +1,259 @@
+package ir_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/samertm/chompy/ir"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// loop returns a function that counts i up to 10 and returns it.
+func loop() *ir.Func {
+	i, t := &ir.Var{Name: "i"}, &ir.Var{Name: "t"}
+	head, done := &ir.Label{Name: "head"}, &ir.Label{Name: "done"}
+	return &ir.Func{
+		Name:    "loop",
+		Results: 1,
+		Locals:  []*ir.Var{i, t},
+		Code: []ir.Instr{
+			&ir.Assign{Dst: i, X: ir.Const{Val: 0}},
+			head,
+			&ir.Assign{Dst: t, Op: "<", X: i, Y: ir.Const{Val: 10}, Type: ir.Int32},
+			&ir.IfZ{Cond: t, Label: done},
+			&ir.Assign{Dst: i, Op: "+", X: i, Y: ir.Const{Val: 1}, Type: ir.Int32},
+			&ir.Goto{Label: head},
+			done,
+			&ir.Return{Vals: []ir.Value{i}},
+		},
+	}
+}
+
+// nested returns a function with a loop inside another, the inner one
+// with two back edges to its header.
+func nested() *ir.Func {
+	p := &ir.Var{Name: "p"}
+	outer, inner, next := &ir.Label{Name: "outer"}, &ir.Label{Name: "inner"}, &ir.Label{Name: "next"}
+	return &ir.Func{
+		Name:   "nested",
+		Params: []*ir.Var{p},
+		Code: []ir.Instr{
+			outer,
+			inner,
+			&ir.IfZ{Cond: p, Label: next},
+			&ir.Goto{Label: inner},
+			next,
+			&ir.IfZ{Cond: p, Label: inner},
+			&ir.IfZ{Cond: p, Label: outer},
+			&ir.Return{},
+		},
+	}
+}
+
+// forever returns a function that never returns, like one that ends in
+// for {}.
+func forever() *ir.Func {
+	x := &ir.Var{Name: "x"}
+	top := &ir.Label{Name: "top"}
+	return &ir.Func{
+		Name:   "forever",
+		Locals: []*ir.Var{x},
+		Code: []ir.Instr{
+			&ir.Assign{Dst: x, X: ir.Const{Val: 0}},
+			top,
+			&ir.Assign{Dst: x, Op: "+", X: x, Y: ir.Const{Val: 1}, Type: ir.Int32},
+			&ir.Goto{Label: top},
+		},
+	}
+}
+
+// spin returns a function that either returns, or loops forever.
+func spin() *ir.Func {
+	p := &ir.Var{Name: "p"}
+	top, out := &ir.Label{Name: "top"}, &ir.Label{Name: "out"}
+	return &ir.Func{
+		Name:   "spin",
+		Params: []*ir.Var{p},
+		Code: []ir.Instr{
+			&ir.IfZ{Cond: p, Label: out},
+			top,
+			&ir.Goto{Label: top},
+			out,
+			&ir.Return{},
+		},
+	}
+}
+
+// dead returns a function with code after its return.
+func dead() *ir.Func {
+	x := &ir.Var{Name: "x"}
+	return &ir.Func{
+		Name:   "dead",
+		Locals: []*ir.Var{x},
+		Code: []ir.Instr{
+			&ir.Return{},
+			&ir.Assign{Dst: x, X: ir.Const{Val: 1}},
+			&ir.Return{},
+		},
+	}
+}
+
+// blocks formats the blocks of g with their successors, like
+// "b0:b1,b2 b1:".
+func blocks(g *ir.CFG) string {
+	var s []string
+	for _, b := range g.Blocks {
+		var succs []string
+		for _, x := range b.Succs {
+			succs = append(succs, x.String())
+		}
+		s = append(s, b.String()+":"+strings.Join(succs, ","))
+	}
+	return strings.Join(s, " ")
+}
+
+// idoms formats the immediate dominators in t, like "b1:b0 b2:-", where
+// "-" is for a root, and leaves out the blocks that aren't in the tree.
+func idoms(g *ir.CFG, t *ir.DomTree) string {
+	var s []string
+	for _, b := range g.Blocks {
+		switch {
+		case !t.Contains(b):
+		case t.Idom[b.Index] == nil:
+			s = append(s, b.String()+":-")
+		default:
+			s = append(s, b.String()+":"+t.Idom[b.Index].String())
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+func TestCFG(t *testing.T) {
+	tests := []struct {
+		f            *ir.Func
+		blocks       string
+		dom, postdom string
+		loops        []string
+	}{
+		{
+			f:       diamond(),
+			blocks:  "b0:b1,b2 b1:b3 b2:b3 b3:",
+			dom:     "b0:- b1:b0 b2:b0 b3:b0",
+			postdom: "b0:b3 b1:b3 b2:b3 b3:-",
+		},
+		{
+			f:       loop(),
+			blocks:  "b0:b1 b1:b2,b3 b2:b1 b3:",
+			dom:     "b0:- b1:b0 b2:b1 b3:b1",
+			postdom: "b0:b1 b1:b3 b2:b1 b3:-",
+			loops:   []string{"b1 b1,b2 1"},
+		},
+		{
+			f:       nested(),
+			blocks:  "b0:b1 b1:b2,b3 b2:b1 b3:b4,b1 b4:b5,b0 b5:",
+			dom:     "b0:- b1:b0 b2:b1 b3:b1 b4:b3 b5:b4",
+			postdom: "b0:b1 b1:b3 b2:b1 b3:b4 b4:b5 b5:-",
+			loops:   []string{"b0 b0,b1,b2,b3,b4 1", "b1 b1,b2,b3 2"},
+		},
+		{
+			// the loop never gets to a return, so nothing
+			// post-dominates it but the virtual exit, and it isn't
+			// in the tree
+			f:       forever(),
+			blocks:  "b0:b1 b1:b1",
+			dom:     "b0:- b1:b0",
+			postdom: "",
+			loops:   []string{"b1 b1 1"},
+		},
+		{
+			f:       spin(),
+			blocks:  "b0:b1,b2 b1:b1 b2:",
+			dom:     "b0:- b1:b0 b2:b0",
+			postdom: "b0:b2 b2:-",
+			loops:   []string{"b1 b1 1"},
+		},
+		{
+			// the code after the return is its own block, which
+			// isn't in the dominator tree
+			f:       dead(),
+			blocks:  "b0: b1:",
+			dom:     "b0:-",
+			postdom: "b0:- b1:-",
+		},
+	}
+	for _, test := range tests {
+		g := ir.NewCFG(test.f)
+		name := test.f.Name
+		if got := blocks(g); got != test.blocks {
+			t.Errorf("%s: blocks are %q, want %q", name, got, test.blocks)
+		}
+		if got := idoms(g, g.Dominators()); got != test.dom {
+			t.Errorf("%s: dominators are %q, want %q", name, got, test.dom)
+		}
+		if got := idoms(g, g.PostDominators()); got != test.postdom {
+			t.Errorf("%s: post-dominators are %q, want %q", name, got, test.postdom)
+		}
+		var loops []string
+		for _, l := range g.Loops() {
+			var bs []string
+			for _, b := range l.Blocks {
+				bs = append(bs, b.String())
+			}
+			loops = append(loops, fmt.Sprintf("%s %s %d", l.Header, strings.Join(bs, ","), l.Depth))
+		}
+		if strings.Join(loops, "; ") != strings.Join(test.loops, "; ") {
+			t.Errorf("%s: loops are %q, want %q", name, loops, test.loops)
+		}
+	}
+}
+
+func TestDominates(t *testing.T) {
+	g := ir.NewCFG(diamond())
+	dom, postdom := g.Dominators(), g.PostDominators()
+	b := g.Blocks
+	for _, test := range []struct {
+		t    *ir.DomTree
+		a, b int
+		want bool
+	}{
+		{dom, 0, 3, true},
+		{dom, 3, 3, true},
+		{dom, 1, 3, false},
+		{dom, 3, 0, false},
+		{postdom, 3, 0, true},
+		{postdom, 1, 0, false},
+		{postdom, 0, 3, false},
+	} {
+		if got := test.t.Dominates(b[test.a], b[test.b]); got != test.want {
+			t.Errorf("Dominates(%s, %s) = %v, want %v", b[test.a], b[test.b], got, test.want)
+		}
+	}
+}
+
+// TestWriteDOT compares the graphs of a few functions with
+// testdata/cfg.dot. go test -update rewrites it.
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	p := &ir.Package{Path: "main", Funcs: []*ir.Func{diamond(), nested(), dead()}}
+	if err := ir.WriteDOT(&buf, []*ir.Package{p}); err != nil {
+		t.Fatal(err)
+	}
+	const golden = "testdata/cfg.dot"
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("WriteDOT wrote\n%s\nwant\n%s", got, want)
+	}
+}
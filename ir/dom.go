@@ -0,0 +1,174 @@
+package ir
+
+// DomTree is a dominator or post-dominator tree of a CFG.
+//
+// A block a dominates b if every path from the entry to b goes through
+// a, and post-dominates it if every path from b to a return goes
+// through a. Every block dominates and post-dominates itself.
+type DomTree struct {
+	// Idom holds the immediate dominator of each block, indexed by
+	// Block.Index. It's nil for the root, and for the blocks that
+	// aren't in the tree: the ones that can't be reached from the
+	// entry, or for post-dominators, that can't reach a return.
+	Idom []*Block
+	// Children holds the blocks that each block immediately
+	// dominates, in the order of the code.
+	Children [][]*Block
+	// Roots are the blocks at the top of the tree: the entry, or for
+	// post-dominators, the blocks that are only post-dominated by the
+	// virtual exit of the function, which every return goes to.
+	Roots []*Block
+	// pre and post number the blocks in a walk of the tree, so that
+	// a dominates b if a's walk encloses b's.
+	pre, post []int
+}
+
+// Dominators returns the dominator tree of g.
+func (g *CFG) Dominators() *DomTree {
+	succs := func(b *Block) []*Block { return b.Succs }
+	preds := func(b *Block) []*Block { return b.Preds }
+	return newDomTree(g, []*Block{g.Entry()}, succs, preds)
+}
+
+// PostDominators returns the post-dominator tree of g, which is the
+// dominator tree of g with its edges reversed, starting from a virtual
+// exit block that every return goes to.
+func (g *CFG) PostDominators() *DomTree {
+	var exits []*Block
+	for _, b := range g.Blocks {
+		if _, ok := b.Last().(*Return); ok {
+			exits = append(exits, b)
+		}
+	}
+	succs := func(b *Block) []*Block { return b.Preds }
+	preds := func(b *Block) []*Block { return b.Succs }
+	return newDomTree(g, exits, succs, preds)
+}
+
+// newDomTree works out the dominator tree of g with the edges given by
+// succs and preds, and a virtual root whose successors are roots. It
+// uses the iterative algorithm from Cooper, Harvey and Kennedy's "A
+// Simple, Fast Dominance Algorithm".
+func newDomTree(g *CFG, roots []*Block, succs, preds func(*Block) []*Block) *DomTree {
+	n := len(g.Blocks)
+	// order numbers the blocks in postorder from the virtual root,
+	// which is numbered n and comes after all of them.
+	order := make([]int, n)
+	for i := range order {
+		order[i] = -1
+	}
+	var rpo []*Block
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		order[b.Index] = -2
+		for _, s := range succs(b) {
+			if order[s.Index] == -1 {
+				visit(s)
+			}
+		}
+		order[b.Index] = len(rpo)
+		rpo = append(rpo, b)
+	}
+	for _, r := range roots {
+		if order[r.Index] == -1 {
+			visit(r)
+		}
+	}
+	// idom is indexed by Block.Index, and holds -1 for blocks without
+	// one yet, and n for the virtual root.
+	idom := make([]int, n+1)
+	for i := range idom {
+		idom[i] = -1
+	}
+	idom[n] = n
+	isRoot := make([]bool, n)
+	for _, r := range roots {
+		isRoot[r.Index] = true
+	}
+	intersect := func(a, b int) int {
+		for a != b {
+			for a != n && (b == n || order[a] < order[b]) {
+				a = idom[a]
+			}
+			for b != n && (a == n || order[b] < order[a]) {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := len(rpo) - 1; i >= 0; i-- {
+			b := rpo[i]
+			d := -1
+			if isRoot[b.Index] {
+				d = n
+			}
+			for _, p := range preds(b) {
+				if order[p.Index] < 0 || idom[p.Index] == -1 {
+					// not reached, or not processed yet
+					continue
+				}
+				if d == -1 {
+					d = p.Index
+				} else {
+					d = intersect(d, p.Index)
+				}
+			}
+			if idom[b.Index] != d {
+				idom[b.Index] = d
+				changed = true
+			}
+		}
+	}
+	t := &DomTree{
+		Idom:     make([]*Block, n),
+		Children: make([][]*Block, n),
+	}
+	for _, b := range g.Blocks {
+		switch d := idom[b.Index]; d {
+		case -1:
+		case n:
+			t.Roots = append(t.Roots, b)
+		default:
+			t.Idom[b.Index] = g.Blocks[d]
+			t.Children[d] = append(t.Children[d], b)
+		}
+	}
+	t.number(n)
+	return t
+}
+
+// number numbers the blocks in a walk of the tree.
+func (t *DomTree) number(n int) {
+	t.pre = make([]int, n)
+	t.post = make([]int, n)
+	var clock int
+	var walk func(b *Block)
+	walk = func(b *Block) {
+		clock++
+		t.pre[b.Index] = clock
+		for _, c := range t.Children[b.Index] {
+			walk(c)
+		}
+		clock++
+		t.post[b.Index] = clock
+	}
+	for _, r := range t.Roots {
+		walk(r)
+	}
+}
+
+// Contains reports whether b is in the tree.
+func (t *DomTree) Contains(b *Block) bool {
+	return t.pre[b.Index] != 0
+}
+
+// Dominates reports whether a dominates b (or post-dominates it, for a
+// post-dominator tree). It's false if either isn't in the tree.
+func (t *DomTree) Dominates(a, b *Block) bool {
+	if !t.Contains(a) || !t.Contains(b) {
+		return false
+	}
+	return t.pre[a.Index] <= t.pre[b.Index] && t.post[b.Index] <= t.post[a.Index]
+}
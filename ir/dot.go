@@ -0,0 +1,100 @@
+package ir
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the control flow graphs of the functions of pkgs to
+// w as one Graphviz digraph, with a cluster for each function. Each
+// block is a box listing its code. The edge that an IfZ jumps along is
+// labelled, back edges are dashed, and loop headers are drawn twice
+// around, with their depth.
+func WriteDOT(w io.Writer, pkgs []*Package) error {
+	d := &dotWriter{w: w}
+	d.printf("digraph cfg {\n")
+	d.printf("\tnode [shape=box, fontname=monospace];\n")
+	for _, p := range pkgs {
+		for _, f := range p.Funcs {
+			d.function(f)
+		}
+	}
+	d.printf("}\n")
+	return d.err
+}
+
+// dotWriter keeps the first error that writing got.
+type dotWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (d *dotWriter) printf(format string, a ...interface{}) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, format, a...)
+	}
+}
+
+func (d *dotWriter) function(f *Func) {
+	g := NewCFG(f)
+	dom := g.Dominators()
+	headers := make(map[*Block]int)
+	for _, l := range g.Loops() {
+		headers[l.Header] = l.Depth
+	}
+	id := func(b *Block) string {
+		return dotQuote(f.Name + "." + b.String())
+	}
+	d.printf("\tsubgraph %s {\n", dotQuote("cluster_"+f.Name))
+	d.printf("\t\tlabel=%s;\n", dotQuote(f.Name))
+	for _, b := range g.Blocks {
+		var label strings.Builder
+		label.WriteString(b.String())
+		if b.Label != nil {
+			label.WriteString(" " + b.Label.String())
+		}
+		label.WriteString("\\l")
+		for _, in := range b.Instrs {
+			for _, line := range strings.Split(in.String(), "\n") {
+				label.WriteString(dotEscape("    "+line) + "\\l")
+			}
+		}
+		attrs := ""
+		if depth, ok := headers[b]; ok {
+			attrs = fmt.Sprintf(", peripheries=2, xlabel=\"loop %d\"", depth)
+		}
+		if !dom.Contains(b) {
+			attrs += ", style=dotted"
+		}
+		d.printf("\t\t%s [label=\"%s\"%s];\n", id(b), label.String(), attrs)
+	}
+	for _, b := range g.Blocks {
+		_, ifz := b.Last().(*IfZ)
+		for i, s := range b.Succs {
+			var attrs []string
+			if ifz && i == 1 {
+				attrs = append(attrs, "label=\"zero\"")
+			}
+			if dom.Dominates(s, b) {
+				attrs = append(attrs, "style=dashed")
+			}
+			if len(attrs) != 0 {
+				d.printf("\t\t%s -> %s [%s];\n", id(b), id(s), strings.Join(attrs, ", "))
+			} else {
+				d.printf("\t\t%s -> %s;\n", id(b), id(s))
+			}
+		}
+	}
+	d.printf("\t}\n")
+}
+
+// dotQuote quotes s as a DOT ID.
+func dotQuote(s string) string {
+	return "\"" + dotEscape(s) + "\""
+}
+
+// dotEscape escapes s for the inside of a quoted DOT string.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,83 @@
+package ir
+
+// Eval works out the value that a gives its Dst when X is x and Y is y,
+// as words, the way the machine does: the operands are wrapped to a's
+// Type first, and so is the result. It's false if a divides by zero.
+func (a *Assign) Eval(x, y int64) (int64, bool) {
+	t := a.Type
+	switch {
+	case a.Op == "":
+		return x, true
+	case a.Op == Conv:
+		return t.Wrap(x), true
+	case a.Y == nil:
+		x = t.Wrap(x)
+		switch a.Op {
+		case "-":
+			return t.Wrap(-x), true
+		case "^":
+			return t.Wrap(^x), true
+		case "!":
+			return truth(x == 0), true
+		}
+		panic("ir: unknown unary op " + a.Op)
+	}
+	x = t.Wrap(x)
+	switch a.Op {
+	case "<<", ">>":
+		// the count is unsigned, whatever x is
+		n := uint32(y)
+		if n > 63 {
+			n = 63
+		}
+		if a.Op == "<<" {
+			return t.Wrap(x << n), true
+		}
+		return t.Wrap(x >> n), true
+	}
+	y = t.Wrap(y)
+	switch a.Op {
+	case "+":
+		return t.Wrap(x + y), true
+	case "-":
+		return t.Wrap(x - y), true
+	case "*":
+		return t.Wrap(x * y), true
+	case "/", "%":
+		if y == 0 {
+			return 0, false
+		}
+		if a.Op == "/" {
+			return t.Wrap(x / y), true
+		}
+		return t.Wrap(x % y), true
+	case "&":
+		return x & y, true
+	case "|":
+		return x | y, true
+	case "^":
+		return x ^ y, true
+	case "&^":
+		return x &^ y, true
+	case "==":
+		return truth(x == y), true
+	case "!=":
+		return truth(x != y), true
+	case "<":
+		return truth(x < y), true
+	case "<=":
+		return truth(x <= y), true
+	case ">":
+		return truth(x > y), true
+	case ">=":
+		return truth(x >= y), true
+	}
+	panic("ir: unknown op " + a.Op)
+}
+
+func truth(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,238 @@
+// Package ir is the three address code that checked packages are
+// lowered to, as described in semantic/tac.txt. Backends and
+// optimizations work on it instead of the parse tree.
+//
+// Every value is a word. A function's variables, temporaries included,
+// are *Vars, and an instruction assigns to at most one of them, apart
+// from calls with more than one result. Package level variables are
+// only reached through their addresses, with Load and Store.
+package ir
+
+import "fmt"
+
+// Type is the type of the operands of an operation, which says how the
+// result wraps around and whether it's signed.
+type Type int
+
+const (
+	Int32 Type = iota
+	Int16
+	Int8
+	Uint32
+	Uint16
+	Uint8
+	Bool
+)
+
+var typeNames = [...]string{
+	Int32:  "int32",
+	Int16:  "int16",
+	Int8:   "int8",
+	Uint32: "uint32",
+	Uint16: "uint16",
+	Uint8:  "uint8",
+	Bool:   "bool",
+}
+
+func (t Type) String() string {
+	return typeNames[t]
+}
+
+// Bits is the number of bits that values of the type have.
+func (t Type) Bits() uint {
+	switch t {
+	case Int16, Uint16:
+		return 16
+	case Int8, Uint8, Bool:
+		return 8
+	}
+	return 32
+}
+
+// Signed reports whether t is a signed integer type.
+func (t Type) Signed() bool {
+	return t == Int32 || t == Int16 || t == Int8
+}
+
+// Wrap returns v wrapped around to fit in t: sign extended from its
+// size if t is signed, and zero extended if it isn't.
+func (t Type) Wrap(v int64) int64 {
+	shift := 64 - t.Bits()
+	if t.Signed() {
+		return v << shift >> shift
+	}
+	return int64(uint64(v) << shift >> shift)
+}
+
+// Package is a lowered package.
+type Package struct {
+	// Path is the import path, or "main".
+	Path string
+	// Main is set for package main, where the program starts.
+	Main    bool
+	Globals []*Global
+	// Funcs includes the init function, which runs the package's
+	// initializers and init functions once, after the init functions
+	// of the packages it imports.
+	Funcs []*Func
+}
+
+// InitName is the name of the init function of the package path.
+func InitName(path string) string {
+	return path + ".init"
+}
+
+// Value is an operand of an instruction.
+type Value interface {
+	String() string
+	value()
+}
+
+// Var is a local variable, parameter or temporary of a function. Vars
+// are compared by identity; the name is only for printing.
+type Var struct {
+	Name string
+}
+
+// Const is a constant. Its value fits the type of the operation it's
+// used in.
+type Const struct {
+	Val int64
+}
+
+// Global is the address of a package level variable. Its name is its
+// label, and it's Size bytes, starting out as Init.
+type Global struct {
+	Name string
+	Size int
+	Init int64
+}
+
+// Str is the address of the bytes of a string constant.
+type Str struct {
+	S string
+}
+
+func (*Var) value()    {}
+func (Const) value()   {}
+func (*Global) value() {}
+func (Str) value()     {}
+
+func (v *Var) String() string    { return v.Name }
+func (c Const) String() string   { return fmt.Sprint(c.Val) }
+func (g *Global) String() string { return g.Name }
+func (s Str) String() string     { return fmt.Sprintf("%q", s.S) }
+
+// Func is a lowered function. Its name is its label.
+type Func struct {
+	Name   string
+	Params []*Var
+	// Results is the number of results.
+	Results int
+	// Locals are the variables other than the parameters.
+	Locals []*Var
+	Code   []Instr
+}
+
+// NewVar adds a local called name to f.
+func (f *Func) NewVar(name string) *Var {
+	v := &Var{Name: name}
+	f.Locals = append(f.Locals, v)
+	return v
+}
+
+// Instr is an instruction.
+type Instr interface {
+	String() string
+	instr()
+}
+
+// Label marks a place in the code that can be jumped to. Labels are
+// compared by identity.
+type Label struct {
+	Name string
+}
+
+// Assign is Dst = X Op Y, or Dst = Op X if Y is nil. Type is the type
+// of the operands, which the result wraps around to fit. Comparisons
+// give 0 or 1, shift counts are unsigned, shifts by the width of Type
+// or more shift every bit out, and division panics if Y is 0. The unary ops are "-", "^" and "!".
+// An empty Op copies X, and Conv converts it to Type. Pos is where the
+// operation is in the source, as file:line:col, for warnings about it;
+// it may be empty.
+type Assign struct {
+	Dst  *Var
+	Op   string
+	X, Y Value
+	Type Type
+	Pos  string
+}
+
+// Load is Dst = *(Addr + Off).
+type Load struct {
+	Dst  *Var
+	Addr Value
+	Off  int
+}
+
+// Store is *(Addr + Off) = Val.
+type Store struct {
+	Addr Value
+	Off  int
+	Val  Value
+}
+
+// Goto jumps to Label.
+type Goto struct {
+	Label *Label
+}
+
+// IfZ jumps to Label if Cond is zero.
+type IfZ struct {
+	Cond  Value
+	Label *Label
+}
+
+// Call calls the function Func with Args, and assigns its results to
+// Dsts, which has one entry for each result. A result is dropped by
+// leaving its Dst nil.
+type Call struct {
+	Dsts []*Var
+	Func string
+	Args []Value
+}
+
+// Return returns Vals from the function.
+type Return struct {
+	Vals []Value
+}
+
+// Phi is Dst = the Arg for the block that control came from. It's only
+// in SSA form, at the top of a block, with an Arg for each of the
+// block's Preds, in the same order.
+type Phi struct {
+	Dst  *Var
+	Args []Value
+}
+
+func (*Label) instr()  {}
+func (*Assign) instr() {}
+func (*Load) instr()   {}
+func (*Store) instr()  {}
+func (*Goto) instr()   {}
+func (*IfZ) instr()    {}
+func (*Call) instr()   {}
+func (*Return) instr() {}
+func (*Phi) instr()    {}
+
+// Conv is the Op of an Assign that converts X to its Type.
+const Conv = "conv"
+
+// Comparison reports whether op is a comparison.
+func Comparison(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package ir
+
+// Loop is a natural loop: a header block that dominates the rest of the
+// loop, and the blocks that can get back to it without going through
+// it.
+type Loop struct {
+	Header *Block
+	// Blocks are the blocks of the loop, including the header and the
+	// blocks of any loops inside it, in the order of the code.
+	Blocks []*Block
+	// Parent is the smallest loop that this one is inside, or nil.
+	Parent *Loop
+	// Depth is the number of loops that this one is inside, counting
+	// itself.
+	Depth int
+}
+
+// Contains reports whether b is in the loop.
+func (l *Loop) Contains(b *Block) bool {
+	for _, lb := range l.Blocks {
+		if lb == b {
+			return true
+		}
+	}
+	return false
+}
+
+// BackEdges returns the edges of g whose target dominates their source,
+// as pairs of source and target, using the dominator tree dom.
+func (g *CFG) BackEdges(dom *DomTree) [][2]*Block {
+	var edges [][2]*Block
+	for _, b := range g.Blocks {
+		for _, s := range b.Succs {
+			if dom.Dominates(s, b) {
+				edges = append(edges, [2]*Block{b, s})
+			}
+		}
+	}
+	return edges
+}
+
+// Loops returns the natural loops of g, outer loops before the loops
+// inside them. Back edges to the same header make one loop.
+func (g *CFG) Loops() []*Loop {
+	dom := g.Dominators()
+	var loops []*Loop
+	in := make(map[*Block][]bool)
+	for _, e := range g.BackEdges(dom) {
+		tail, h := e[0], e[1]
+		body, ok := in[h]
+		if !ok {
+			body = make([]bool, len(g.Blocks))
+			body[h.Index] = true
+			in[h] = body
+			loops = append(loops, &Loop{Header: h})
+		}
+		// walk back from the tail until the header, leaving out the
+		// blocks that can't be reached
+		work := []*Block{tail}
+		for len(work) != 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			if body[b.Index] || !dom.Contains(b) {
+				continue
+			}
+			body[b.Index] = true
+			work = append(work, b.Preds...)
+		}
+	}
+	for _, l := range loops {
+		for _, b := range g.Blocks {
+			if in[l.Header][b.Index] {
+				l.Blocks = append(l.Blocks, b)
+			}
+		}
+	}
+	// A loop is inside another if the other has its header, and the
+	// smallest of those is its parent.
+	for _, l := range loops {
+		for _, o := range loops {
+			if o != l && in[o.Header][l.Header.Index] &&
+				(l.Parent == nil || len(o.Blocks) < len(l.Parent.Blocks)) {
+				l.Parent = o
+			}
+		}
+	}
+	var sorted []*Loop
+	var depth func(l *Loop) int
+	depth = func(l *Loop) int {
+		if l.Depth == 0 {
+			l.Depth = 1
+			if l.Parent != nil {
+				l.Depth += depth(l.Parent)
+			}
+		}
+		return l.Depth
+	}
+	for d := 1; len(sorted) < len(loops); d++ {
+		for _, l := range loops {
+			if depth(l) == d {
+				sorted = append(sorted, l)
+			}
+		}
+	}
+	return sorted
+}
@@ -0,0 +1,35 @@
+package ir
+
+import (
+	"fmt"
+	"os"
+)
+
+// Warn is called with each warning that the passes have about the code,
+// like a division by zero that's sure to happen. By default it prints
+// to standard error.
+var Warn = func(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+}
+
+// Optimize runs the passes over the functions of p. Each function is
+// put into SSA form, where the passes work, checked, and taken back out
+// of it for the backends. The error is about a pass that went wrong.
+func Optimize(p *Package) error {
+	for _, f := range p.Funcs {
+		g := NewCFG(f)
+		g.ToSSA()
+		if err := g.VerifySSA(); err != nil {
+			return fmt.Errorf("bad SSA: %s", err)
+		}
+		for _, w := range g.SCCP() {
+			Warn(w)
+		}
+		if err := g.VerifySSA(); err != nil {
+			return fmt.Errorf("bad SSA after SCCP: %s", err)
+		}
+		g.FromSSA()
+		f.Code = g.Code()
+	}
+	return nil
+}
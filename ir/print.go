@@ -0,0 +1,167 @@
+package ir
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// String prints the functions of p in the syntax of semantic/tac.txt,
+// one after another.
+func (p *Package) String() string {
+	var buf bytes.Buffer
+	for i, f := range p.Funcs {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(f.String())
+	}
+	return buf.String()
+}
+
+// String prints f. Labels start their own lines, and every other
+// instruction is indented:
+//
+//	f:
+//		BeginFunc 8
+//		t0 = x < 10
+//		IfZ t0 Goto L0
+//		...
+//		EndFunc
+//
+// BeginFunc is given the size of the locals.
+func (f *Func) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s:\n\tBeginFunc %d\n", f.Name, 4*len(f.Locals))
+	for _, in := range f.Code {
+		if _, ok := in.(*Label); ok {
+			fmt.Fprintln(&buf, in)
+			continue
+		}
+		for _, line := range strings.Split(in.String(), "\n") {
+			fmt.Fprintf(&buf, "\t%s\n", line)
+		}
+	}
+	buf.WriteString("\tEndFunc\n")
+	return buf.String()
+}
+
+func (l *Label) String() string {
+	return l.Name + ":"
+}
+
+func (a *Assign) String() string {
+	switch {
+	case a.Op == "":
+		return fmt.Sprintf("%s = %s", a.Dst, a.X)
+	case a.Op == Conv:
+		return fmt.Sprintf("%s = %s(%s)", a.Dst, a.Type, a.X)
+	case a.Y == nil:
+		return fmt.Sprintf("%s = %s %s", a.Dst, a.Op, a.X)
+	}
+	return fmt.Sprintf("%s = %s %s %s", a.Dst, a.X, a.Op, a.Y)
+}
+
+func (l *Load) String() string {
+	return fmt.Sprintf("%s = %s", l.Dst, address(l.Addr, l.Off))
+}
+
+func (s *Store) String() string {
+	return fmt.Sprintf("%s = %s", address(s.Addr, s.Off), s.Val)
+}
+
+// address prints the word at addr+off.
+func address(addr Value, off int) string {
+	if off == 0 {
+		return "*" + addr.String()
+	}
+	return fmt.Sprintf("*(%s + %d)", addr, off)
+}
+
+func (g *Goto) String() string {
+	return "Goto " + g.Label.Name
+}
+
+func (i *IfZ) String() string {
+	return fmt.Sprintf("IfZ %s Goto %s", i.Cond, i.Label.Name)
+}
+
+// String prints c as the arguments being pushed, last first, then the
+// call, then the arguments being popped.
+func (c *Call) String() string {
+	var lines []string
+	for i := len(c.Args) - 1; i >= 0; i-- {
+		lines = append(lines, "PushParam "+c.Args[i].String())
+	}
+	call := "LCall " + c.Func
+	var dsts []string
+	var assigns bool
+	for _, d := range c.Dsts {
+		if d == nil {
+			dsts = append(dsts, "_")
+			continue
+		}
+		dsts = append(dsts, d.Name)
+		assigns = true
+	}
+	if assigns {
+		call = strings.Join(dsts, ", ") + " = " + call
+	}
+	lines = append(lines, call)
+	if len(c.Args) > 0 {
+		lines = append(lines, fmt.Sprintf("PopParams %d", 4*len(c.Args)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *Return) String() string {
+	if len(r.Vals) == 0 {
+		return "Return"
+	}
+	var vals []string
+	for _, v := range r.Vals {
+		vals = append(vals, v.String())
+	}
+	return "Return " + strings.Join(vals, ", ")
+}
+
+func (p *Phi) String() string {
+	var args []string
+	for _, a := range p.Args {
+		args = append(args, a.String())
+	}
+	return fmt.Sprintf("%s = Phi(%s)", p.Dst, strings.Join(args, ", "))
+}
+
+// String prints the blocks of g, each with its label and predecessors,
+// so that the arguments of phis can be matched up with them:
+//
+//	f:
+//	b0:
+//		x = 0
+//		Goto L1
+//	b1: L0 <- b2
+//		...
+func (g *CFG) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s:\n", g.Func.Name)
+	for _, b := range g.Blocks {
+		buf.WriteString(b.String() + ":")
+		if b.Label != nil {
+			buf.WriteString(" " + b.Label.Name)
+		}
+		if len(b.Preds) != 0 {
+			buf.WriteString(" <-")
+			for _, p := range b.Preds {
+				buf.WriteString(" " + p.String())
+			}
+		}
+		buf.WriteByte('\n')
+		for _, in := range b.Instrs {
+			for _, line := range strings.Split(in.String(), "\n") {
+				fmt.Fprintf(&buf, "\t%s\n", line)
+			}
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,347 @@
+package ir
+
+import "fmt"
+
+// lattice is what SCCP knows about the value of a variable: nothing
+// yet, that it's a constant, or that it varies.
+type lattice struct {
+	kind int
+	val  int64
+}
+
+const (
+	unknown = iota
+	constant
+	varies
+)
+
+// meet returns what's known about a value that can be either a or b.
+func meet(a, b lattice) lattice {
+	switch {
+	case a.kind == unknown:
+		return b
+	case b.kind == unknown:
+		return a
+	case a.kind == constant && b.kind == constant && a.val == b.val:
+		return a
+	}
+	return lattice{kind: varies}
+}
+
+// sccp is the state of sparse conditional constant propagation over a
+// CFG in SSA form, after Wegman and Zadeck's "Constant Propagation with
+// Conditional Branches".
+type sccp struct {
+	g    *CFG
+	vals map[*Var]lattice
+	// users maps each variable to the instructions that use it, and
+	// the blocks that they're in.
+	users map[*Var][]use
+	// edges records which edges into each block can be taken, indexed
+	// by the block's Index and then its Preds, and blocks which blocks
+	// can run.
+	edges  [][]bool
+	blocks []bool
+	// flow holds the edges that have been found to be taken, as
+	// blocks and indexes into their Preds, and ssa the instructions
+	// whose operands have changed.
+	flow []edge
+	ssa  []use
+}
+
+type use struct {
+	b  *Block
+	in Instr
+}
+
+type edge struct {
+	to *Block
+	j  int
+}
+
+// SCCP propagates constants through g, which must be in SSA form,
+// following only the branches that can be taken. Variables that turn
+// out to be constant are replaced by their values, branches on
+// constants become jumps, and the code that can't be reached any more
+// is removed.
+//
+// Operations on constants wrap around like they do when they run, and
+// a division by zero is left to panic when it runs, since only constant
+// expressions are checked at compile time. SCCP returns warnings about
+// the divisions by zero and the arithmetic that overflows that it finds
+// in the code that can run, like vet would.
+func (g *CFG) SCCP() []string {
+	s := &sccp{
+		g:      g,
+		vals:   make(map[*Var]lattice),
+		users:  make(map[*Var][]use),
+		edges:  make([][]bool, len(g.Blocks)),
+		blocks: make([]bool, len(g.Blocks)),
+	}
+	for _, p := range g.Func.Params {
+		s.vals[p] = lattice{kind: varies}
+	}
+	for _, b := range g.Blocks {
+		s.edges[b.Index] = make([]bool, len(b.Preds))
+		for _, in := range b.Instrs {
+			for _, u := range uses(in) {
+				if v, ok := (*u).(*Var); ok {
+					s.users[v] = append(s.users[v], use{b, in})
+				}
+			}
+		}
+	}
+	s.visitBlock(g.Entry())
+	for len(s.flow) != 0 || len(s.ssa) != 0 {
+		for len(s.flow) != 0 {
+			e := s.flow[len(s.flow)-1]
+			s.flow = s.flow[:len(s.flow)-1]
+			if s.blocks[e.to.Index] {
+				// only the phis can see the new edge
+				for _, in := range e.to.Instrs {
+					if _, ok := in.(*Phi); !ok {
+						break
+					}
+					s.visit(e.to, in)
+				}
+				continue
+			}
+			s.visitBlock(e.to)
+		}
+		for len(s.ssa) != 0 {
+			u := s.ssa[len(s.ssa)-1]
+			s.ssa = s.ssa[:len(s.ssa)-1]
+			if s.blocks[u.b.Index] {
+				s.visit(u.b, u.in)
+			}
+		}
+	}
+	warnings := s.check()
+	s.rewrite()
+	return warnings
+}
+
+// visitBlock visits the instructions of b, which can run.
+func (s *sccp) visitBlock(b *Block) {
+	s.blocks[b.Index] = true
+	for _, in := range b.Instrs {
+		s.visit(b, in)
+	}
+	if !b.endsBlock() && len(b.Succs) != 0 {
+		s.take(b, b.Succs[0])
+	}
+}
+
+// take records that the edge from b to to can be taken.
+func (s *sccp) take(b, to *Block) {
+	for j, p := range to.Preds {
+		if p == b && !s.edges[to.Index][j] {
+			s.edges[to.Index][j] = true
+			s.flow = append(s.flow, edge{to, j})
+		}
+	}
+}
+
+// value returns what's known about v.
+func (s *sccp) value(v Value) lattice {
+	switch v := v.(type) {
+	case Const:
+		return lattice{kind: constant, val: v.Val}
+	case *Var:
+		return s.vals[v]
+	}
+	// addresses are only known once the program's linked
+	return lattice{kind: varies}
+}
+
+// set records that v is known to be l, and revisits the users of v if
+// that's news.
+func (s *sccp) set(v *Var, l lattice) {
+	if s.vals[v] == l {
+		return
+	}
+	s.vals[v] = l
+	s.ssa = append(s.ssa, s.users[v]...)
+}
+
+func (s *sccp) visit(b *Block, in Instr) {
+	switch in := in.(type) {
+	case *Phi:
+		var l lattice
+		for j, a := range in.Args {
+			if s.edges[b.Index][j] {
+				l = meet(l, s.value(a))
+			}
+		}
+		s.set(in.Dst, l)
+	case *Assign:
+		s.set(in.Dst, s.assign(in))
+	case *Load:
+		s.set(in.Dst, lattice{kind: varies})
+	case *Call:
+		for _, d := range in.Dsts {
+			if d != nil {
+				s.set(d, lattice{kind: varies})
+			}
+		}
+	case *Goto:
+		s.take(b, b.Succs[0])
+	case *IfZ:
+		switch c := s.value(in.Cond); {
+		case c.kind == varies:
+			s.take(b, b.Succs[0])
+			s.take(b, b.Succs[1])
+		case c.kind == constant && uint32(c.val) == 0:
+			s.take(b, b.Succs[1])
+		case c.kind == constant:
+			s.take(b, b.Succs[0])
+		}
+	}
+}
+
+// assign returns what's known about the value that a gives its Dst.
+func (s *sccp) assign(a *Assign) lattice {
+	x := s.value(a.X)
+	y := lattice{kind: constant}
+	if a.Y != nil {
+		y = s.value(a.Y)
+	}
+	switch {
+	case x.kind == unknown || y.kind == unknown:
+		return lattice{}
+	case x.kind == varies || y.kind == varies:
+		return lattice{kind: varies}
+	}
+	v, ok := a.Eval(x.val, y.val)
+	if !ok {
+		// it panics when it runs
+		return lattice{kind: varies}
+	}
+	return lattice{kind: constant, val: v}
+}
+
+// check returns warnings about the operations on constants in the code
+// that can run that divide by zero or overflow their type.
+func (s *sccp) check() []string {
+	var warnings []string
+	for _, b := range s.g.Blocks {
+		if !s.blocks[b.Index] {
+			continue
+		}
+		for _, in := range b.Instrs {
+			a, ok := in.(*Assign)
+			if !ok || a.Y == nil && a.Op != "-" {
+				continue
+			}
+			x := s.value(a.X)
+			y := lattice{kind: constant}
+			if a.Y != nil {
+				y = s.value(a.Y)
+			}
+			if x.kind != constant || y.kind != constant {
+				continue
+			}
+			if msg := overflow(a, a.Type.Wrap(x.val), a.Type.Wrap(y.val)); msg != "" {
+				if a.Pos != "" {
+					msg = a.Pos + ": " + msg
+				}
+				warnings = append(warnings, msg)
+			}
+		}
+	}
+	return warnings
+}
+
+// overflow describes what's wrong with a when X is x and Y is y, both
+// already wrapped to fit a's Type: it divides by zero, or the result of
+// its arithmetic doesn't fit. It's "" if nothing is.
+func overflow(a *Assign, x, y int64) string {
+	var exact int64
+	switch a.Op {
+	case "/", "%":
+		if y == 0 {
+			return "division by zero"
+		}
+		return ""
+	case "-":
+		if a.Y == nil {
+			if v, _ := a.Eval(x, 0); v != -x {
+				if x < 0 {
+					return fmt.Sprintf("-(%d) overflows %s", x, a.Type)
+				}
+				return fmt.Sprintf("-%d overflows %s", x, a.Type)
+			}
+			return ""
+		}
+		exact = x - y
+	case "+":
+		exact = x + y
+	case "*":
+		exact = x * y
+	default:
+		return ""
+	}
+	if v, _ := a.Eval(x, y); v != exact {
+		return fmt.Sprintf("%d %s %d overflows %s", x, a.Op, y, a.Type)
+	}
+	return ""
+}
+
+// rewrite replaces the variables that are constant with their values,
+// and removes the branches and blocks that can't be taken.
+func (s *sccp) rewrite() {
+	for _, b := range s.g.Blocks {
+		if !s.blocks[b.Index] {
+			continue
+		}
+		var instrs []Instr
+		for _, in := range b.Instrs {
+			if d := defs(in); len(d) == 1 {
+				if _, ok := in.(*Call); !ok && s.vals[*d[0]].kind == constant {
+					// its uses get the constant instead
+					continue
+				}
+			}
+			for _, u := range uses(in) {
+				if v, ok := (*u).(*Var); ok && s.vals[v].kind == constant {
+					*u = Const{s.vals[v].val}
+				}
+			}
+			instrs = append(instrs, in)
+		}
+		b.Instrs = instrs
+		if ifz, ok := b.Last().(*IfZ); ok {
+			if c, ok := ifz.Cond.(Const); ok {
+				b.Instrs = b.Instrs[:len(b.Instrs)-1]
+				if uint32(c.Val) == 0 {
+					b.Instrs = append(b.Instrs, &Goto{Label: ifz.Label})
+					b.removeSucc(0)
+				} else {
+					b.removeSucc(1)
+				}
+			}
+		}
+	}
+	s.g.RemoveUnreachable()
+}
+
+// removeSucc removes the edge to b's i'th successor, along with the
+// arguments of its phis for the edge.
+func (b *Block) removeSucc(i int) {
+	to := b.Succs[i]
+	b.Succs = append(b.Succs[:i:i], b.Succs[i+1:]...)
+	for j, p := range to.Preds {
+		if p != b {
+			continue
+		}
+		to.Preds = append(to.Preds[:j:j], to.Preds[j+1:]...)
+		for _, in := range to.Instrs {
+			phi, ok := in.(*Phi)
+			if !ok {
+				break
+			}
+			phi.Args = append(phi.Args[:j:j], phi.Args[j+1:]...)
+		}
+		return
+	}
+}
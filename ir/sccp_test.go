@@ -0,0 +1,91 @@
+package ir_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/samertm/chompy/ir"
+)
+
+func TestSCCPFoldsBranch(t *testing.T) {
+	f := diamond()
+	// p is 1 from the start, so the else arm can't run
+	p := f.Params[0]
+	f.Params = nil
+	f.Code = append([]ir.Instr{&ir.Assign{Dst: p, X: ir.Const{Val: 1}}}, f.Code...)
+	g := ir.NewCFG(f)
+	g.ToSSA()
+	g.SCCP()
+	if err := g.VerifySSA(); err != nil {
+		t.Fatal(err)
+	}
+	g.FromSSA()
+	code := g.Code()
+	if len(code) != 1 {
+		t.Fatalf("SCCP left %v, want just the return", code)
+	}
+	ret, ok := code[0].(*ir.Return)
+	if !ok || ret.Vals[0] != ir.Value(ir.Const{Val: 1}) {
+		t.Errorf("SCCP left %s, want return 1", code[0])
+	}
+}
+
+func TestSCCPLeavesDivisionByZero(t *testing.T) {
+	x, y := &ir.Var{Name: "x"}, &ir.Var{Name: "y"}
+	f := &ir.Func{
+		Name:    "div",
+		Results: 1,
+		Locals:  []*ir.Var{x, y},
+		Code: []ir.Instr{
+			&ir.Assign{Dst: x, X: ir.Const{Val: 0}},
+			&ir.Assign{Dst: y, Op: "/", X: ir.Const{Val: 7}, Y: x, Type: ir.Int32, Pos: "div.go:4:7"},
+			&ir.Return{Vals: []ir.Value{y}},
+		},
+	}
+	g := ir.NewCFG(f)
+	g.ToSSA()
+	warnings := g.SCCP()
+	if err := g.VerifySSA(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "div.go:4:7: division by zero"; len(warnings) != 1 || warnings[0] != want {
+		t.Errorf("SCCP warned %q, want %q", warnings, want)
+	}
+	// the division is left to panic when it runs
+	div, ok := g.Entry().Instrs[0].(*ir.Assign)
+	if !ok || div.Op != "/" || div.Y != ir.Value(ir.Const{Val: 0}) {
+		t.Errorf("SCCP left %v, want 7 / 0", g.Entry().Instrs)
+	}
+}
+
+func TestSCCPWarnsAboutOverflow(t *testing.T) {
+	x, y := &ir.Var{Name: "x"}, &ir.Var{Name: "y"}
+	p := &ir.Var{Name: "p"}
+	dead := &ir.Label{Name: "dead"}
+	f := &ir.Func{
+		Name:    "overflow",
+		Params:  []*ir.Var{p},
+		Results: 1,
+		Locals:  []*ir.Var{x, y},
+		Code: []ir.Instr{
+			&ir.Assign{Dst: x, Op: "+", X: ir.Const{Val: 127}, Y: ir.Const{Val: 1}, Type: ir.Int8, Pos: "f.go:3:7"},
+			&ir.Assign{Dst: y, Op: "-", X: x, Type: ir.Int8, Pos: "f.go:4:7"},
+			&ir.Assign{Dst: y, Op: "*", X: p, Y: ir.Const{Val: 1000}, Type: ir.Int8, Pos: "f.go:5:7"},
+			&ir.IfZ{Cond: ir.Const{Val: 1}, Label: dead},
+			&ir.Return{Vals: []ir.Value{y}},
+			dead,
+			// it can't run, so it's fine
+			&ir.Assign{Dst: y, Op: "/", X: x, Y: ir.Const{Val: 0}, Type: ir.Int8, Pos: "f.go:8:7"},
+			&ir.Return{Vals: []ir.Value{y}},
+		},
+	}
+	g := ir.NewCFG(f)
+	g.ToSSA()
+	want := []string{
+		"f.go:3:7: 127 + 1 overflows int8",
+		"f.go:4:7: -(-128) overflows int8",
+	}
+	if got := g.SCCP(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SCCP warned %q, want %q", got, want)
+	}
+}
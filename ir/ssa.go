@@ -0,0 +1,422 @@
+package ir
+
+import "fmt"
+
+// In SSA form, every variable is assigned by one instruction, which
+// dominates its uses, and parameters aren't assigned at all. Where
+// assignments to a variable meet, a Phi picks the one that control
+// came through.
+
+// uses returns pointers to the operands that in reads, so that they
+// can be replaced.
+func uses(in Instr) []*Value {
+	switch in := in.(type) {
+	case *Assign:
+		if in.Y != nil {
+			return []*Value{&in.X, &in.Y}
+		}
+		return []*Value{&in.X}
+	case *Load:
+		return []*Value{&in.Addr}
+	case *Store:
+		return []*Value{&in.Addr, &in.Val}
+	case *IfZ:
+		return []*Value{&in.Cond}
+	case *Call:
+		var vs []*Value
+		for i := range in.Args {
+			vs = append(vs, &in.Args[i])
+		}
+		return vs
+	case *Return:
+		var vs []*Value
+		for i := range in.Vals {
+			vs = append(vs, &in.Vals[i])
+		}
+		return vs
+	case *Phi:
+		var vs []*Value
+		for i := range in.Args {
+			vs = append(vs, &in.Args[i])
+		}
+		return vs
+	}
+	return nil
+}
+
+// defs returns pointers to the variables that in assigns, so that they
+// can be replaced.
+func defs(in Instr) []**Var {
+	switch in := in.(type) {
+	case *Assign:
+		return []**Var{&in.Dst}
+	case *Load:
+		return []**Var{&in.Dst}
+	case *Phi:
+		return []**Var{&in.Dst}
+	case *Call:
+		var ds []**Var
+		for i, d := range in.Dsts {
+			if d != nil {
+				ds = append(ds, &in.Dsts[i])
+			}
+		}
+		return ds
+	}
+	return nil
+}
+
+// DominanceFrontiers returns the dominance frontier of each block,
+// indexed by Block.Index: the blocks that it doesn't strictly dominate,
+// but dominates a predecessor of.
+func (g *CFG) DominanceFrontiers(dom *DomTree) [][]*Block {
+	df := make([][]*Block, len(g.Blocks))
+	in := make([]map[*Block]bool, len(g.Blocks))
+	for _, b := range g.Blocks {
+		if len(b.Preds) < 2 || !dom.Contains(b) {
+			continue
+		}
+		for _, p := range b.Preds {
+			for r := p; r != nil && r != dom.Idom[b.Index] && dom.Contains(r); r = dom.Idom[r.Index] {
+				if in[r.Index] == nil {
+					in[r.Index] = make(map[*Block]bool)
+				}
+				if !in[r.Index][b] {
+					in[r.Index][b] = true
+					df[r.Index] = append(df[r.Index], b)
+				}
+			}
+		}
+	}
+	return df
+}
+
+// ToSSA puts g into SSA form. It removes the blocks that can't be
+// reached, places phis where the assignments to variables meet, and
+// gives each assignment a variable of its own. Phis are only placed for
+// the variables that are used in a block other than the one they're
+// assigned in, and only kept if they're used. A variable that can be
+// used before it's assigned starts out as 0, like the variables of the
+// program do.
+func (g *CFG) ToSSA() {
+	g.RemoveUnreachable()
+	f := g.Func
+	dom := g.Dominators()
+	df := g.DominanceFrontiers(dom)
+
+	// The variables that live across blocks, and the blocks that
+	// assign them. The parameters are assigned on entry.
+	var live []*Var
+	isLive := make(map[*Var]bool)
+	assigned := make(map[*Var][]*Block)
+	params := make(map[*Var]bool)
+	for _, p := range f.Params {
+		params[p] = true
+		assigned[p] = append(assigned[p], g.Entry())
+	}
+	for _, b := range g.Blocks {
+		local := make(map[*Var]bool)
+		for _, in := range b.Instrs {
+			for _, u := range uses(in) {
+				if v, ok := (*u).(*Var); ok && !local[v] && !isLive[v] {
+					isLive[v] = true
+					live = append(live, v)
+				}
+			}
+			for _, d := range defs(in) {
+				local[*d] = true
+				assigned[*d] = append(assigned[*d], b)
+			}
+		}
+	}
+
+	// Place the phis, in the frontiers of the assigning blocks, and in
+	// theirs, since each phi is an assignment too.
+	for _, v := range live {
+		placed := make([]bool, len(g.Blocks))
+		work := append([]*Block(nil), assigned[v]...)
+		for len(work) != 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			for _, d := range df[b.Index] {
+				if placed[d.Index] {
+					continue
+				}
+				placed[d.Index] = true
+				phi := &Phi{Dst: v, Args: make([]Value, len(d.Preds))}
+				for j := range phi.Args {
+					phi.Args[j] = v
+				}
+				d.Instrs = append([]Instr{phi}, d.Instrs...)
+				assigned[v] = append(assigned[v], d)
+				work = append(work, d)
+			}
+		}
+	}
+
+	// Rename the variables, walking down the dominator tree with the
+	// value that each one has at that point on a stack. A variable that
+	// is only assigned once keeps its name.
+	count := make(map[*Var]int)
+	for _, b := range g.Blocks {
+		for _, in := range b.Instrs {
+			for _, d := range defs(in) {
+				count[*d]++
+			}
+		}
+	}
+	versions := make(map[*Var]int)
+	stacks := make(map[*Var][]Value)
+	for _, p := range f.Params {
+		stacks[p] = []Value{p}
+	}
+	current := func(v *Var) Value {
+		s := stacks[v]
+		if len(s) == 0 {
+			return Const{0}
+		}
+		return s[len(s)-1]
+	}
+	var rename func(b *Block)
+	rename = func(b *Block) {
+		var pushed []*Var
+		for _, in := range b.Instrs {
+			if _, ok := in.(*Phi); !ok {
+				for _, u := range uses(in) {
+					if v, ok := (*u).(*Var); ok {
+						*u = current(v)
+					}
+				}
+			}
+			for _, d := range defs(in) {
+				v := *d
+				if count[v] > 1 || params[v] {
+					versions[v]++
+					*d = &Var{Name: fmt.Sprintf("%s#%d", v.Name, versions[v])}
+				}
+				stacks[v] = append(stacks[v], *d)
+				pushed = append(pushed, v)
+			}
+		}
+		for _, s := range b.Succs {
+			for j, p := range s.Preds {
+				if p != b {
+					continue
+				}
+				for _, in := range s.Instrs {
+					phi, ok := in.(*Phi)
+					if !ok {
+						break
+					}
+					// The argument is still the variable that the
+					// phi was placed for.
+					if v, ok := phi.Args[j].(*Var); ok {
+						phi.Args[j] = current(v)
+					}
+				}
+			}
+		}
+		for _, c := range dom.Children[b.Index] {
+			rename(c)
+		}
+		for _, v := range pushed {
+			stacks[v] = stacks[v][:len(stacks[v])-1]
+		}
+	}
+	rename(g.Entry())
+	g.removeDeadPhis()
+	g.setLocals()
+}
+
+// removeDeadPhis removes the phis whose values aren't used, apart from
+// by phis that are removed too.
+func (g *CFG) removeDeadPhis() {
+	used := make(map[*Var]int)
+	phis := make(map[*Var]*Phi)
+	for _, b := range g.Blocks {
+		for _, in := range b.Instrs {
+			if phi, ok := in.(*Phi); ok {
+				phis[phi.Dst] = phi
+			}
+			for _, u := range uses(in) {
+				if v, ok := (*u).(*Var); ok {
+					used[v]++
+				}
+			}
+		}
+	}
+	var work []*Phi
+	for v, phi := range phis {
+		if used[v] == 0 {
+			work = append(work, phi)
+		}
+	}
+	dead := make(map[*Phi]bool)
+	for len(work) != 0 {
+		phi := work[len(work)-1]
+		work = work[:len(work)-1]
+		dead[phi] = true
+		for _, a := range phi.Args {
+			if v, ok := a.(*Var); ok {
+				used[v]--
+				if p, ok := phis[v]; ok && used[v] == 0 && !dead[p] {
+					work = append(work, p)
+				}
+			}
+		}
+	}
+	for _, b := range g.Blocks {
+		var instrs []Instr
+		for _, in := range b.Instrs {
+			if phi, ok := in.(*Phi); !ok || !dead[phi] {
+				instrs = append(instrs, in)
+			}
+		}
+		b.Instrs = instrs
+	}
+}
+
+// setLocals sets the locals of g's function to the variables other
+// than the parameters that its code uses, in the order that they turn
+// up in.
+func (g *CFG) setLocals() {
+	f := g.Func
+	seen := make(map[*Var]bool)
+	for _, p := range f.Params {
+		seen[p] = true
+	}
+	f.Locals = nil
+	add := func(v *Var) {
+		if !seen[v] {
+			seen[v] = true
+			f.Locals = append(f.Locals, v)
+		}
+	}
+	for _, b := range g.Blocks {
+		for _, in := range b.Instrs {
+			for _, d := range defs(in) {
+				add(*d)
+			}
+			for _, u := range uses(in) {
+				if v, ok := (*u).(*Var); ok {
+					add(v)
+				}
+			}
+		}
+	}
+}
+
+// VerifySSA checks that g is in SSA form, and that its phis match up
+// with their blocks' predecessors.
+func (g *CFG) VerifySSA() error {
+	f := g.Func
+	dom := g.Dominators()
+	type site struct {
+		b *Block
+		i int
+	}
+	def := make(map[*Var]site)
+	for _, p := range f.Params {
+		def[p] = site{g.Entry(), -1}
+	}
+	for _, b := range g.Blocks {
+		if !dom.Contains(b) {
+			return fmt.Errorf("%s: %s can't be reached", f.Name, b)
+		}
+		phis := true
+		for i, in := range b.Instrs {
+			phi, ok := in.(*Phi)
+			if ok && !phis {
+				return fmt.Errorf("%s: %s: phi after other instructions: %s", f.Name, b, in)
+			}
+			phis = ok
+			if ok && len(phi.Args) != len(b.Preds) {
+				return fmt.Errorf("%s: %s: %s has %d arguments for %d predecessors", f.Name, b, in, len(phi.Args), len(b.Preds))
+			}
+			for _, d := range defs(in) {
+				if _, ok := def[*d]; ok {
+					return fmt.Errorf("%s: %s: %s is assigned more than once", f.Name, b, *d)
+				}
+				def[*d] = site{b, i}
+			}
+		}
+	}
+	// dominates reports whether the assignment of v comes before the
+	// end of block b, or before instruction i of it.
+	dominates := func(v *Var, b *Block, i int) bool {
+		d := def[v]
+		if d.b == b {
+			return d.i < i
+		}
+		return dom.Dominates(d.b, b)
+	}
+	for _, b := range g.Blocks {
+		for i, in := range b.Instrs {
+			for j, u := range uses(in) {
+				v, ok := (*u).(*Var)
+				if !ok {
+					continue
+				}
+				if _, ok := def[v]; !ok {
+					return fmt.Errorf("%s: %s: %s is never assigned: %s", f.Name, b, v, in)
+				}
+				if _, ok := in.(*Phi); ok {
+					p := b.Preds[j]
+					if !dominates(v, p, len(p.Instrs)) {
+						return fmt.Errorf("%s: %s: %s isn't assigned on the way from %s: %s", f.Name, b, v, p, in)
+					}
+				} else if !dominates(v, b, i) {
+					return fmt.Errorf("%s: %s: %s is used before it's assigned: %s", f.Name, b, v, in)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// FromSSA takes g out of SSA form, replacing each phi with copies. The
+// value for the phi is copied to a variable of its own at the end of
+// each predecessor, before the jump if there's one, and from there to
+// the phi's variable where the phi was. Copying through a variable of
+// its own keeps the phis of a block from seeing each other's values,
+// and the value from being seen along the predecessor's other edges.
+func (g *CFG) FromSSA() {
+	for _, b := range g.Blocks {
+		n := 0
+		for n < len(b.Instrs) {
+			if _, ok := b.Instrs[n].(*Phi); !ok {
+				break
+			}
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		var copies []Instr
+		for _, in := range b.Instrs[:n] {
+			phi := in.(*Phi)
+			tmp := &Var{Name: phi.Dst.Name + "'"}
+			done := make(map[*Block]bool)
+			for j, p := range b.Preds {
+				if done[p] {
+					continue
+				}
+				done[p] = true
+				p.insertCopy(&Assign{Dst: tmp, X: phi.Args[j]})
+			}
+			copies = append(copies, &Assign{Dst: phi.Dst, X: tmp})
+		}
+		b.Instrs = append(copies, b.Instrs[n:]...)
+	}
+	g.setLocals()
+}
+
+// insertCopy adds in at the end of b, before its jump if it has one.
+func (b *Block) insertCopy(in Instr) {
+	if b.endsBlock() {
+		n := len(b.Instrs) - 1
+		b.Instrs = append(b.Instrs[:n], in, b.Instrs[n])
+		return
+	}
+	b.Instrs = append(b.Instrs, in)
+}
@@ -0,0 +1,163 @@
+package ir_test
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samertm/chompy/interp"
+	"github.com/samertm/chompy/ir"
+	"github.com/samertm/chompy/load"
+)
+
+// lowerFile lowers the program in file without optimizing it.
+func lowerFile(t *testing.T, file string) []*ir.Package {
+	c := &load.Config{Root: t.TempDir()}
+	pkgs, err := c.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	irs, err := load.Compile(pkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return irs
+}
+
+// run runs pkgs, and returns what they print and their exit status.
+func run(t *testing.T, pkgs []*ir.Package) string {
+	var out bytes.Buffer
+	status, err := interp.Run(pkgs, &out, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%sexit status %d\n", out.String(), status)
+}
+
+// TestSSAPrograms puts every function of the test programs into SSA
+// form, checks it, propagates constants, checks it again, and takes it
+// back out, and then checks that the programs still do the same thing.
+func TestSSAPrograms(t *testing.T) {
+	files, err := filepath.Glob("../tests/*.go")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test programs: %v", err)
+	}
+	for _, file := range files {
+		want := run(t, lowerFile(t, file))
+		pkgs := lowerFile(t, file)
+		for _, p := range pkgs {
+			for _, f := range p.Funcs {
+				g := ir.NewCFG(f)
+				g.ToSSA()
+				if err := g.VerifySSA(); err != nil {
+					t.Errorf("%s: %s", file, err)
+					continue
+				}
+				g.SCCP()
+				if err := g.VerifySSA(); err != nil {
+					t.Errorf("%s: after SCCP: %s", file, err)
+					continue
+				}
+				g.FromSSA()
+				f.Code = g.Code()
+				for _, in := range f.Code {
+					if _, ok := in.(*ir.Phi); ok {
+						t.Errorf("%s: %s: phi left after FromSSA: %s", file, f.Name, in)
+					}
+				}
+			}
+		}
+		if got := run(t, pkgs); got != want {
+			t.Errorf("%s: optimized, it prints\n%s\nwant\n%s", file, got, want)
+		}
+	}
+}
+
+// diamond returns a function that assigns x on both arms of an if, and
+// returns it.
+func diamond() *ir.Func {
+	p := &ir.Var{Name: "p"}
+	x := &ir.Var{Name: "x"}
+	els, done := &ir.Label{Name: "else"}, &ir.Label{Name: "done"}
+	return &ir.Func{
+		Name:    "diamond",
+		Params:  []*ir.Var{p},
+		Results: 1,
+		Locals:  []*ir.Var{x},
+		Code: []ir.Instr{
+			&ir.IfZ{Cond: p, Label: els},
+			&ir.Assign{Dst: x, X: ir.Const{Val: 1}},
+			&ir.Goto{Label: done},
+			els,
+			&ir.Assign{Dst: x, Op: "+", X: p, Y: ir.Const{Val: 2}, Type: ir.Int32},
+			done,
+			&ir.Return{Vals: []ir.Value{x}},
+		},
+	}
+}
+
+func TestToSSAPlacesPhi(t *testing.T) {
+	g := ir.NewCFG(diamond())
+	g.ToSSA()
+	if err := g.VerifySSA(); err != nil {
+		t.Fatal(err)
+	}
+	last := g.Blocks[len(g.Blocks)-1]
+	phi, ok := last.Instrs[0].(*ir.Phi)
+	if !ok {
+		t.Fatalf("%s starts with %s, want a phi", last, last.Instrs[0])
+	}
+	ret := last.Instrs[1].(*ir.Return)
+	if ret.Vals[0] != ir.Value(phi.Dst) {
+		t.Errorf("return uses %s, want the phi's %s", ret.Vals[0], phi.Dst)
+	}
+	if phi.Args[0] == phi.Args[1] {
+		t.Errorf("the phi's arguments are both %s", phi.Args[0])
+	}
+}
+
+func TestVerifySSA(t *testing.T) {
+	tests := []struct {
+		name   string
+		mangle func(g *ir.CFG)
+		err    string
+	}{
+		{"assigned twice", func(g *ir.CFG) {
+			b := g.Blocks[1]
+			a := b.Instrs[0].(*ir.Assign)
+			b.Instrs = append([]ir.Instr{&ir.Assign{Dst: a.Dst, X: ir.Const{Val: 3}}}, b.Instrs...)
+		}, "is assigned more than once"},
+		{"never assigned", func(g *ir.CFG) {
+			last := g.Blocks[len(g.Blocks)-1]
+			last.Last().(*ir.Return).Vals[0] = &ir.Var{Name: "z"}
+		}, "z is never assigned"},
+		{"phi argument from the other arm", func(g *ir.CFG) {
+			phi := g.Blocks[len(g.Blocks)-1].Instrs[0].(*ir.Phi)
+			phi.Args[0], phi.Args[1] = phi.Args[1], phi.Args[0]
+		}, "isn't assigned on the way from"},
+		{"phi arguments", func(g *ir.CFG) {
+			phi := g.Blocks[len(g.Blocks)-1].Instrs[0].(*ir.Phi)
+			phi.Args = phi.Args[:1]
+		}, "has 1 arguments for 2 predecessors"},
+		{"use before assignment", func(g *ir.CFG) {
+			b := g.Blocks[1]
+			a := b.Instrs[0].(*ir.Assign)
+			b.Instrs = append([]ir.Instr{&ir.Assign{Dst: &ir.Var{Name: "y"}, X: a.Dst}}, b.Instrs...)
+		}, "is used before it's assigned"},
+		{"phi after other instructions", func(g *ir.CFG) {
+			last := g.Blocks[len(g.Blocks)-1]
+			last.Instrs[0], last.Instrs[1] = last.Instrs[1], last.Instrs[0]
+		}, "phi after other instructions"},
+	}
+	for _, test := range tests {
+		g := ir.NewCFG(diamond())
+		g.ToSSA()
+		test.mangle(g)
+		err := g.VerifySSA()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: VerifySSA gave %v, want %q", test.name, err, test.err)
+		}
+	}
+}
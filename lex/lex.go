@@ -20,6 +20,25 @@ type TokenType int
 type Token struct {
 	Typ TokenType
 	Val string
+	Pos Pos
+}
+
+// Pos is the position of a token in its file. Lines and columns start
+// at 1, and columns count bytes. The zero Pos is not a valid position.
+type Pos struct {
+	Line int
+	Col  int
+}
+
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
 }
 
 // for debugging purposes
@@ -47,6 +66,8 @@ func (i TokenType) String() string {
 	case Identifier: return "Identifier"
 	case String:    return "String"
 	case Int:       return  "Int"
+	case Float:     return "Float"
+	case Rune:      return "Rune"
 	}
 	return "Whoops"
 }
@@ -61,6 +82,11 @@ type lexer struct {
 	// Error tokens are not stored.
 	lastToken *Token
 	Tokens    chan Token // channel of scanned Tokens
+	// line and lineStart are the line number and offset of the line
+	// holding offset scanned, for working out positions.
+	line      int
+	lineStart int
+	scanned   int
 }
 
 func isKeyword(val string) bool {
@@ -77,6 +103,7 @@ func Lex(name, input string) (*lexer, chan Token) {
 		name:   name,
 		input:  input,
 		Tokens: make(chan Token),
+		line:   1,
 	}
 	go l.run()
 	return l, l.Tokens
@@ -149,29 +176,49 @@ func (l *lexer) ignore() {
 	l.start = l.pos
 }
 
+// position returns the position of the byte at offset off. Tokens are
+// emitted in order, so off never goes backwards.
+func (l *lexer) position(off int) Pos {
+	for ; l.scanned < off; l.scanned++ {
+		if l.input[l.scanned] == '\n' {
+			l.line++
+			l.lineStart = l.scanned + 1
+		}
+	}
+	return Pos{Line: l.line, Col: off - l.lineStart + 1}
+}
+
 func (l *lexer) emit(t TokenType) {
 	v := l.input[l.start:l.pos]
+	off := l.start
+	if t == String || t == Rune {
+		// the opening quote was ignored, but the literal starts there
+		off--
+	}
 	l.start = l.pos
-	l.lastToken = &Token{Typ: t, Val: v}
+	l.lastToken = &Token{Typ: t, Val: v, Pos: l.position(off)}
 	l.Tokens <- *l.lastToken
 }
 
 func (l *lexer) emitErrorf(format string, a ...interface{}) {
-	l.Tokens <- Token{Typ: Error, Val: fmt.Sprintf(format, a)}
+	l.Tokens <- Token{Typ: Error, Val: fmt.Sprintf(format, a...), Pos: l.position(l.start)}
 }
 
 func (l *lexer) emitError(a ...interface{}) {
-	l.Tokens <- Token{Typ: Error, Val: fmt.Sprint(a)}
+	l.Tokens <- Token{Typ: Error, Val: fmt.Sprint(a...), Pos: l.position(l.start)}
 }
 
 func (l *lexer) emitEof() {
-	l.Tokens <- Token{Typ: EOF}
+	l.Tokens <- Token{Typ: EOF, Pos: l.position(l.start)}
 }
 
+// emitSemicolon emits an automatically inserted semicolon, at the
+// position of the newline (or EOF) that caused it.
 func (l *lexer) emitSemicolon() {
+	pos := l.position(l.start)
 	l.start = l.pos
-	l.lastToken = &Token{Typ: OpOrDelim, Val: ";"}
-	l.Tokens <- Token{Typ: OpOrDelim, Val: ";"}
+	l.lastToken = &Token{Typ: OpOrDelim, Val: ";", Pos: pos}
+	l.Tokens <- *l.lastToken
 }
 
 // peeks at the lexer's current value, without emitting it or changing
@@ -0,0 +1,38 @@
+package lex
+
+import "testing"
+
+func TestPositions(t *testing.T) {
+	src := "package main\n\nvar x = 'a' + \"bc\"\nvar y = '\\n'\n"
+	want := []Token{
+		{Keyword, "package", Pos{1, 1}},
+		{Identifier, "main", Pos{1, 9}},
+		{OpOrDelim, ";", Pos{1, 13}},
+		{Keyword, "var", Pos{3, 1}},
+		{Identifier, "x", Pos{3, 5}},
+		{OpOrDelim, "=", Pos{3, 7}},
+		{Rune, "a", Pos{3, 9}},
+		{OpOrDelim, "+", Pos{3, 13}},
+		{String, "bc", Pos{3, 15}},
+		{OpOrDelim, ";", Pos{3, 19}},
+		{Keyword, "var", Pos{4, 1}},
+		{Identifier, "y", Pos{4, 5}},
+		{OpOrDelim, "=", Pos{4, 7}},
+		{Rune, `\n`, Pos{4, 9}},
+		{OpOrDelim, ";", Pos{4, 13}},
+		{EOF, "", Pos{5, 1}},
+	}
+	_, tokens := Lex("test.go", src)
+	var got []Token
+	for tok := range tokens {
+		got = append(got, tok)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d tokens %v, want %d", len(got), got, len(want))
+	}
+	for i, tok := range got {
+		if tok != want[i] {
+			t.Errorf("token %d is %v at %s, want %v at %s", i, tok, tok.Pos, want[i], want[i].Pos)
+		}
+	}
+}
@@ -16,6 +16,8 @@ const (
 	Identifier
 	String
 	Int
+	Float
+	Rune
 )
 
 const (
@@ -26,6 +28,7 @@ const (
 	whitespaceSansNewline = space + tab
 	whitespace            = whitespaceSansNewline + newline
 	quote                 = "\""
+	singleQuote           = "'"
 	backslash             = "\\"
 	comment               = "//"
 	alphaLower            = "abcdefghijklmnopqrstuvwxyz"
@@ -34,6 +37,10 @@ const (
 	letter                = alpha + "_"
 	numSansZero           = "123456789"
 	num                   = numSansZero + "0"
+	octal                 = "01234567"
+	hex                   = num + "abcdefABCDEF"
+	exponent              = "eE"
+	sign                  = "+-"
 	alphaNum              = alpha + num
 	letterNum             = letter + num
 )
@@ -53,11 +60,19 @@ func lexStart(l *lexer) stateFn {
 		l.backup()
 		return lexLetter
 	}
-	if l.accept(numSansZero) {
+	if l.accept(num) {
+		l.backup()
+		return lexNumber
+	}
+	// .5 is a float, but . on its own is a selector
+	if strings.HasPrefix(l.input[l.pos:], ".") && len(l.input) > l.pos+1 &&
+		strings.IndexByte(num, l.input[l.pos+1]) >= 0 {
+		return lexNumber
+	}
+	if l.accept(singleQuote) {
 		l.backup()
-		return lexDecimal
+		return lexRune
 	}
-	// TODO rune literal
 	if l.accept(quote) {
 		l.backup()
 		return lexString
@@ -103,7 +118,7 @@ func semicolonRule(l *lexer) bool {
 		validSemicolonInsert = true
 	case Identifier:
 		validSemicolonInsert = true
-	case Int:
+	case Int, Float, Rune:
 		validSemicolonInsert = true
 	case String:
 		validSemicolonInsert = true
@@ -116,8 +131,8 @@ func semicolonRule(l *lexer) bool {
 
 func lexNewline(l *lexer) stateFn {
 	l.accept(newline)
-	l.ignore()
 	semicolonRule(l)
+	l.ignore()
 	l.lastToken = nil
 	return lexStart
 }
@@ -136,14 +151,62 @@ func lexLetter(l *lexer) stateFn {
 	return nil
 }
 
-func lexDecimal(l *lexer) stateFn {
-	if l.accept(num) {
-		l.acceptRun(num)
+// lexNumber scans an int_lit or a float_lit: 0x1f, 017, 42, 4.2,
+// .42 or 4e2.
+func lexNumber(l *lexer) stateFn {
+	if strings.HasPrefix(l.input[l.pos:], "0x") || strings.HasPrefix(l.input[l.pos:], "0X") {
+		l.pos += 2
+		if !l.accept(hex) {
+			l.emitError("hexadecimal literal has no digits")
+			return nil
+		}
+		l.acceptRun(hex)
 		l.emit(Int)
 		return lexStart
 	}
-	l.emitError("expected integer")
-	return nil
+	l.acceptRun(num)
+	typ := Int
+	if l.accept(".") {
+		typ = Float
+		l.acceptRun(num)
+	}
+	if l.accept(exponent) {
+		typ = Float
+		l.accept(sign)
+		if !l.accept(num) {
+			l.emitError("exponent has no digits")
+			return nil
+		}
+		l.acceptRun(num)
+	}
+	if v := l.val(); typ == Int && v[0] == '0' && strings.Trim(v, octal) != "" {
+		l.emitErrorf("invalid digit in octal literal %s", v)
+		return nil
+	}
+	l.emit(typ)
+	return lexStart
+}
+
+// lexRune scans a rune literal, like 'a' or '\n'. Like strings, the
+// token's value doesn't contain the quotes.
+func lexRune(l *lexer) stateFn {
+	l.accept(singleQuote)
+	l.ignore()
+	for {
+		switch l.next() {
+		case '\\':
+			l.next()
+		case '\'':
+			l.backup()
+			l.emit(Rune)
+			l.next()
+			l.ignore()
+			return lexStart
+		case '\n', eof:
+			l.emitError("rune literal not terminated")
+			return nil
+		}
+	}
 }
 
 func lexString(l *lexer) stateFn {
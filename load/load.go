@@ -0,0 +1,223 @@
+// Package load finds the files of a package and of everything it
+// imports, parses them, and compiles the packages to IR in dependency
+// order.
+//
+// Imports are looked up in a GOPATH-like source root: the package with
+// the import path "a/b" lives in the directory Root/src/a/b. Every .mo
+// and .go file in a package's directory belongs to the package.
+package load
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/samertm/chompy/ir"
+	"github.com/samertm/chompy/lex"
+	"github.com/samertm/chompy/parse"
+	"github.com/samertm/chompy/semantic"
+	"github.com/samertm/chompy/semantic/stable"
+)
+
+// Package is a parsed package that hasn't been checked yet.
+type Package struct {
+	Path  string // import path, or "main" for the package being built
+	Dir   string
+	Files []*parse.Tree
+	// Names of the files, in the same order as Files.
+	Filenames []string
+	// Imports holds the import paths of every file, sorted, without
+	// duplicates.
+	Imports []string
+}
+
+type Config struct {
+	// Root is the source root. Imports are found in Root/src.
+	Root string
+}
+
+// Load loads the package named by target, which is either a single
+// file or a directory, and every package that it imports. The packages
+// are returned in dependency order: each package comes after all of the
+// packages that it imports, and target's package comes last.
+func (c *Config) Load(target string) ([]*Package, error) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	var main *Package
+	if info.IsDir() {
+		main, err = loadDir("main", target)
+	} else {
+		main, err = loadFiles("main", filepath.Dir(target), []string{target})
+	}
+	if err != nil {
+		return nil, err
+	}
+	l := &loader{
+		config: c,
+		pkgs:   map[string]*Package{"main": main},
+		state:  make(map[string]int),
+	}
+	if err := l.visit(main, nil); err != nil {
+		return nil, err
+	}
+	return l.order, nil
+}
+
+// states for loader.visit
+const (
+	unvisited = iota
+	visiting
+	visited
+)
+
+type loader struct {
+	config *Config
+	pkgs   map[string]*Package
+	state  map[string]int
+	// packages in dependency order
+	order []*Package
+}
+
+// visit loads all of the imports of p (recursively) before adding p to
+// l.order. stack holds the import paths that led to p, for reporting
+// import cycles.
+func (l *loader) visit(p *Package, stack []string) error {
+	stack = append(stack, p.Path)
+	l.state[p.Path] = visiting
+	for _, path := range p.Imports {
+		switch l.state[path] {
+		case visited:
+			continue
+		case visiting:
+			return fmt.Errorf("import cycle not allowed: %s",
+				strings.Join(append(cycle(stack, path), path), " -> "))
+		}
+		dep, err := l.importPkg(path)
+		if err != nil {
+			return err
+		}
+		if err := l.visit(dep, stack); err != nil {
+			return err
+		}
+	}
+	l.state[p.Path] = visited
+	l.order = append(l.order, p)
+	return nil
+}
+
+// cycle returns the part of stack that starts at path.
+func cycle(stack []string, path string) []string {
+	for i, s := range stack {
+		if s == path {
+			return stack[i:]
+		}
+	}
+	return stack
+}
+
+// importPkg loads the package with the import path path from the
+// source root.
+func (l *loader) importPkg(path string) (*Package, error) {
+	if p, ok := l.pkgs[path]; ok {
+		return p, nil
+	}
+	if path == "main" {
+		return nil, fmt.Errorf("import \"main\" is a program, not an importable package")
+	}
+	dir := filepath.Join(l.config.Root, "src", filepath.FromSlash(path))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("cannot find package %q in %s", path, dir)
+	}
+	p, err := loadDir(path, dir)
+	if err != nil {
+		return nil, err
+	}
+	l.pkgs[path] = p
+	return p, nil
+}
+
+// isSource reports whether the file name holds chompy source.
+func isSource(name string) bool {
+	return strings.HasSuffix(name, ".mo") || strings.HasSuffix(name, ".go")
+}
+
+func loadDir(path, dir string) (*Package, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() || !isSource(info.Name()) {
+			continue
+		}
+		names = append(names, filepath.Join(dir, info.Name()))
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no source files in %s", dir)
+	}
+	return loadFiles(path, dir, names)
+}
+
+func loadFiles(path, dir string, names []string) (*Package, error) {
+	p := &Package{Path: path, Dir: dir}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		t, err := parseFile(name)
+		if err != nil {
+			return nil, err
+		}
+		p.Files = append(p.Files, t)
+		p.Filenames = append(p.Filenames, name)
+		for _, kid := range t.Kids {
+			impts, ok := kid.(*parse.Impts)
+			if !ok {
+				continue
+			}
+			for _, i := range impts.Imports {
+				if !seen[i.ImptName] {
+					seen[i.ImptName] = true
+					p.Imports = append(p.Imports, i.ImptName)
+				}
+			}
+		}
+	}
+	sort.Strings(p.Imports)
+	return p, nil
+}
+
+func parseFile(name string) (*parse.Tree, error) {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	_, tokens := lex.Lex(name, string(src))
+	n, err := parse.Start(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	t := n.(*parse.Tree)
+	t.Name = name
+	return t, nil
+}
+
+// Compile checks pkgs, which must be in dependency order (as returned
+// by Load), and lowers them to IR, in the same order.
+func Compile(pkgs []*Package) ([]*ir.Package, error) {
+	var irs []*ir.Package
+	checked := make(map[string]*stable.Pkg)
+	for _, p := range pkgs {
+		ip, sp, err := semantic.Gen(p.Path, p.Files, checked)
+		if err != nil {
+			return nil, err
+		}
+		checked[p.Path] = sp
+		irs = append(irs, ip)
+	}
+	return irs, nil
+}
@@ -0,0 +1,100 @@
+package load
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree writes files, which maps slash-separated paths under root to
+// their contents, and returns root.
+func writeTree(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, src := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// paths returns the import paths of pkgs.
+func paths(pkgs []*Package) string {
+	var s []string
+	for _, p := range pkgs {
+		s = append(s, p.Path)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestLoadMergesFiles(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"prog/main.go":   "package main\n\nfunc main() {\n\tprintln(twice(limit))\n}\n",
+		"prog/twice.mo":  "package main\n\nconst limit = 3\n\nfunc twice(x int) int {\n\treturn x * 2\n}\n",
+		"prog/notes.txt": "not source\n",
+	})
+	c := &Config{Root: root}
+	pkgs, err := c.Load(filepath.Join(root, "prog"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || len(pkgs[0].Files) != 2 {
+		t.Fatalf("loaded %d packages, the last with %d files, want 1 with 2", len(pkgs), len(pkgs[len(pkgs)-1].Files))
+	}
+	// the files share a scope, so each can use what the other declares
+	if _, err := Compile(pkgs); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadMissingImport(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"main.go": "package main\n\nimport (\n\t\"nowhere\"\n)\n\nfunc main() {\n}\n",
+	})
+	c := &Config{Root: root}
+	_, err := c.Load(filepath.Join(root, "main.go"))
+	if err == nil || !strings.Contains(err.Error(), `cannot find package "nowhere"`) {
+		t.Errorf("got %v, want an error about nowhere", err)
+	}
+}
+
+func TestLoadCycle(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"main.go":    "package main\n\nimport (\n\t\"a\"\n)\n\nfunc main() {\n}\n",
+		"src/a/a.go": "package a\n\nimport (\n\t\"b\"\n)\n",
+		"src/b/b.go": "package b\n\nimport (\n\t\"a\"\n)\n",
+	})
+	c := &Config{Root: root}
+	_, err := c.Load(filepath.Join(root, "main.go"))
+	if err == nil || err.Error() != "import cycle not allowed: a -> b -> a" {
+		t.Errorf("got %v, want the cycle a -> b -> a", err)
+	}
+}
+
+func TestLoadOrder(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"main.go":      "package main\n\nimport (\n\t\"c\"\n\t\"a\"\n)\n\nfunc main() {\n\tprintln(a.Two, c.Four)\n}\n",
+		"src/a/a.go":   "package a\n\nimport (\n\t\"b\"\n)\n\nconst Two = b.One + 1\n",
+		"src/b/b.go":   "package b\n\nconst One = 1\n",
+		"src/c/c.go":   "package c\n\nimport (\n\t\"b\"\n\t\"d/e\"\n)\n\nconst Four = b.One + e.Three\n",
+		"src/d/e/e.go": "package e\n\nconst Three = 3\n",
+	})
+	c := &Config{Root: root}
+	pkgs, err := c.Load(filepath.Join(root, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each package comes after its imports, which are visited in
+	// sorted order
+	if got, want := paths(pkgs), "b a d/e c main"; got != want {
+		t.Errorf("packages are in the order %s, want %s", got, want)
+	}
+	if _, err := Compile(pkgs); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,47 +1,246 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/samertm/chompy/arm"
+	"github.com/samertm/chompy/dump"
+	"github.com/samertm/chompy/interp"
+	"github.com/samertm/chompy/ir"
 	"github.com/samertm/chompy/lex"
+	"github.com/samertm/chompy/load"
 	"github.com/samertm/chompy/parse"
-	"github.com/samertm/chompy/semantic"
+	"github.com/samertm/chompy/printer"
 )
 
 var _ = fmt.Print // debugging
 
+var root = flag.String("root", defaultRoot(), "source root; imports are found in root/src")
+
+var dumpMode = flag.String("dump", "", "instead of compiling, write the `tokens` or the `ast` of each file as JSON, or the ir of the package and its imports, in ssa form, or their cfg as Graphviz DOT")
+
+// defaultRoot is $CHOMPYROOT, or the current directory.
+func defaultRoot() string {
+	if r := os.Getenv("CHOMPYROOT"); r != "" {
+		return r
+	}
+	return "."
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Expected filename")
-		return
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fail("Expected filename or directory")
+	}
+	if flag.Arg(0) == "fmt" {
+		status := 0
+		for _, target := range flag.Args()[1:] {
+			if err := format(target); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = 1
+			}
+		}
+		os.Exit(status)
+	}
+	if flag.Arg(0) == "run" {
+		if flag.NArg() < 2 {
+			fail("Expected filename or directory")
+		}
+		os.Exit(run(flag.Arg(1)))
+	}
+	switch *dumpMode {
+	case "":
+		compile(flag.Arg(0))
+	case "ir":
+		check(dumpIR(flag.Arg(0)))
+	case "ssa":
+		check(dumpSSA(flag.Arg(0)))
+	case "cfg":
+		check(dumpCFG(flag.Arg(0)))
+	default:
+		status := 0
+		for _, target := range flag.Args() {
+			if err := dumpFile(target); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = 1
+			}
+		}
+		os.Exit(status)
+	}
+}
+
+// fail prints the error err to standard error, and exits with status 1.
+func fail(err interface{}) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// check fails if err isn't nil.
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func dumpFile(name string) error {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	_, tokens := lex.Lex(name, string(src))
+	switch *dumpMode {
+	case "tokens":
+		return dump.Tokens(os.Stdout, name, tokens)
+	case "ast":
+		t, err := parse.Start(tokens)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		return dump.AST(os.Stdout, name, t)
+	}
+	return fmt.Errorf("unknown -dump mode %q; expected tokens, ast, ir, ssa or cfg", *dumpMode)
+}
+
+// format rewrites target, a file or a directory of source files, in
+// canonical form.
+func format(target string) error {
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return formatFile(target, info.Mode())
+	}
+	infos, err := ioutil.ReadDir(target)
+	if err != nil {
+		return err
+	}
+	for _, i := range infos {
+		if i.IsDir() || !(strings.HasSuffix(i.Name(), ".mo") || strings.HasSuffix(i.Name(), ".go")) {
+			continue
+		}
+		if err := formatFile(filepath.Join(target, i.Name()), i.Mode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFile only writes the file back if formatting changed it.
+func formatFile(name string, mode os.FileMode) error {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	out, err := printer.Format(name, src)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(src, out) {
+		return nil
+	}
+	return ioutil.WriteFile(name, out, mode)
+}
+
+// compile writes the ARM assembly for the program target to standard
+// output. It exits with status 1 if the program doesn't compile.
+func compile(target string) {
+	irs, err := lower(target)
+	check(err)
+	for _, p := range irs {
+		os.Stdout.Write(arm.Gen(p))
+	}
+}
+
+// run interprets the program target, and returns its exit status.
+func run(target string) int {
+	irs, err := lower(target)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	status, err := interp.Run(irs, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
-	filename := os.Args[1]
-	file, err := os.Open(filename)
+	return status
+}
+
+// dumpIR prints the IR of the package target and of every package it
+// imports.
+func dumpIR(target string) error {
+	irs, err := lower(target)
+	if err != nil {
+		return err
+	}
+	for i, p := range irs {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(p)
+	}
+	return nil
+}
+
+// dumpSSA prints the IR of the package target and of every package it
+// imports in SSA form, block by block.
+func dumpSSA(target string) error {
+	irs, err := lowerUnoptimized(target)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
+	}
+	for i, p := range irs {
+		for j, f := range p.Funcs {
+			if i > 0 || j > 0 {
+				fmt.Println()
+			}
+			g := ir.NewCFG(f)
+			g.ToSSA()
+			fmt.Print(g)
+		}
 	}
-	source, err := ioutil.ReadAll(file)
+	return nil
+}
+
+// dumpCFG prints the control flow graphs of the functions of the
+// package target and of every package it imports, as Graphviz DOT. The
+// graphs are the ones that lowering makes, before any optimizations.
+func dumpCFG(target string) error {
+	irs, err := lowerUnoptimized(target)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
-	compile(source)
+	return ir.WriteDOT(os.Stdout, irs)
 }
 
-func compile(src []byte) {
-	_, tokens := lex.Lex("bro", string(src))
-	tree, err := parse.Start(tokens)
+// lower loads, checks, lowers and optimizes the package target and the
+// packages it imports.
+func lower(target string) ([]*ir.Package, error) {
+	irs, err := lowerUnoptimized(target)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return nil, err
 	}
-	code, err := semantic.Gen(tree)
+	for _, p := range irs {
+		if err := ir.Optimize(p); err != nil {
+			return nil, err
+		}
+	}
+	return irs, nil
+}
+
+// lowerUnoptimized is lower without the optimizations.
+func lowerUnoptimized(target string) ([]*ir.Package, error) {
+	c := &load.Config{Root: *root}
+	pkgs, err := c.Load(target)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return nil, err
 	}
-	fmt.Print(string(code))
+	return load.Compile(pkgs)
 }
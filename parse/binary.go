@@ -0,0 +1,99 @@
+package parse
+
+// The grammar in grammar.txt has no operator precedence, so the parser
+// produces every Expr as a flat list: Expression = UnaryExpr
+// { binary_op UnaryExpr }, with each Expr holding the operator that
+// follows its UnaryExpr. Binary groups the list by precedence.
+
+// BinaryE is a binary expression. It isn't produced by the parser, only
+// by Expr.Binary. X and Y are *UnaryE or *BinaryE.
+type BinaryE struct {
+	Op string
+	X  Node
+	Y  Node
+	up Node
+}
+
+func (b *BinaryE) Up() Node {
+	return b.up
+}
+
+func (b *BinaryE) SetUp(n Node) {
+	b.up = n
+}
+
+func (b *BinaryE) String() (s string) {
+	s += "binary_op: " + b.Op + "\n"
+	s += b.X.String()
+	s += b.Y.String()
+	return
+}
+
+// Precedence returns the precedence of the binary operator op, from 1
+// (||) to 5 (the mul_ops), or 0 if op isn't a binary operator.
+func Precedence(op string) int {
+	switch op {
+	case "||":
+		return 1
+	case "&&":
+		return 2
+	case "==", "!=", "<", "<=", ">", ">=":
+		return 3
+	case "+", "-", "|", "^":
+		return 4
+	case "*", "/", "%", "<<", ">>", "&", "&^":
+		return 5
+	}
+	return 0
+}
+
+// Binary returns e grouped by operator precedence, with operators of
+// the same precedence grouping to the left. The result is e.FirstN if
+// there aren't any binary operators. The UnaryEs in the result are the
+// ones in e, so their parents are still Exprs.
+//
+// The result is built once and then reused, so that the BinaryEs can
+// be used as map keys. Changes made to e after the first call aren't
+// seen.
+func (e *Expr) Binary() Node {
+	if e.bin == nil {
+		e.bin = e.binary()
+	}
+	return e.bin
+}
+
+func (e *Expr) binary() Node {
+	var operands []Node
+	var ops []string
+	for ex := e; ex != nil; ex = ex.SecondN {
+		operands = append(operands, ex.FirstN)
+		if ex.SecondN != nil {
+			ops = append(ops, ex.BinOp)
+		}
+	}
+	b := &binaryBuilder{operands: operands, ops: ops}
+	return b.parse(1)
+}
+
+// binaryBuilder does precedence climbing over the flattened operands
+// and operators of an Expr.
+type binaryBuilder struct {
+	operands []Node
+	ops      []string
+	pos      int // index of the next operand
+}
+
+func (b *binaryBuilder) parse(minPrec int) Node {
+	x := b.operands[b.pos]
+	b.pos++
+	for b.pos-1 < len(b.ops) {
+		op := b.ops[b.pos-1]
+		prec := Precedence(op)
+		if prec < minPrec {
+			break
+		}
+		y := b.parse(prec + 1)
+		x = &BinaryE{Op: op, X: x, Y: y}
+	}
+	return x
+}
@@ -14,4 +14,6 @@
 //    Every parsing function represents an element of the grammar from
 //    grammar.txt and maps directly to that file, except that the
 //    identifier starts with a lowercase letter.
+//  - walk.go: contains Walk, Inspect and Apply, which traverse (and
+//    rewrite) trees. Every node type in nodes.go must be handled there.
 package parse
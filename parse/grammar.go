@@ -14,6 +14,7 @@ func Start(toks chan lex.Token) (Node, error) {
 	if len(p.errs) != 0 {
 		return nil, p.errs
 	}
+	SetParents(t)
 	return t, nil
 }
 
@@ -69,7 +70,7 @@ func packageClause(p *parser) *Pkg {
 func packageName(p *parser) *Pkg {
 	t := p.next()
 	// should I sanity-check t?
-	return &Pkg{Name: t.Val}
+	return &Pkg{Name: t.Val, Pos: t.Pos}
 }
 
 // ImportDecl       = "import" ( ImportSpec | "(" { ImportSpec ";" } ")" ) .
@@ -104,7 +105,7 @@ func importDecl(p *parser) *Impts {
 
 // ImportSpec       = [ "." | PackageName ] ImportPath .
 func importSpec(p *parser) *Impt {
-	i := &Impt{}
+	i := &Impt{Pos: p.peek().Pos}
 	if p.accept(tokDot) {
 		p.next() // eat dot
 		i.PkgName = "."
@@ -216,7 +217,7 @@ func constSpec(p *parser) *Cnst {
 func identifierList(p *parser) []*Ident {
 	idnts := make([]*Ident, 0)
 	id := p.next() // first identifier
-	idnts = append(idnts, &Ident{Name: id.Val})
+	idnts = append(idnts, &Ident{Name: id.Val, Pos: id.Pos})
 	// look for form: "," identifier
 	for p.accept(tokComma) {
 		p.next() // throw away ","
@@ -225,7 +226,7 @@ func identifierList(p *parser) []*Ident {
 			return nil
 		}
 		id = p.next() // identifier
-		idnts = append(idnts, &Ident{Name: id.Val})
+		idnts = append(idnts, &Ident{Name: id.Val, Pos: id.Pos})
 	}
 	return idnts
 }
@@ -275,6 +276,7 @@ func unaryExpr(p *parser) *UnaryE {
 	if p.accept(tokUnaryOp...) {
 		uOp := p.next() // grab unary operator
 		un.Op = uOp.Val
+		un.Pos = uOp.Pos
 		un.Expr = unaryExpr(p)
 		return un
 	}
@@ -296,16 +298,20 @@ func operand(p *parser) Node {
 
 // Literal    = BasicLit .
 func literal(p *parser) *Lit {
-	// BasicLit   = int_lit | string_lit .
+	// BasicLit   = int_lit | float_lit | rune_lit | string_lit .
 	if p.accept(topBasicLit...) {
 		l := p.next() // int_lit or string_lit
-		return &Lit{Typ: l.Typ.String(), Val: l.Val}
+		return &Lit{Typ: l.Typ.String(), Val: l.Val, Pos: l.Pos}
 	}
 	p.addError("Expected basic literal")
 	return nil
 }
 
 // OperandName = QualifiedIdent | identifier .
+// QualifiedIdent = PackageName "." identifier .
+// The parser can't tell a package name from any other identifier, so
+// "a.b" always comes out as a QualifiedIdent. The semantic package
+// turns it back into a Selector if "a" is not an import.
 func operandName(p *parser) *Ident {
 	id := p.next() // get identifier
 	if p.accept(tokDot) {
@@ -315,23 +321,34 @@ func operandName(p *parser) *Ident {
 		p.next() // eat "."
 		if p.accept(tokIdentifier) {
 			nextid := p.next() // get identifier
-			return &Ident{Pkg: id.Val, Name: nextid.Val}
+			p.unhookTracker()
+			return &Ident{Pkg: id.Val, Name: nextid.Val, Pos: id.Pos}
 		}
 		p.backtrack()
 		p.unhookTracker()
 	}
 	// fmt.Println("OPERAND NAME", id.Val)
-	return &Ident{Name: id.Val}
+	return &Ident{Name: id.Val, Pos: id.Pos}
 }
 
 // TODO: add more types [Issue: https://github.com/samertm/chompy/issues/9]
-// Type      = TypeName | "(" Type ")" .
+// Type      = TypeName | TypeLit | "(" Type ")" .
+// TypeLit   = SliceType | PointerType | MapType .
 func typeGrammar(p *parser) *Typ {
 	if p.accept(topTypeName) {
 		t := &Typ{}
 		t.T = typeName(p)
 		return t
 	}
+	if p.accept(topSliceType) {
+		return &Typ{T: sliceType(p)}
+	}
+	if p.accept(topPointerType) {
+		return &Typ{T: pointerType(p)}
+	}
+	if p.accept(topMapType) {
+		return &Typ{T: mapType(p)}
+	}
 	if p.accept(tokOpenParen) {
 		p.next() // eat "("
 		t := typeGrammar(p)
@@ -342,6 +359,69 @@ func typeGrammar(p *parser) *Typ {
 	return nil
 }
 
+// ambiguousType reports whether t could also be parsed as an
+// expression: a type name, or *T, which could be a dereference.
+func ambiguousType(t *Typ) bool {
+	switch t.T.(type) {
+	case *Ident, *PointerType:
+		return true
+	}
+	return false
+}
+
+// SliceType = "[" "]" ElementType .
+func sliceType(p *parser) *SliceType {
+	s := &SliceType{Pos: p.next().Pos} // eat "["
+	if err := p.expect(tokCloseSquareBrace); err != nil {
+		p.addError(err.Error())
+		return nil
+	}
+	p.next() // eat "]"
+	if !p.accept(topType...) {
+		p.addError("Expected element type")
+		return nil
+	}
+	s.Elem = typeGrammar(p)
+	return s
+}
+
+// PointerType = "*" BaseType .
+func pointerType(p *parser) *PointerType {
+	pt := &PointerType{Pos: p.next().Pos} // eat "*"
+	if !p.accept(topType...) {
+		p.addError("Expected base type")
+		return nil
+	}
+	pt.Elem = typeGrammar(p)
+	return pt
+}
+
+// MapType = "map" "[" KeyType "]" ElementType .
+func mapType(p *parser) *MapType {
+	m := &MapType{Pos: p.next().Pos} // eat "map"
+	if err := p.expect(tokOpenSquareBrace); err != nil {
+		p.addError(err.Error())
+		return nil
+	}
+	p.next() // eat "["
+	if !p.accept(topType...) {
+		p.addError("Expected key type")
+		return nil
+	}
+	m.Key = typeGrammar(p)
+	if err := p.expect(tokCloseSquareBrace); err != nil {
+		p.addError(err.Error())
+		return nil
+	}
+	p.next() // eat "]"
+	if !p.accept(topType...) {
+		p.addError("Expected element type")
+		return nil
+	}
+	m.Elem = typeGrammar(p)
+	return m
+}
+
 // TypeName  = identifier | QualifiedIdent .
 func typeName(p *parser) *Ident {
 	id := p.next() // ident
@@ -349,9 +429,9 @@ func typeName(p *parser) *Ident {
 		// is qualified ident
 		p.next()           // eat "."
 		nextid := p.next() // get identifier
-		return &Ident{Pkg: id.Val, Name: nextid.Val}
+		return &Ident{Pkg: id.Val, Name: nextid.Val, Pos: id.Pos}
 	}
-	return &Ident{Name: id.Val}
+	return &Ident{Name: id.Val, Pos: id.Pos}
 }
 
 // TypeDecl = "type" ( TypeSpec | "(" { TypeSpec ";" } ")" ) .
@@ -386,7 +466,8 @@ func typeDecl(p *parser) *Types {
 // TypeSpec     = identifier Type .
 func typeSpec(p *parser) *Typespec {
 	spec := &Typespec{}
-	spec.I = &Ident{Name: p.next().Val} // ident
+	id := p.next() // ident
+	spec.I = &Ident{Name: id.Val, Pos: id.Pos}
 	if !p.accept(topType...) {
 		p.addError("Expected type")
 		return nil
@@ -454,10 +535,19 @@ func varSpec(p *parser) *Varspec {
 }
 
 // ParameterDecl  = [ IdentifierList ] [ "..." ] Type .
-func parameterDecl(p *parser) *Param {
+// An identifier list that isn't followed by a type is a list of type
+// names, as in func(int, string), so there may be a Param for each.
+func parameterDecl(p *parser) []*Param {
 	par := &Param{}
 	if p.accept(topIdentifierList) {
 		par.Idents = identifierList(p)
+		if p.accept(tokComma) || p.accept(tokCloseParen) {
+			var ps []*Param
+			for _, id := range par.Idents {
+				ps = append(ps, &Param{Typ: &Typ{T: id}})
+			}
+			return ps
+		}
 	}
 	if p.accept(tokDotDotDot) {
 		par.DotDotDot = true
@@ -467,21 +557,21 @@ func parameterDecl(p *parser) *Param {
 		return nil
 	}
 	par.Typ = typeGrammar(p)
-	return par
+	return []*Param{par}
 }
 
 // ParameterList  = ParameterDecl { "," [ ParameterDecl ] } .
 // slightly modified from grammar.txt, so that it will grab a lone ","
 func parameterList(p *parser) []*Param {
 	ps := make([]*Param, 0)
-	ps = append(ps, parameterDecl(p))
+	ps = append(ps, parameterDecl(p)...)
 	for p.accept(tokComma) {
 		p.next() // eat ","
 		// makes ParameterDecl optional
 		if !p.accept(topParameterDecl) {
 			return ps
 		}
-		ps = append(ps, parameterDecl(p))
+		ps = append(ps, parameterDecl(p)...)
 	}
 	return ps
 }
@@ -558,8 +648,8 @@ func statementList(p *parser) []Node {
 
 // Block = "{" StatementList "}" .
 func block(p *parser) *Block {
-	p.next() // eat "{"
-	b := &Block{}
+	lbrace := p.next() // eat "{"
+	b := &Block{Pos: lbrace.Pos}
 	// I don't think I need this check, because I need to allow empty statements
 	// if !p.accept(topStatementList...) {
 	// p.addError("Expected statement list, found " + p.peek().String())
@@ -569,7 +659,7 @@ func block(p *parser) *Block {
 		p.addError(err.Error())
 		return nil
 	}
-	p.next() // eat "}"
+	b.Rbrace = p.next().Pos // eat "}"
 	return b
 }
 
@@ -602,13 +692,13 @@ func function(p *parser) *Func {
 // FunctionName = identifier .
 func functionName(p *parser) *Ident {
 	i := p.next() // grab ident
-	return &Ident{Name: i.Val}
+	return &Ident{Name: i.Val, Pos: i.Pos}
 }
 
 // FunctionDecl = "func" FunctionName Function .
 func functionDecl(p *parser) *Funcdecl {
-	p.next() // eat "func"
-	f := &Funcdecl{}
+	fn := p.next() // eat "func"
+	f := &Funcdecl{Pos: fn.Pos}
 	if err := p.expect(topFunctionName); err != nil {
 		p.addError(err.Error())
 		return nil
@@ -625,30 +715,30 @@ func functionDecl(p *parser) *Funcdecl {
 
 // DeferStmt = "defer" Expression .
 func deferStmt(p *parser) *DeferStmt {
-	p.next() // eat "defer"
+	d := p.next() // eat "defer"
 	if !p.accept(topExpression...) {
 		p.addError("deferStmt: Expected expression, recieved " + p.peek().String())
 		return nil
 	}
-	return &DeferStmt{Expr: expression(p)}
+	return &DeferStmt{Expr: expression(p), Pos: d.Pos}
 }
 
 // FallthroughStmt = "fallthrough" .
 func fallthroughStmt(p *parser) *Fallthrough {
-	p.next() // eat "fallthrough"
-	return &Fallthrough{}
+	f := p.next() // eat "fallthrough"
+	return &Fallthrough{Pos: f.Pos}
 }
 
 // GotoStmt = "goto" Label .
 func gotoStmt(p *parser) *GotoStmt {
-	p.next() // eat "goto"
-	return &GotoStmt{Label: label(p)}
+	g := p.next() // eat "goto"
+	return &GotoStmt{Label: label(p), Pos: g.Pos}
 }
 
 // ContinueStmt = "continue" [ Label ] .
 func continueStmt(p *parser) *ContinueStmt {
-	p.next() // eat "continue"
-	c := &ContinueStmt{}
+	t := p.next() // eat "continue"
+	c := &ContinueStmt{Pos: t.Pos}
 	if p.accept(topLabel) {
 		c.Label = label(p)
 	}
@@ -657,8 +747,8 @@ func continueStmt(p *parser) *ContinueStmt {
 
 // BreakStmt = "break" [ Label ] .
 func breakStmt(p *parser) *BreakStmt {
-	p.next() // eat "break"
-	b := &BreakStmt{}
+	t := p.next() // eat "break"
+	b := &BreakStmt{Pos: t.Pos}
 	if p.accept(topLabel) {
 		b.Label = label(p)
 	}
@@ -667,8 +757,8 @@ func breakStmt(p *parser) *BreakStmt {
 
 // ReturnStmt = "return" [ ExpressionList ] .
 func returnStmt(p *parser) *ReturnStmt {
-	p.next() // eat "return"
-	r := &ReturnStmt{}
+	t := p.next() // eat "return"
+	r := &ReturnStmt{Pos: t.Pos}
 	if p.accept(topExpressionList...) {
 		r.Exprs = expressionList(p)
 	}
@@ -677,8 +767,8 @@ func returnStmt(p *parser) *ReturnStmt {
 
 // GoStmt = "go" Expression .
 func goStmt(p *parser) *GoStmt {
-	p.next() // eat "go"
-	g := &GoStmt{}
+	t := p.next() // eat "go"
+	g := &GoStmt{Pos: t.Pos}
 	if !p.accept(topExpression...) {
 		p.addError("goStmt: Expected expression, recieved " + p.peek().String())
 		return nil
@@ -749,7 +839,7 @@ func rangeClause(p *parser) *RangeClause {
 	}
 	return &RangeClause{
 		Exprs: exprs,
-		Op:            ":=",
+		Op:            "=",
 		Expr:          expr,
 	}
 }
@@ -800,7 +890,7 @@ func condition(p *parser) Node {
 
 // ForStmt = "for" [ Condition | ForClause | RangeClause ] Block .
 func forStmt(p *parser) *ForStmt {
-	p.next() // eat "for"
+	f := p.next() // eat "for"
 	// see if it accepts no optional stmts
 	if !p.accept(topCondition...) &&
 		!p.accept(topForClause...) &&
@@ -809,20 +899,33 @@ func forStmt(p *parser) *ForStmt {
 			p.addError("forStmt: Expected block, recieved " + p.peek().String())
 			return nil
 		}
-		return &ForStmt{Clause: nil, Body: block(p)}
+		return &ForStmt{Clause: nil, Body: block(p), Pos: f.Pos}
 	}
-	// TODO: set up tracker, dumb stupid face >:O [Issue: https://github.com/samertm/chompy/issues/7]
+	// try each clause in turn, backtracking if it isn't followed by
+	// the block
 	var clause Node
+	p.hookTracker()
+	defer p.unhookTracker()
 	if p.accept(topCondition...) {
-		clause = condition(p)
+		c := condition(p)
+		if p.valid() && p.accept(topBlock) {
+			clause = c
+		} else {
+			p.backtrack()
+		}
 	}
-	if !p.valid() && p.accept(topForClause...) {
-		clause = forClause(p)
+	if clause == nil && p.accept(topForClause...) {
+		c := forClause(p)
+		if p.valid() && p.accept(topBlock) {
+			clause = c
+		} else {
+			p.backtrack()
+		}
 	}
-	if !p.valid() && p.accept(topRangeClause...) {
+	if clause == nil && p.accept(topRangeClause...) {
 		clause = rangeClause(p)
 	}
-	if !p.valid() {
+	if clause == nil || !p.valid() {
 		// maybe I should just attach this to ForStmt
 		p.addError("Invalid clause")
 		return nil
@@ -831,16 +934,16 @@ func forStmt(p *parser) *ForStmt {
 		p.addError("forStmt: Expected block, recieved " + p.peek().String())
 		return nil
 	}
-	return &ForStmt{Clause: clause, Body: block(p)}
+	return &ForStmt{Clause: clause, Body: block(p), Pos: f.Pos}
 }
 
 // IfStmt = "if" [ SimpleStmt ";" ] Expression Block [ "else" ( IfStmt | Block ) ] .
 func ifStmt(p *parser) *IfStmt {
-	p.next() // eat "if"
+	t := p.next() // eat "if"
 
 	p.hookTracker()
 
-	ifstmt := &IfStmt{}
+	ifstmt := &IfStmt{Pos: t.Pos}
 	// next expr may be simplestmt or expression
 
 	// check to see if it's a simple statement
@@ -876,6 +979,7 @@ out:
 	ifstmt.Body = block(p)
 	// else
 	if p.accept(tokElse) {
+		p.next() // eat "else"
 		var els Node
 		if p.accept(topIfStmt) {
 			els = ifStmt(p)
@@ -950,7 +1054,7 @@ func expressionStmt(p *parser) Node {
 // Label       = identifier .
 func label(p *parser) *Ident {
 	i := p.next() // grab ident
-	return &Ident{Name: i.Val}
+	return &Ident{Name: i.Val, Pos: i.Pos}
 }
 
 // LabeledStmt = Label ":" Statement .
@@ -1229,7 +1333,7 @@ func selector(p *parser) *Selector {
 		return nil
 	}
 	ident := p.next() // get identifier
-	s.Ident = &Ident{Name: ident.Val}
+	s.Ident = &Ident{Name: ident.Val, Pos: ident.Pos}
 	return s
 }
 
@@ -1328,17 +1432,17 @@ func primaryExpr(p *parser) *PrimaryE {
 		}
 		p.backtrack()
 	}
-	// if p.accept(topConversion...) {
-	// 	c := conversion(p)
-	// 	if p.valid() {
-	// 		e.Expr = c
-	// 		if p.accept(topPrimaryExprPrime...) {
-	// 			e.Prime = primaryExprPrime(p)
-	// 		}
-	// 		return e
-	// 	}
-	// 	p.backtrack()
-	// }
+	if p.accept(topConversion...) {
+		c := conversion(p)
+		if p.valid() {
+			e.Expr = c
+			if p.accept(topPrimaryExprPrime...) {
+				e.Prime = primaryExprPrime(p)
+			}
+			return e
+		}
+		p.backtrack()
+	}
 	if p.accept(topOperand...) {
 		o := operand(p)
 		if p.valid() {
@@ -1359,37 +1463,37 @@ func primaryExpr(p *parser) *PrimaryE {
 
 // BuiltinCall = identifier "(" [ BuiltinArgs [ "," ] ] ")" .
 // BuiltinArgs = Type [ "," ArgumentList ] | ArgumentList .
+//
+// Only calls whose first argument has to be a type are BuiltinCalls.
+// Every other call, including new(T) for a type name T, is parsed as
+// an Operand followed by a Call, and the checker decides whether the
+// identifier is a built-in.
 func builtinCall(p *parser) *Builtin {
 	b := &Builtin{}
 	i := p.next() // get identifier
-	b.Name = &Ident{Name: i.Val}
+	b.Name = &Ident{Name: i.Val, Pos: i.Pos}
 	if err := p.expect(tokOpenParen); err != nil {
 		p.addError(err.Error())
 		return nil
 	}
-	if p.accept(topBuiltinArgs...) {
-		// BuiltinArgs = Type [ "," ArgumentList ] | ArgumentList .
-		if p.accept(topType...) {
-			b.Typ = typeGrammar(p)
+	p.next() // eat "("
+	if !p.accept(topType...) {
+		p.addError("Expected type")
+		return nil
+	}
+	b.Typ = typeGrammar(p)
+	if b.Typ == nil || ambiguousType(b.Typ) {
+		p.addError("Expected type literal")
+		return nil
+	}
+	if p.accept(tokComma) {
+		p.next() // eat ","
+		if p.accept(topArgumentList...) {
+			b.Args = argumentList(p)
+			// accept comma
 			if p.accept(tokComma) {
 				p.next() // eat ","
-				if !p.accept(topArgumentList...) {
-					p.addError("Expected argument list")
-					return nil
-				}
-				b.Args = argumentList(p)
 			}
-		} else {
-			// argument list
-			if !p.accept(topArgumentList...) {
-				p.addError("Expected argument list")
-				return nil
-			}
-			b.Args = argumentList(p)
-		}
-		// accept comma
-		if p.accept(tokComma) {
-			p.next() // eat ","
 		}
 	}
 	if err := p.expect(tokCloseParen); err != nil {
@@ -1401,9 +1505,16 @@ func builtinCall(p *parser) *Builtin {
 }
 
 // Conversion = Type "(" Expression [ "," ] ")" .
+//
+// Conversions to types that could also be expressions, like T(x), are
+// parsed as calls, and the checker tells them apart.
 func conversion(p *parser) *Conversion {
 	c := &Conversion{}
 	c.Typ = typeGrammar(p)
+	if c.Typ == nil || ambiguousType(c.Typ) {
+		p.addError("Expected type literal")
+		return nil
+	}
 	if err := p.expect(tokOpenParen); err != nil {
 		p.addError(err.Error())
 		return nil
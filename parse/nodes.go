@@ -3,23 +3,27 @@ package parse
 import (
 	"fmt"
 
+	"github.com/samertm/chompy/lex"
 	"github.com/samertm/chompy/semantic/stable"
 )
 
 type Node interface {
 	String() string
 	// Added interface to make accessing the parent node more
-	// convenient.
+	// convenient. Start links up every node in the tree it returns,
+	// so Up only returns nil for the *Tree.
 	Up() Node
 	SetUp(Node)
-	// gets the immediate children (no grandchildren) of the Node
-	// used for walking the tree
-	// Children(chan<- Node)
+	// The children of a Node are visited with Walk, Inspect or
+	// Apply (see walk.go).
 }
 
 type grammarFn func(*parser) Node
 
 type Tree struct {
+	// Name is the name of the file that the tree was parsed from. It
+	// is set by whoever reads the file, and is used in errors.
+	Name       string
 	RootStable *stable.Stable
 	Kids       []Node
 	up         Node
@@ -48,6 +52,7 @@ func (t *Tree) String() (s string) {
 
 type Pkg struct {
 	Name string
+	Pos  lex.Pos
 	up   Node
 }
 
@@ -88,7 +93,11 @@ func (i *Impts) String() (s string) {
 type Impt struct {
 	PkgName  string
 	ImptName string
-	up       Node
+	// Info is filled in by the semantic package with the package
+	// name that the import declares. It's nil for blank imports.
+	Info *stable.NodeInfo
+	Pos  lex.Pos
+	up   Node
 }
 
 func (i *Impt) Up() Node {
@@ -105,16 +114,15 @@ func (i *Impt) String() string {
 
 type Erro struct {
 	Desc string
+	up   Node
 }
 
-// Up and SetUp are nops for the error type, because they get removed
-// in the first semantic pass, and it breaks too much of the grammar.
 func (e *Erro) Up() Node {
-	return nil
+	return e.up
 }
 
-// nop
 func (e *Erro) SetUp(n Node) {
+	e.up = n
 }
 
 func (e *Erro) String() string {
@@ -178,6 +186,7 @@ func (c *Cnst) String() (s string) {
 type Lit struct {
 	Typ string
 	Val string
+	Pos lex.Pos
 	up  Node
 }
 
@@ -199,6 +208,8 @@ type Expr struct {
 	FirstN  *UnaryE
 	SecondN *Expr
 	up      Node
+	// bin caches the result of Binary
+	bin Node
 }
 
 func (e *Expr) Up() Node {
@@ -225,6 +236,7 @@ func (e *Expr) String() (s string) {
 type UnaryE struct {
 	Op   string // Operand
 	Expr Node
+	Pos  lex.Pos // position of Op, if there is one
 	up   Node
 }
 
@@ -282,9 +294,68 @@ func (t *Typ) String() string {
 	return "type: " + t.T.String() + "\n"
 }
 
+type SliceType struct {
+	Pos  lex.Pos
+	Elem *Typ
+	up   Node
+}
+
+func (s *SliceType) Up() Node {
+	return s.up
+}
+
+func (s *SliceType) SetUp(n Node) {
+	s.up = n
+}
+
+func (s *SliceType) String() string {
+	return "slice of " + s.Elem.String()
+}
+
+type PointerType struct {
+	Pos  lex.Pos
+	Elem *Typ
+	up   Node
+}
+
+func (p *PointerType) Up() Node {
+	return p.up
+}
+
+func (p *PointerType) SetUp(n Node) {
+	p.up = n
+}
+
+func (p *PointerType) String() string {
+	return "pointer to " + p.Elem.String()
+}
+
+type MapType struct {
+	Pos  lex.Pos
+	Key  *Typ
+	Elem *Typ
+	up   Node
+}
+
+func (m *MapType) Up() Node {
+	return m.up
+}
+
+func (m *MapType) SetUp(n Node) {
+	m.up = n
+}
+
+func (m *MapType) String() string {
+	return "map key " + m.Key.String() + "map elem " + m.Elem.String()
+}
+
 type Ident struct {
 	Name string
 	Pkg  string
+	// Info is filled in by the semantic package with the
+	// declaration that the identifier refers to.
+	Info *stable.NodeInfo
+	Pos  lex.Pos
 	up   Node
 }
 
@@ -403,6 +474,7 @@ func (v *Varspec) String() (s string) {
 type Funcdecl struct {
 	Name *Ident //ident
 	Func *Func
+	Pos  lex.Pos
 	up   Node
 }
 
@@ -575,8 +647,10 @@ func (p *Param) String() (s string) {
 }
 
 type Block struct {
-	Stmts []Node
-	up    Node
+	Stmts  []Node
+	Pos    lex.Pos
+	Rbrace lex.Pos // position of the closing "}"
+	up     Node
 }
 
 func (b *Block) Up() Node {
@@ -701,6 +775,7 @@ type IfStmt struct {
 	Expr       *Expr
 	Body       *Block
 	Else       Node
+	Pos        lex.Pos
 	up         Node
 }
 
@@ -727,6 +802,7 @@ func (i *IfStmt) String() (s string) {
 type ForStmt struct {
 	Clause Node // ForClause or Condition
 	Body   *Block
+	Pos    lex.Pos
 	up     Node
 }
 
@@ -804,6 +880,7 @@ func (r *RangeClause) String() (s string) {
 
 type GoStmt struct {
 	Expr Node
+	Pos  lex.Pos
 	up   Node
 }
 
@@ -821,6 +898,7 @@ func (g *GoStmt) String() string {
 
 type ReturnStmt struct {
 	Exprs []*Expr
+	Pos   lex.Pos
 	up    Node
 }
 
@@ -843,6 +921,7 @@ func (r *ReturnStmt) String() (s string) {
 
 type BreakStmt struct {
 	Label *Ident
+	Pos   lex.Pos
 	up    Node
 }
 
@@ -865,6 +944,7 @@ func (b *BreakStmt) String() (s string) {
 
 type ContinueStmt struct {
 	Label *Ident
+	Pos   lex.Pos
 	up    Node
 }
 
@@ -887,6 +967,7 @@ func (c *ContinueStmt) String() (s string) {
 
 type GotoStmt struct {
 	Label *Ident
+	Pos   lex.Pos
 	up    Node
 }
 
@@ -903,7 +984,8 @@ func (g *GotoStmt) String() string {
 }
 
 type Fallthrough struct {
-	up Node
+	Pos lex.Pos
+	up  Node
 }
 
 func (f *Fallthrough) Up() Node {
@@ -920,6 +1002,7 @@ func (f *Fallthrough) String() string {
 
 type DeferStmt struct {
 	Expr Node
+	Pos  lex.Pos
 	up   Node
 }
 
@@ -961,13 +1044,16 @@ func (s *ShortVarDecl) String() (str string) {
 	return
 }
 
-type EmptyStmt struct{}
+type EmptyStmt struct {
+	up Node
+}
 
 func (e *EmptyStmt) Up() Node {
-	return nil
+	return e.up
 }
 
 func (e *EmptyStmt) SetUp(n Node) {
+	e.up = n
 }
 
 func (e *EmptyStmt) String() string {
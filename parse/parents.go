@@ -0,0 +1,55 @@
+package parse
+
+// SetParents points every node under n (but not n itself) at its
+// parent. Start calls it on every tree it returns; passes that build
+// new subtrees can call it on their roots.
+func SetParents(n Node) {
+	Apply(n, func(c *Cursor) bool {
+		if c.Parent() != nil {
+			c.Node().SetUp(c.Parent())
+		}
+		return true
+	}, nil)
+}
+
+// Enclosing follows the parent links up from n (not including n) and
+// returns the first node that match reports true for, or nil.
+func Enclosing(n Node, match func(Node) bool) Node {
+	for up := n.Up(); up != nil; up = up.Up() {
+		if match(up) {
+			return up
+		}
+	}
+	return nil
+}
+
+// EnclosingFunc returns the function that n is in, or nil.
+func EnclosingFunc(n Node) *Func {
+	f, _ := Enclosing(n, func(n Node) bool {
+		_, ok := n.(*Func)
+		return ok
+	}).(*Func)
+	return f
+}
+
+// EnclosingFor returns the innermost for statement that n is in,
+// stopping at function boundaries, or nil.
+func EnclosingFor(n Node) *ForStmt {
+	f, _ := Enclosing(n, func(n Node) bool {
+		switch n.(type) {
+		case *ForStmt, *Func:
+			return true
+		}
+		return false
+	}).(*ForStmt)
+	return f
+}
+
+// EnclosingBlock returns the innermost block that n is in, or nil.
+func EnclosingBlock(n Node) *Block {
+	b, _ := Enclosing(n, func(n Node) bool {
+		_, ok := n.(*Block)
+		return ok
+	}).(*Block)
+	return b
+}
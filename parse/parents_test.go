@@ -0,0 +1,123 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/samertm/chompy/lex"
+)
+
+const program = `package main
+
+import "other"
+
+var total int
+
+func add(a, b int) (int, bool) {
+	return a + b, a > b
+}
+
+func main() {
+	x := 0
+outer:
+	for i := 0; i < 10; i++ {
+		for {
+			if x > i {
+				continue outer
+			}
+			x, _ = add(x, i)
+			break
+		}
+	}
+	twice := x * 2
+	total = other.Twice(twice)
+	println(total)
+}
+`
+
+// parseSrc parses src, which must parse.
+func parseSrc(t *testing.T, src string) *Tree {
+	_, tokens := lex.Lex("test.go", src)
+	n, err := Start(tokens)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, src)
+	}
+	return n.(*Tree)
+}
+
+func TestParents(t *testing.T) {
+	tree := parseSrc(t, program)
+	if tree.Up() != nil {
+		t.Errorf("the tree has parent %v", tree.Up())
+	}
+	leaves := 0
+	Inspect(tree, func(n Node) bool {
+		if n == nil {
+			return false
+		}
+		kids := children(n)
+		for _, c := range kids {
+			if c.Up() != n {
+				t.Errorf("%T under %T has parent %T", c, n, c.Up())
+			}
+		}
+		if len(kids) != 0 {
+			return true
+		}
+		leaves++
+		// every leaf gets back to the tree
+		var last Node = n
+		for up := n.Up(); up != nil; up = up.Up() {
+			last = up
+		}
+		if last != Node(tree) {
+			t.Errorf("%T %v leads up to %T, not the tree", n, n, last)
+		}
+		return true
+	})
+	if leaves == 0 {
+		t.Error("no leaves")
+	}
+}
+
+func TestEnclosing(t *testing.T) {
+	tree := parseSrc(t, program)
+	var fors []*ForStmt
+	var cont *ContinueStmt
+	var ret *ReturnStmt
+	Inspect(tree, func(n Node) bool {
+		switch n := n.(type) {
+		case *ForStmt:
+			fors = append(fors, n)
+		case *ContinueStmt:
+			cont = n
+		case *ReturnStmt:
+			ret = n
+		}
+		return true
+	})
+	if len(fors) != 2 || cont == nil || ret == nil {
+		t.Fatalf("found %d for statements, continue %v and return %v", len(fors), cont, ret)
+	}
+	if f := EnclosingFor(cont); f != fors[1] {
+		t.Errorf("continue is in %v, want the inner loop", f)
+	}
+	if f := EnclosingFor(fors[1]); f != fors[0] {
+		t.Errorf("the inner loop is in %v, want the outer one", f)
+	}
+	if f := EnclosingFor(ret); f != nil {
+		t.Errorf("return is in loop %v", f)
+	}
+	mainFunc := EnclosingFunc(cont)
+	if mainFunc == nil || EnclosingFunc(ret) == mainFunc {
+		t.Errorf("continue is in %v and return in %v", mainFunc, EnclosingFunc(ret))
+	}
+	if b := EnclosingBlock(cont); b == nil || EnclosingFor(b) != fors[1] {
+		t.Errorf("continue is in block %v", b)
+	}
+	if d, ok := Enclosing(cont, func(n Node) bool {
+		_, ok := n.(*Funcdecl)
+		return ok
+	}).(*Funcdecl); !ok || d.Name.Name != "main" {
+		t.Errorf("continue is in %v, want main", d)
+	}
+}
@@ -20,6 +20,9 @@ type parser struct {
 	errs     pErrors
 	// Maps a tracker index to the earliest errors index.
 	trackerToErrors map[int]int
+	// position of the last token returned by next (or looked at
+	// by peek), for errors
+	pos lex.Pos
 }
 
 type pErrors []string
@@ -55,17 +58,19 @@ func (p *parser) next() *lex.Token {
 		if len(p.trackers) > 0 {
 			p.recordedTokens = append(p.recordedTokens, curr)
 		}
+		p.pos = curr.Pos
 		return curr
 	}
 	if t, ok := <-p.toks; ok {
 		curr := &t
 		if curr.Typ == lex.Error {
-			log.Fatal("error lexing: ", curr)
+			log.Fatal("error lexing: ", curr.Pos, ": ", curr)
 			return nil
 		}
 		if len(p.trackers) > 0 {
 			p.recordedTokens = append(p.recordedTokens, curr)
 		}
+		p.pos = curr.Pos
 		return curr
 	}
 	log.Fatal("token stream closed")
@@ -169,8 +174,10 @@ func (p *parser) expect(tok lex.Token) error {
 	return fmt.Errorf("expected %s recieved %s", tok.String(), p.peek().String())
 }
 
+// addError records e at the position of the last token that the
+// parser looked at.
 func (p *parser) addError(e string) {
-	p.errs = append(p.errs, e)
+	p.errs = append(p.errs, p.pos.String()+": "+e)
 	if len(p.trackers) != 0 {
 		i := len(p.trackers) - 1
 		if _, ok := p.trackerToErrors[i]; !ok {
@@ -0,0 +1,71 @@
+package parse
+
+import "github.com/samertm/chompy/lex"
+
+// Position returns the position of the start of n. Only leaves and
+// nodes that start with a keyword or operator record their own
+// position; for any other node, Position returns the position of its
+// first descendant that has one. The result is the zero lex.Pos if
+// nothing under n has a position.
+func Position(n Node) lex.Pos {
+	if isNil(n) {
+		return lex.Pos{}
+	}
+	if pos := ownPos(n); pos.IsValid() {
+		return pos
+	}
+	var pos lex.Pos
+	Inspect(n, func(n Node) bool {
+		if n == nil || pos.IsValid() {
+			return false
+		}
+		pos = ownPos(n)
+		return !pos.IsValid()
+	})
+	return pos
+}
+
+// ownPos returns the position recorded in n itself.
+func ownPos(n Node) lex.Pos {
+	switch n := n.(type) {
+	case *Pkg:
+		return n.Pos
+	case *Impt:
+		return n.Pos
+	case *Lit:
+		return n.Pos
+	case *UnaryE:
+		return n.Pos
+	case *Ident:
+		return n.Pos
+	case *Funcdecl:
+		return n.Pos
+	case *Block:
+		return n.Pos
+	case *IfStmt:
+		return n.Pos
+	case *ForStmt:
+		return n.Pos
+	case *GoStmt:
+		return n.Pos
+	case *ReturnStmt:
+		return n.Pos
+	case *BreakStmt:
+		return n.Pos
+	case *ContinueStmt:
+		return n.Pos
+	case *GotoStmt:
+		return n.Pos
+	case *Fallthrough:
+		return n.Pos
+	case *DeferStmt:
+		return n.Pos
+	case *SliceType:
+		return n.Pos
+	case *PointerType:
+		return n.Pos
+	case *MapType:
+		return n.Pos
+	}
+	return lex.Pos{}
+}
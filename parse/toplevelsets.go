@@ -10,6 +10,8 @@ var (
 	tokString           = lex.Token{Typ: lex.String}
 	tokIdentifier       = lex.Token{Typ: lex.Identifier}
 	tokInt              = lex.Token{Typ: lex.Int}
+	tokFloat            = lex.Token{Typ: lex.Float}
+	tokRune             = lex.Token{Typ: lex.Rune}
 	tokEOF              = lex.Token{Typ: lex.EOF}
 	tokIf               = lex.Token{Typ: lex.Keyword, Val: "if"}
 	tokElse             = lex.Token{Typ: lex.Keyword, Val: "else"}
@@ -76,8 +78,20 @@ var (
 		lex.Token{Typ: lex.OpOrDelim, Val: "||"},
 		lex.Token{Typ: lex.OpOrDelim, Val: "&&"},
 	}, tokMulOp...), tokAddOp...), tokRelOp...)
-	tokAssignOp = append(append([]lex.Token{
-		tokEqual}, tokAddOp...), tokMulOp...)
+	tokAssignOp = []lex.Token{
+		tokEqual,
+		lex.Token{Typ: lex.OpOrDelim, Val: "+="},
+		lex.Token{Typ: lex.OpOrDelim, Val: "-="},
+		lex.Token{Typ: lex.OpOrDelim, Val: "|="},
+		lex.Token{Typ: lex.OpOrDelim, Val: "^="},
+		lex.Token{Typ: lex.OpOrDelim, Val: "*="},
+		lex.Token{Typ: lex.OpOrDelim, Val: "/="},
+		lex.Token{Typ: lex.OpOrDelim, Val: "%="},
+		lex.Token{Typ: lex.OpOrDelim, Val: "<<="},
+		lex.Token{Typ: lex.OpOrDelim, Val: ">>="},
+		lex.Token{Typ: lex.OpOrDelim, Val: "&="},
+		lex.Token{Typ: lex.OpOrDelim, Val: "&^="},
+	}
 )
 
 // All top level sets start with "top". The rest of the identifier
@@ -114,10 +128,15 @@ var (
 	topLiteral  = topBasicLit
 	topBasicLit = []lex.Token{
 		tokInt,
+		tokFloat,
+		tokRune,
 		tokString,
 	}
 	topOperandName   = tokIdentifier
-	topType          = []lex.Token{tokIdentifier, tokOpenParen}
+	topType          = []lex.Token{tokIdentifier, tokOpenParen, topSliceType, topPointerType, topMapType}
+	topSliceType     = tokOpenSquareBrace
+	topPointerType   = lex.Token{Typ: lex.OpOrDelim, Val: "*"}
+	topMapType       = lex.Token{Typ: lex.Keyword, Val: "map"}
 	topTypeName      = tokIdentifier
 	topTypeDecl      = lex.Token{Typ: lex.Keyword, Val: "type"}
 	topTypeSpec      = tokIdentifier
@@ -0,0 +1,391 @@
+package parse
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A Visitor's Visit method is called for each node encountered by
+// Walk. If the result visitor w is not nil, Walk visits each of the
+// children of the node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(n Node) (w Visitor)
+}
+
+// Walk traverses a tree in depth-first order. It starts by calling
+// v.Visit(n). Children are visited in the order that they appear in
+// the source. Nil nodes (including typed nils) are skipped.
+func Walk(v Visitor, n Node) {
+	if isNil(n) {
+		return
+	}
+	if v = v.Visit(n); v == nil {
+		return
+	}
+	for _, c := range children(n) {
+		Walk(v, c)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(n Node) Visitor {
+	if f(n) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a tree in depth-first order. It starts by calling
+// f(n). If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of n, followed by a
+// call of f(nil).
+func Inspect(n Node, f func(Node) bool) {
+	Walk(inspector(f), n)
+}
+
+// isNil reports whether n is nil, or an interface holding a nil
+// pointer. The grammar functions return typed nils on errors, so both
+// show up in trees.
+func isNil(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// child is a single child of a node: the node itself, and where it
+// lives in its parent.
+type child struct {
+	node  Node
+	name  string // name of the field of the parent
+	index int    // index in the field, or -1 if the field isn't a slice
+}
+
+// children returns the non-nil children of n, in source order.
+func children(n Node) []Node {
+	var ns []Node
+	for _, c := range fields(n) {
+		ns = append(ns, c.node)
+	}
+	return ns
+}
+
+// fields lists the non-nil children of n along with the fields that
+// hold them, in source order. Every node type in nodes.go must be
+// handled here.
+func fields(n Node) []child {
+	var cs []child
+	one := func(name string, c Node) {
+		if !isNil(c) {
+			cs = append(cs, child{node: c, name: name, index: -1})
+		}
+	}
+	at := func(name string, i int, c Node) {
+		if !isNil(c) {
+			cs = append(cs, child{node: c, name: name, index: i})
+		}
+	}
+	switch n := n.(type) {
+	case *Tree:
+		for i, k := range n.Kids {
+			at("Kids", i, k)
+		}
+	case *Impts:
+		for i, im := range n.Imports {
+			at("Imports", i, im)
+		}
+	case *Consts:
+		for i, c := range n.Cs {
+			at("Cs", i, c)
+		}
+	case *Cnst:
+		for i, id := range n.Is {
+			at("Is", i, id)
+		}
+		one("T", n.T)
+		for i, e := range n.Es {
+			at("Es", i, e)
+		}
+	case *Expr:
+		one("FirstN", n.FirstN)
+		one("SecondN", n.SecondN)
+	case *BinaryE:
+		one("X", n.X)
+		one("Y", n.Y)
+	case *UnaryE:
+		one("Expr", n.Expr)
+	case *PrimaryE:
+		one("Expr", n.Expr)
+		one("Prime", n.Prime)
+	case *Typ:
+		one("T", n.T)
+	case *SliceType:
+		one("Elem", n.Elem)
+	case *PointerType:
+		one("Elem", n.Elem)
+	case *MapType:
+		one("Key", n.Key)
+		one("Elem", n.Elem)
+	case *Types:
+		for i, ts := range n.Typspecs {
+			at("Typspecs", i, ts)
+		}
+	case *Typespec:
+		one("I", n.I)
+		one("Typ", n.Typ)
+	case *Vars:
+		for i, v := range n.Vs {
+			at("Vs", i, v)
+		}
+	case *Varspec:
+		for i, id := range n.Idents {
+			at("Idents", i, id)
+		}
+		one("T", n.T)
+		for i, e := range n.Exprs {
+			at("Exprs", i, e)
+		}
+	case *Funcdecl:
+		one("Name", n.Name)
+		one("Func", n.Func)
+	case *Func:
+		one("Sig", n.Sig)
+		one("Body", n.Body)
+	case *Sig:
+		for i, p := range n.Params {
+			at("Params", i, p)
+		}
+		one("Result", n.Result)
+	case *Stmt:
+		one("S", n.S)
+	case *Result:
+		for i, p := range n.Params {
+			at("Params", i, p)
+		}
+		one("Typ", n.Typ)
+	case *Params:
+		for i, p := range n.Params {
+			at("Params", i, p)
+		}
+	case *Param:
+		for i, id := range n.Idents {
+			at("Idents", i, id)
+		}
+		one("Typ", n.Typ)
+	case *Block:
+		for i, s := range n.Stmts {
+			at("Stmts", i, s)
+		}
+	case *LabeledStmt:
+		one("Label", n.Label)
+		one("Stmt", n.Stmt)
+	case *ExprStmt:
+		one("Expr", n.Expr)
+	case *SendStmt:
+		one("Chan", n.Chan)
+		one("Expr", n.Expr)
+	case *IncDecStmt:
+		one("Expr", n.Expr)
+	case *Assign:
+		for i, e := range n.LeftExpr {
+			at("LeftExpr", i, e)
+		}
+		for i, e := range n.RightExpr {
+			at("RightExpr", i, e)
+		}
+	case *IfStmt:
+		one("SimpleStmt", n.SimpleStmt)
+		one("Expr", n.Expr)
+		one("Body", n.Body)
+		one("Else", n.Else)
+	case *ForStmt:
+		one("Clause", n.Clause)
+		one("Body", n.Body)
+	case *ForClause:
+		one("InitStmt", n.InitStmt)
+		one("Condition", n.Condition)
+		one("PostStmt", n.PostStmt)
+	case *RangeClause:
+		for i, e := range n.Exprs {
+			at("Exprs", i, e)
+		}
+		for i, id := range n.Idents {
+			at("Idents", i, id)
+		}
+		one("Expr", n.Expr)
+	case *GoStmt:
+		one("Expr", n.Expr)
+	case *ReturnStmt:
+		for i, e := range n.Exprs {
+			at("Exprs", i, e)
+		}
+	case *BreakStmt:
+		one("Label", n.Label)
+	case *ContinueStmt:
+		one("Label", n.Label)
+	case *GotoStmt:
+		one("Label", n.Label)
+	case *DeferStmt:
+		one("Expr", n.Expr)
+	case *ShortVarDecl:
+		for i, id := range n.Idents {
+			at("Idents", i, id)
+		}
+		for i, e := range n.Exprs {
+			at("Exprs", i, e)
+		}
+	case *Conversion:
+		one("Typ", n.Typ)
+		one("Expr", n.Expr)
+	case *Builtin:
+		one("Name", n.Name)
+		one("Typ", n.Typ)
+		one("Args", n.Args)
+	case *Selector:
+		one("Ident", n.Ident)
+	case *Index:
+		one("Expr", n.Expr)
+	case *Slice:
+		one("Start", n.Start)
+		one("End", n.End)
+		one("Cap", n.Cap)
+	case *TypeAssertion:
+		one("Typ", n.Typ)
+	case *Call:
+		one("Args", n.Args)
+	case *Args:
+		for i, e := range n.Exprs {
+			at("Exprs", i, e)
+		}
+	case *Pkg, *Impt, *Erro, *Lit, *Ident, *Fallthrough, *EmptyStmt:
+		// leaves
+	default:
+		panic(fmt.Sprintf("parse.Walk: unexpected node type %T", n))
+	}
+	return cs
+}
+
+// An ApplyFunc is called by Apply for each node. If it returns false,
+// Apply stops: for a pre function the children (and post) are skipped,
+// for a post function the traversal is aborted.
+type ApplyFunc func(*Cursor) bool
+
+// A Cursor describes the node that Apply is visiting, and lets the
+// ApplyFunc replace or delete it.
+type Cursor struct {
+	parent Node
+	name   string
+	index  int
+	node   Node
+	// set by Delete; only meaningful for slice elements
+	deleted bool
+}
+
+// Node returns the current node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current node, or nil at the root.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the field of the parent that holds the
+// current node.
+func (c *Cursor) Name() string { return c.name }
+
+// Index returns the index of the current node in the parent's slice
+// field, or -1 if the field isn't a slice.
+func (c *Cursor) Index() int { return c.index }
+
+// Replace replaces the current node with n, and makes the parent of
+// the current node the parent of n. n must be assignable to the field
+// that holds the current node; Replace panics otherwise. If it is
+// called from pre, Apply goes on to walk the children of n.
+func (c *Cursor) Replace(n Node) {
+	c.node = n
+	if c.parent == nil {
+		return
+	}
+	f := c.field()
+	if isNil(n) {
+		f.Set(reflect.Zero(f.Type()))
+		return
+	}
+	f.Set(reflect.ValueOf(n))
+	n.SetUp(c.parent)
+}
+
+// Delete removes the current node from its parent's slice. It panics
+// if the current node isn't in a slice.
+func (c *Cursor) Delete() {
+	if c.index < 0 {
+		panic("parse.Cursor.Delete: node is not in a slice")
+	}
+	s := reflect.ValueOf(c.parent).Elem().FieldByName(c.name)
+	reflect.Copy(s.Slice(c.index, s.Len()), s.Slice(c.index+1, s.Len()))
+	s.Index(s.Len() - 1).Set(reflect.Zero(s.Type().Elem()))
+	s.SetLen(s.Len() - 1)
+	c.deleted = true
+}
+
+func (c *Cursor) field() reflect.Value {
+	f := reflect.ValueOf(c.parent).Elem().FieldByName(c.name)
+	if c.index >= 0 {
+		f = f.Index(c.index)
+	}
+	return f
+}
+
+// Apply traverses a tree recursively, calling pre for each node before
+// its children and post after them. Either may be nil. The cursor
+// passed to them can be used to replace or delete the current node, so
+// passes can rewrite the tree in place. Apply returns the (possibly
+// replaced) root.
+func Apply(root Node, pre, post ApplyFunc) Node {
+	a := &applier{pre: pre, post: post}
+	c := &Cursor{node: root, index: -1}
+	a.apply(c)
+	return c.node
+}
+
+type applier struct {
+	pre, post ApplyFunc
+	aborted   bool
+}
+
+func (a *applier) apply(c *Cursor) {
+	if a.aborted || isNil(c.node) {
+		return
+	}
+	if a.pre != nil && !a.pre(c) {
+		return
+	}
+	if c.deleted || isNil(c.node) {
+		return
+	}
+	n := c.node
+	// Deleting a slice element shifts the later elements of the same
+	// slice down by one.
+	deleted, field := 0, ""
+	for _, f := range fields(n) {
+		if f.name != field {
+			deleted, field = 0, f.name
+		}
+		index := f.index
+		if index >= 0 {
+			index -= deleted
+		}
+		kc := &Cursor{parent: n, name: f.name, index: index, node: f.node}
+		a.apply(kc)
+		if kc.deleted {
+			deleted++
+		}
+		if a.aborted {
+			return
+		}
+	}
+	if a.post != nil && !a.post(c) {
+		a.aborted = true
+	}
+}
@@ -0,0 +1,141 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+// idents returns the names of the identifiers under n, in the order
+// that Inspect finds them.
+func idents(n Node) []string {
+	var names []string
+	Inspect(n, func(n Node) bool {
+		if id, ok := n.(*Ident); ok {
+			names = append(names, id.Name)
+		}
+		return true
+	})
+	return names
+}
+
+type counter struct {
+	depth, max, nils int
+}
+
+func (c *counter) Visit(n Node) Visitor {
+	if n == nil {
+		c.nils++
+		c.depth--
+		return nil
+	}
+	c.depth++
+	if c.depth > c.max {
+		c.max = c.depth
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	tree := parseSrc(t, "package main\n\nfunc f(a int) int {\n\treturn a + b*c\n}\n")
+	want := []string{"f", "a", "int", "int", "a", "b", "c"}
+	if got := idents(tree); !reflect.DeepEqual(got, want) {
+		t.Errorf("identifiers are %v, want %v", got, want)
+	}
+	var c counter
+	Walk(&c, tree)
+	if c.depth != 0 || c.nils == 0 || c.max < 5 {
+		t.Errorf("Walk ended at depth %d after %d nils, deepest %d", c.depth, c.nils, c.max)
+	}
+}
+
+func TestInspectPrunes(t *testing.T) {
+	tree := parseSrc(t, program)
+	var names []string
+	Inspect(tree, func(n Node) bool {
+		switch n := n.(type) {
+		case *Funcdecl:
+			names = append(names, n.Name.Name)
+			return false
+		case *Ident:
+			if EnclosingFunc(n) != nil {
+				t.Errorf("found %s under a function", n.Name)
+			}
+		}
+		return true
+	})
+	if want := []string{"add", "main"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("functions are %v, want %v", names, want)
+	}
+}
+
+func TestApplyReplace(t *testing.T) {
+	tree := parseSrc(t, program)
+	Apply(tree, func(c *Cursor) bool {
+		if id, ok := c.Node().(*Ident); ok && id.Name == "x" {
+			c.Replace(&Ident{Name: "y", Pos: id.Pos})
+		}
+		return true
+	}, nil)
+	for _, name := range idents(tree) {
+		if name == "x" {
+			t.Fatal("x is still in the tree")
+		}
+	}
+	Inspect(tree, func(n Node) bool {
+		if id, ok := n.(*Ident); ok && id.Name == "y" && id.Up() == nil {
+			t.Error("a replacement has no parent")
+		}
+		return true
+	})
+}
+
+func TestApplyDelete(t *testing.T) {
+	tree := parseSrc(t, "package main\n\nfunc main() {\n\tprintln(1)\n\tprintln(2)\n\tx := 3\n\tprintln(x)\n}\n")
+	var body *Block
+	Apply(tree, func(c *Cursor) bool {
+		if b, ok := c.Node().(*Block); ok {
+			body = b
+			return true
+		}
+		// the calls are the statements that aren't declarations
+		if _, ok := c.Node().(*ShortVarDecl); !ok && c.Parent() == Node(body) {
+			c.Delete()
+			return false
+		}
+		return true
+	}, nil)
+	if body == nil || len(body.Stmts) != 1 {
+		t.Fatalf("body is %v, want just the assignment", body)
+	}
+	if got := idents(body); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("body has %v left", got)
+	}
+}
+
+func TestApplyAbort(t *testing.T) {
+	tree := parseSrc(t, program)
+	var posts int
+	Apply(tree, nil, func(c *Cursor) bool {
+		posts++
+		_, ok := c.Node().(*ReturnStmt)
+		return !ok
+	})
+	var found bool
+	Apply(tree, nil, func(c *Cursor) bool {
+		if _, ok := c.Node().(*ReturnStmt); ok {
+			found = true
+		}
+		return true
+	})
+	if !found || posts == 0 {
+		t.Fatalf("no return statement found")
+	}
+	var all int
+	Apply(tree, nil, func(*Cursor) bool {
+		all++
+		return true
+	})
+	if posts >= all {
+		t.Errorf("Apply visited %d nodes after aborting, and %d without", posts, all)
+	}
+}
@@ -0,0 +1,787 @@
+// Package printer turns parse trees back into Go source, laid out the
+// way gofmt lays it out.
+//
+// The lexer throws away comments, so they wouldn't survive printing,
+// and Format refuses sources that have any. The parser doesn't keep
+// track of where blank lines were either: top level declarations are
+// separated by a single blank line, unless they're of the same kind,
+// fit on a line each and were on consecutive lines, and statements
+// never are.
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/samertm/chompy/lex"
+	"github.com/samertm/chompy/parse"
+)
+
+// Fprint writes the source for n to w.
+func Fprint(w io.Writer, n parse.Node) error {
+	p := &printer{}
+	p.node(n)
+	_, err := w.Write(p.out)
+	return err
+}
+
+// Format parses src and returns it in canonical form. It checks that
+// the result parses back into the same source, so that formatting can
+// never change what a file means. Since comments would be lost, it
+// refuses any src that contains "//".
+func Format(name string, src []byte) ([]byte, error) {
+	if bytes.Contains(src, []byte("//")) {
+		return nil, fmt.Errorf("%s: can't format a file with comments, since they would be deleted", name)
+	}
+	out, err := format(name, src)
+	if err != nil {
+		return nil, err
+	}
+	again, err := format(name, out)
+	if err != nil {
+		return nil, fmt.Errorf("%s: formatted source does not parse: %s", name, err)
+	}
+	if !bytes.Equal(out, again) {
+		return nil, fmt.Errorf("%s: formatting is not stable", name)
+	}
+	return out, nil
+}
+
+func format(name string, src []byte) ([]byte, error) {
+	_, tokens := lex.Lex(name, string(src))
+	t, err := parse.Start(tokens)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := Fprint(&buf, t); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type printer struct {
+	out    []byte
+	indent int
+	// lastOp is the last thing printed if it was an operator, so that
+	// "-" followed by "-" can be kept from turning into "--".
+	lastOp string
+}
+
+func (p *printer) print(s string) {
+	p.out = append(p.out, s...)
+	p.lastOp = ""
+}
+
+// op prints the operator s, with a blank in front of it if it would
+// combine with the operator before it into a different token.
+func (p *printer) op(s string) {
+	if mayCombine(p.lastOp, s[0]) {
+		p.out = append(p.out, ' ')
+	}
+	p.out = append(p.out, s...)
+	p.lastOp = s
+}
+
+func mayCombine(prev string, next byte) bool {
+	switch prev {
+	case "+":
+		return next == '+'
+	case "-":
+		return next == '-'
+	case "/":
+		return next == '*'
+	case "<":
+		return next == '-' || next == '<'
+	case "&":
+		return next == '&' || next == '^'
+	}
+	return false
+}
+
+// newline ends the current line and indents the next one.
+func (p *printer) newline() {
+	p.print("\n")
+	p.print(strings.Repeat("\t", p.indent))
+}
+
+func (p *printer) node(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.Tree:
+		p.file(n)
+	case *parse.Expr, *parse.BinaryE, *parse.UnaryE, *parse.PrimaryE,
+		*parse.Ident, *parse.Lit, *parse.Builtin, *parse.Conversion:
+		p.expr1(n, 0, 1)
+	case *parse.Typ:
+		p.typ(n)
+	default:
+		if isDecl(n) {
+			p.decl(n)
+			return
+		}
+		p.stmt(n)
+	}
+}
+
+func (p *printer) file(t *parse.Tree) {
+	var start int
+	for i, kid := range t.Kids {
+		if i > 0 {
+			// like gofmt, keep one line declarations of the same
+			// kind together if they were
+			prev := t.Kids[i-1]
+			if fmt.Sprintf("%T", prev) == fmt.Sprintf("%T", kid) &&
+				!bytes.Contains(p.out[start:], []byte("\n")) &&
+				parse.Position(kid).Line == parse.Position(prev).Line+1 {
+				p.print("\n")
+			} else {
+				p.print("\n\n")
+			}
+		}
+		start = len(p.out)
+		switch k := kid.(type) {
+		case *parse.Pkg:
+			p.print("package " + k.Name)
+		case *parse.Impts:
+			p.imports(k)
+		default:
+			p.decl(k)
+		}
+	}
+	p.print("\n")
+}
+
+func (p *printer) imports(i *parse.Impts) {
+	p.print("import ")
+	if len(i.Imports) == 1 {
+		p.importSpec(i.Imports[0])
+		return
+	}
+	p.print("(")
+	p.indent++
+	for _, im := range i.Imports {
+		p.newline()
+		p.importSpec(im)
+	}
+	p.indent--
+	p.newline()
+	p.print(")")
+}
+
+func (p *printer) importSpec(i *parse.Impt) {
+	if i.PkgName != "" {
+		p.print(i.PkgName + " ")
+	}
+	p.print(`"` + i.ImptName + `"`)
+}
+
+func isDecl(n parse.Node) bool {
+	switch n.(type) {
+	case *parse.Consts, *parse.Vars, *parse.Types, *parse.Funcdecl:
+		return true
+	}
+	return false
+}
+
+func (p *printer) decl(n parse.Node) {
+	switch d := n.(type) {
+	case *parse.Funcdecl:
+		p.print("func " + d.Name.Name)
+		p.signature(d.Func.Sig)
+		p.print(" ")
+		p.block(d.Func.Body)
+	case *parse.Consts:
+		var specs []valueSpec
+		for _, c := range d.Cs {
+			specs = append(specs, valueSpec{c.Is, c.T, c.Es})
+		}
+		p.valueSpecs("const", specs)
+	case *parse.Vars:
+		var specs []valueSpec
+		for _, v := range d.Vs {
+			specs = append(specs, valueSpec{v.Idents, v.T, v.Exprs})
+		}
+		p.valueSpecs("var", specs)
+	case *parse.Types:
+		p.typeSpecs(d.Typspecs)
+	}
+}
+
+// valueSpec is the part that ConstSpecs and VarSpecs have in common.
+type valueSpec struct {
+	idents []*parse.Ident
+	typ    *parse.Typ
+	values []*parse.Expr
+}
+
+func (p *printer) valueSpecs(keyword string, specs []valueSpec) {
+	p.print(keyword + " ")
+	if len(specs) == 1 {
+		s := specs[0]
+		p.identList(s.idents)
+		if s.typ != nil {
+			p.print(" ")
+			p.typ(s.typ)
+		}
+		if s.values != nil {
+			p.print(" = ")
+			p.exprList(s.values, 1)
+		}
+		return
+	}
+	keepType := keepTypeColumn(specs)
+	p.group(len(specs), func(sub *printer, i int) {
+		s := specs[i]
+		sub.identList(s.idents)
+		if s.typ != nil || keepType[i] {
+			sub.print("\v")
+		}
+		if s.typ != nil {
+			sub.typ(s.typ)
+		}
+		if s.values != nil {
+			sub.print("\v= ")
+			sub.exprList(s.values, 1)
+		}
+	})
+}
+
+// keepTypeColumn works out, for each spec in a group, whether an empty
+// type column has to be kept so that the "=" lines up with the specs
+// around it. This is the same rule that gofmt uses: within a run of
+// specs with values, the column is kept if any of them has a type.
+func keepTypeColumn(specs []valueSpec) []bool {
+	m := make([]bool, len(specs))
+	populate := func(i, j int, keepType bool) {
+		if keepType {
+			for ; i < j; i++ {
+				m[i] = true
+			}
+		}
+	}
+	start := -1 // start of the current run, or -1
+	var keepType bool
+	for i, s := range specs {
+		if s.values != nil {
+			if start < 0 {
+				start = i
+				keepType = false
+			}
+		} else if start >= 0 {
+			populate(start, i, keepType)
+			start = -1
+		}
+		if s.typ != nil {
+			keepType = true
+		}
+	}
+	if start >= 0 {
+		populate(start, len(specs), keepType)
+	}
+	return m
+}
+
+func (p *printer) typeSpecs(specs []*parse.Typespec) {
+	p.print("type ")
+	if len(specs) == 1 {
+		p.print(specs[0].I.Name + " ")
+		p.typ(specs[0].Typ)
+		return
+	}
+	p.group(len(specs), func(sub *printer, i int) {
+		sub.print(specs[i].I.Name + "\v")
+		sub.typ(specs[i].Typ)
+	})
+}
+
+// group prints a parenthesized group of n specs, one per line, with
+// the cells separated by "\v" lined up in columns.
+func (p *printer) group(n int, spec func(sub *printer, i int)) {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 8, 1, ' ', tabwriter.DiscardEmptyColumns)
+	for i := 0; i < n; i++ {
+		sub := &printer{}
+		spec(sub, i)
+		tw.Write(sub.out)
+		tw.Write([]byte("\n"))
+	}
+	tw.Flush()
+	p.print("(")
+	p.indent++
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		p.newline()
+		p.print(strings.TrimRight(line, " "))
+	}
+	p.indent--
+	p.newline()
+	p.print(")")
+}
+
+func (p *printer) identList(ids []*parse.Ident) {
+	for i, id := range ids {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.ident(id)
+	}
+}
+
+func (p *printer) ident(id *parse.Ident) {
+	if id.Pkg != "" {
+		p.print(id.Pkg + ".")
+	}
+	p.print(id.Name)
+}
+
+func (p *printer) typ(t *parse.Typ) {
+	switch n := t.T.(type) {
+	case *parse.Ident:
+		p.ident(n)
+	case *parse.Typ:
+		p.typ(n)
+	case *parse.SliceType:
+		p.print("[]")
+		p.typ(n.Elem)
+	case *parse.PointerType:
+		p.print("*")
+		p.typ(n.Elem)
+	case *parse.MapType:
+		p.print("map[")
+		p.typ(n.Key)
+		p.print("]")
+		p.typ(n.Elem)
+	default:
+		p.node(n)
+	}
+}
+
+func (p *printer) signature(s *parse.Sig) {
+	p.params(s.Params)
+	if s.Result == nil {
+		return
+	}
+	p.print(" ")
+	if s.Result.Typ != nil {
+		p.typ(s.Result.Typ)
+		return
+	}
+	p.params(s.Result.Params)
+}
+
+func (p *printer) params(ps []*parse.Param) {
+	p.print("(")
+	for i, par := range ps {
+		if i > 0 {
+			p.print(", ")
+		}
+		if len(par.Idents) > 0 {
+			p.identList(par.Idents)
+			p.print(" ")
+		}
+		if par.DotDotDot {
+			p.print("...")
+		}
+		p.typ(par.Typ)
+	}
+	p.print(")")
+}
+
+func (p *printer) block(b *parse.Block) {
+	p.print("{")
+	p.indent++
+	p.stmtList(b.Stmts)
+	p.indent--
+	p.newline()
+	p.print("}")
+}
+
+func (p *printer) stmtList(stmts []parse.Node) {
+	for _, s := range stmts {
+		if _, ok := s.(*parse.EmptyStmt); ok || s == nil {
+			continue
+		}
+		p.newline()
+		p.stmt(s)
+	}
+}
+
+func (p *printer) stmt(n parse.Node) {
+	switch s := n.(type) {
+	case *parse.Consts, *parse.Vars, *parse.Types:
+		p.decl(s)
+	case *parse.Stmt:
+		p.stmt(s.S)
+	case *parse.Block:
+		p.block(s)
+	case *parse.LabeledStmt:
+		// labels are outdented by one level
+		p.out = bytes.TrimSuffix(p.out, []byte("\t"))
+		p.print(s.Label.Name + ":")
+		p.newline()
+		p.stmt(s.Stmt)
+	case *parse.Expr:
+		p.expr(s, 1)
+	case *parse.ExprStmt:
+		p.node(s.Expr)
+	case *parse.SendStmt:
+		p.node(s.Chan)
+		p.print(" ")
+		p.op("<-")
+		p.print(" ")
+		p.node(s.Expr)
+	case *parse.IncDecStmt:
+		if e, ok := s.Expr.(*parse.Expr); ok {
+			p.expr(e, 2)
+		} else {
+			p.node(s.Expr)
+		}
+		p.op(s.Postfix)
+	case *parse.Assign:
+		depth := 1
+		if len(s.LeftExpr) > 1 && len(s.RightExpr) > 1 {
+			depth++
+		}
+		p.exprList(s.LeftExpr, depth)
+		p.print(" ")
+		p.op(s.Op)
+		p.print(" ")
+		p.exprList(s.RightExpr, depth)
+	case *parse.ShortVarDecl:
+		depth := 1
+		if len(s.Idents) > 1 && len(s.Exprs) > 1 {
+			depth++
+		}
+		p.identList(s.Idents)
+		p.print(" := ")
+		p.exprList(s.Exprs, depth)
+	case *parse.IfStmt:
+		p.ifStmt(s)
+	case *parse.ForStmt:
+		p.forStmt(s)
+	case *parse.GoStmt:
+		p.print("go ")
+		p.node(s.Expr)
+	case *parse.DeferStmt:
+		p.print("defer ")
+		p.node(s.Expr)
+	case *parse.ReturnStmt:
+		p.print("return")
+		if len(s.Exprs) > 0 {
+			p.print(" ")
+			p.exprList(s.Exprs, 1)
+		}
+	case *parse.BreakStmt:
+		p.branch("break", s.Label)
+	case *parse.ContinueStmt:
+		p.branch("continue", s.Label)
+	case *parse.GotoStmt:
+		p.branch("goto", s.Label)
+	case *parse.Fallthrough:
+		p.print("fallthrough")
+	case *parse.EmptyStmt:
+	default:
+		panic(fmt.Sprintf("printer: unexpected statement %T", n))
+	}
+}
+
+func (p *printer) branch(keyword string, label *parse.Ident) {
+	p.print(keyword)
+	if label != nil {
+		p.print(" " + label.Name)
+	}
+}
+
+func (p *printer) ifStmt(s *parse.IfStmt) {
+	p.print("if ")
+	if s.SimpleStmt != nil {
+		p.stmt(s.SimpleStmt)
+		p.print("; ")
+	}
+	p.expr(s.Expr, 1)
+	p.print(" ")
+	p.block(s.Body)
+	if s.Else != nil {
+		p.print(" else ")
+		p.stmt(s.Else)
+	}
+}
+
+func (p *printer) forStmt(s *parse.ForStmt) {
+	p.print("for ")
+	switch c := s.Clause.(type) {
+	case nil:
+	case *parse.ForClause:
+		if c.InitStmt == nil && c.PostStmt == nil {
+			// gofmt drops the semicolons
+			if c.Condition != nil {
+				p.node(c.Condition)
+				p.print(" ")
+			}
+			break
+		}
+		if c.InitStmt != nil {
+			p.stmt(c.InitStmt)
+		}
+		p.print("; ")
+		if c.Condition != nil {
+			p.node(c.Condition)
+		}
+		p.print("; ")
+		if c.PostStmt != nil {
+			p.stmt(c.PostStmt)
+			p.print(" ")
+		}
+	case *parse.RangeClause:
+		if len(c.Idents) > 0 {
+			p.identList(c.Idents)
+		} else {
+			p.exprList(c.Exprs, 1)
+		}
+		p.print(" " + c.Op + " range ")
+		p.node(c.Expr)
+		p.print(" ")
+	default:
+		p.node(c)
+		p.print(" ")
+	}
+	p.block(s.Body)
+}
+
+func (p *printer) exprList(es []*parse.Expr, depth int) {
+	for i, e := range es {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.expr(e, depth)
+	}
+}
+
+// expr prints e at the given depth. The depth goes up inside of
+// argument lists and the like, and is used to decide whether binary
+// operators get blanks around them, the way gofmt does it: "x + y" at
+// the top level, but "f(x+y, z)".
+func (p *printer) expr(e *parse.Expr, depth int) {
+	p.expr1(e.Binary(), 0, depth)
+}
+
+func (p *printer) expr1(n parse.Node, prec1, depth int) {
+	switch e := n.(type) {
+	case *parse.BinaryE:
+		p.binary(e, cutoff(e, depth), depth)
+	case *parse.Expr:
+		p.expr(e, depth)
+	case *parse.UnaryE:
+		if e.Op != "" {
+			p.op(e.Op)
+		}
+		p.expr1(e.Expr, 6, depth)
+	case *parse.PrimaryE:
+		p.primary(e, depth)
+	case *parse.Ident:
+		p.ident(e)
+	case *parse.Lit:
+		switch e.Typ {
+		case lex.String.String():
+			p.print(`"` + e.Val + `"`)
+		case lex.Rune.String():
+			p.print("'" + e.Val + "'")
+		default:
+			p.print(e.Val)
+		}
+	case *parse.Builtin:
+		p.ident(e.Name)
+		p.print("(")
+		if e.Typ != nil {
+			p.typ(e.Typ)
+			if e.Args != nil {
+				p.print(", ")
+			}
+		}
+		p.args(e.Args, depth)
+		p.print(")")
+	case *parse.Conversion:
+		p.typ(e.Typ)
+		p.print("(")
+		p.expr1(e.Expr, 0, depth)
+		p.print(")")
+	default:
+		panic(fmt.Sprintf("printer: unexpected expression %T", n))
+	}
+}
+
+func (p *printer) binary(b *parse.BinaryE, cutoff, depth int) {
+	prec := parse.Precedence(b.Op)
+	printBlank := prec < cutoff
+	p.expr1(b.X, prec, depth+diffPrec(b.X, prec))
+	if printBlank {
+		p.print(" ")
+	}
+	p.op(b.Op)
+	if printBlank {
+		p.print(" ")
+	}
+	p.expr1(b.Y, prec+1, depth+1)
+}
+
+// diffPrec is 0 if n is a binary expression with precedence prec, and
+// 1 otherwise.
+func diffPrec(n parse.Node, prec int) int {
+	b, ok := n.(*parse.BinaryE)
+	if !ok || parse.Precedence(b.Op) != prec {
+		return 1
+	}
+	return 0
+}
+
+// cutoff returns the precedence at and above which binary operators
+// in b are printed without blanks around them.
+func cutoff(b *parse.BinaryE, depth int) int {
+	has4, has5, maxProblem := walkBinary(b)
+	if maxProblem > 0 {
+		return maxProblem + 1
+	}
+	if has4 && has5 {
+		if depth == 1 {
+			return 5
+		}
+		return 4
+	}
+	if depth == 1 {
+		return 6
+	}
+	return 4
+}
+
+func walkBinary(b *parse.BinaryE) (has4, has5 bool, maxProblem int) {
+	switch parse.Precedence(b.Op) {
+	case 4:
+		has4 = true
+	case 5:
+		has5 = true
+	}
+	if l, ok := b.X.(*parse.BinaryE); ok && parse.Precedence(l.Op) >= parse.Precedence(b.Op) {
+		h4, h5, mp := walkBinary(l)
+		has4 = has4 || h4
+		has5 = has5 || h5
+		if maxProblem < mp {
+			maxProblem = mp
+		}
+	}
+	switch r := b.Y.(type) {
+	case *parse.BinaryE:
+		if parse.Precedence(r.Op) > parse.Precedence(b.Op) {
+			h4, h5, mp := walkBinary(r)
+			has4 = has4 || h4
+			has5 = has5 || h5
+			if maxProblem < mp {
+				maxProblem = mp
+			}
+		}
+	case *parse.UnaryE:
+		// avoid things like "x/ *p" turning into a comment
+		if r.Op == "" {
+			break
+		}
+		switch b.Op + r.Op {
+		case "/*", "&&", "&^":
+			maxProblem = 5
+		case "++", "--":
+			if maxProblem < 4 {
+				maxProblem = 4
+			}
+		}
+	}
+	return
+}
+
+func (p *printer) primary(e *parse.PrimaryE, depth int) {
+	p.expr1(e.Expr, 6, depth)
+	for pr := e.Prime; pr != nil; pr = pr.Prime {
+		switch x := pr.Expr.(type) {
+		case *parse.Selector:
+			p.print(".")
+			p.ident(x.Ident)
+		case *parse.Index:
+			p.print("[")
+			p.expr1(x.Expr, 0, depth+1)
+			p.print("]")
+		case *parse.Slice:
+			p.slice(x, depth)
+		case *parse.TypeAssertion:
+			p.print(".(")
+			p.typ(x.Typ)
+			p.print(")")
+		case *parse.Call:
+			d := depth
+			if x.Args != nil && len(x.Args.Exprs) > 1 {
+				d++
+			}
+			p.print("(")
+			p.args(x.Args, d)
+			p.print(")")
+		default:
+			panic(fmt.Sprintf("printer: unexpected primary expression %T", pr.Expr))
+		}
+	}
+}
+
+func (p *printer) args(a *parse.Args, depth int) {
+	if a == nil {
+		return
+	}
+	p.exprList(a.Exprs, depth)
+	if a.DotDotDot {
+		p.print("...")
+	}
+}
+
+func (p *printer) slice(s *parse.Slice, depth int) {
+	indices := []parse.Node{s.Start, s.End}
+	if s.Cap != nil {
+		indices = append(indices, s.Cap)
+	}
+	// gofmt puts blanks around the colons if there's more than one
+	// index and one of them is a binary expression
+	needsBlanks := false
+	if depth <= 1 {
+		count, binaries := 0, false
+		for _, x := range indices {
+			if isNil(x) {
+				continue
+			}
+			count++
+			if e, ok := x.(*parse.Expr); ok {
+				if _, ok := e.Binary().(*parse.BinaryE); ok {
+					binaries = true
+				}
+			}
+		}
+		needsBlanks = count > 1 && binaries
+	}
+	p.print("[")
+	for i, x := range indices {
+		if i > 0 {
+			if !isNil(indices[i-1]) && needsBlanks {
+				p.print(" ")
+			}
+			p.print(":")
+			if !isNil(x) && needsBlanks {
+				p.print(" ")
+			}
+		}
+		if !isNil(x) {
+			p.expr1(x, 0, depth+1)
+		}
+	}
+	p.print("]")
+}
+
+// isNil reports whether n is nil or a nil *parse.Expr, which is what
+// the parser leaves in optional expression fields.
+func isNil(n parse.Node) bool {
+	e, ok := n.(*parse.Expr)
+	return n == nil || ok && e == nil
+}
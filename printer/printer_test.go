@@ -0,0 +1,133 @@
+package printer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/samertm/chompy/lex"
+	"github.com/samertm/chompy/parse"
+)
+
+// canonical are sources that are already formatted the way gofmt would.
+var canonical = []string{
+	`package main
+
+var a = 5 &^ 3
+var b = 1
+
+const c = 2
+
+func main() {
+	x := a*b + 5&^3
+	println(x, c)
+}
+`,
+	`package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type celsius int16
+
+func pair(a int) (int, int) {
+	return a, a + 1
+}
+
+func named(a int) (s, t int) {
+	s = a
+	return
+}
+
+func main() {
+	var x int
+L:
+	for x < 10 {
+		y := x
+		if y == 3 {
+			x = x + 2
+			continue L
+		}
+		if y == 7 {
+			break
+		}
+		x++
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; ; j++ {
+			if j > i && x != 0 || !ok() {
+				break
+			}
+			print(i, j, " ")
+		}
+	}
+	for i, r := range "héllo" {
+		println(i, r)
+	}
+	p, q := pair(3)
+	if z := p + q; z == 4 {
+		goto done
+	} else if z > 4 {
+		println(celsius(z) + 1)
+	} else {
+		fmt.Println(f(x+1, -p), os.Args)
+	}
+done:
+	x <<= 2
+	x &^= 1
+}
+`,
+}
+
+func TestFormatCanonical(t *testing.T) {
+	for _, src := range canonical {
+		out, err := Format("test.go", []byte(src))
+		if err != nil {
+			t.Errorf("Format failed: %s\n%s", err, src)
+			continue
+		}
+		if string(out) != src {
+			t.Errorf("Format changed canonical source:\n%s\nwant:\n%s", out, src)
+		}
+	}
+}
+
+// TestRoundTrip checks that printing a parsed program and parsing it
+// again gives the same tree, by printing both.
+func TestRoundTrip(t *testing.T) {
+	messy := []string{
+		"package main\nvar a = 5&^3\nfunc main() { x := a   *  2\n println( x )\n}\n",
+		"package main\n\n\nfunc f(a,b int)(int,int){ return a+b,a-b\n}\nfunc main(){ for{ break\n}\n}\n",
+	}
+	for _, src := range append(messy, canonical...) {
+		first := reprint(t, src)
+		second := reprint(t, first)
+		if first != second {
+			t.Errorf("printing isn't stable:\n%s\nthen:\n%s", first, second)
+		}
+	}
+}
+
+// reprint parses src and prints it.
+func reprint(t *testing.T, src string) string {
+	_, tokens := lex.Lex("test.go", src)
+	n, err := parse.Start(tokens)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, src)
+	}
+	var buf bytes.Buffer
+	if err := Fprint(&buf, n); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestFormatRefusesComments(t *testing.T) {
+	src := "// lead\npackage main\n\nfunc main() {\n}\n// trail\n"
+	_, err := Format("test.go", []byte(src))
+	if err == nil || !strings.Contains(err.Error(), "comments") {
+		t.Errorf("Format of a file with comments gave %v, want an error", err)
+	}
+}
@@ -0,0 +1,338 @@
+package semantic
+
+import (
+	"github.com/samertm/chompy/parse"
+	"github.com/samertm/chompy/semantic/constant"
+	"github.com/samertm/chompy/semantic/stable"
+)
+
+// builtin checks a call to the built-in function x. whole is the call,
+// for errors. typ is the type argument when the parser could tell that
+// the first argument is a type, as in make([]int, 3); otherwise a type
+// argument is the first of args.
+func (c *checker) builtin(x *operand, whole parse.Node, typ *parse.Typ, args []*parse.Expr, dotdotdot bool) *operand {
+	name := exprString(x.node)
+	if dotdotdot && name != "append" {
+		c.errorf(x.node, "invalid operation: invalid use of ... with built-in %s", name)
+		return &operand{}
+	}
+	switch name {
+	case "len", "cap":
+		// func len(v Type) int
+		if !c.builtinArgs(x, whole, args, 1) {
+			return &operand{}
+		}
+		v := c.expr(args[0])
+		c.singleValue(v)
+		if v.mode == invalid {
+			return &operand{}
+		}
+		t := underlying(v.typ)
+		if p, ok := t.(*stable.Pointer); ok {
+			if a, ok := underlying(p.Elem).(*stable.Array); ok {
+				t = a
+			}
+		}
+		integer := stable.Predeclared("int")
+		switch t := t.(type) {
+		case *stable.Basic:
+			if !t.IsString() || name == "cap" {
+				break
+			}
+			if v.mode == constexpr {
+				l := len(constant.StringVal(v.val))
+				return &operand{mode: constexpr, typ: integer, val: constant.MakeInt64(int64(l))}
+			}
+			c.defaultType(v)
+			return &operand{mode: value, typ: integer}
+		case *stable.Array:
+			return &operand{mode: constexpr, typ: integer, val: constant.MakeInt64(t.Len)}
+		case *stable.Slice, *stable.Chan:
+			return &operand{mode: value, typ: integer}
+		case *stable.Map:
+			if name == "len" {
+				return &operand{mode: value, typ: integer}
+			}
+		}
+		c.errorf(v.node, "invalid argument: %s for built-in %s", v, name)
+		return &operand{}
+	case "append":
+		// func append(slice []Type, elems ...Type) []Type
+		if len(args) == 0 {
+			c.builtinArgs(x, whole, args, 1)
+			return &operand{}
+		}
+		s := c.expr(args[0])
+		c.singleValue(s)
+		if s.mode == invalid {
+			c.exprs(args[1:])
+			return &operand{}
+		}
+		if isNil(s.typ) {
+			c.errorf(s.node, "first argument to append must be a typed slice; have untyped nil")
+			c.exprs(args[1:])
+			return &operand{}
+		}
+		sl, ok := underlying(s.typ).(*stable.Slice)
+		if !ok {
+			c.errorf(s.node, "invalid argument: %s is not a slice", s)
+			c.exprs(args[1:])
+			return &operand{}
+		}
+		res := &operand{mode: value, typ: s.typ}
+		if dotdotdot {
+			// append(s, t...) appends the slice t, or the bytes of
+			// the string t to a []byte
+			if !c.builtinArgs(x, whole, args, 2) {
+				return &operand{}
+			}
+			t := c.expr(args[1])
+			if t.mode == invalid {
+				return &operand{}
+			}
+			if isByte(sl.Elem) && isString(t.typ) {
+				c.singleValue(t)
+				c.defaultType(t)
+				return res
+			}
+			c.assignment(t, s.typ, "argument to append")
+			return res
+		}
+		for _, a := range args[1:] {
+			c.assignment(c.expr(a), sl.Elem, "argument to append")
+		}
+		return res
+	case "make":
+		// func make(t Type, size ...IntegerType) Type
+		t, sizes, ok := c.typeArg(x, whole, typ, args)
+		if !ok {
+			return &operand{}
+		}
+		want := 1
+		switch underlying(t).(type) {
+		case *stable.Slice:
+			want = 2
+		case *stable.Map, *stable.Chan:
+		default:
+			c.errorf(whole, "invalid argument: cannot make %s; type must be slice, map, or channel", t)
+			c.exprs(sizes)
+			return &operand{}
+		}
+		if n := len(sizes) + 1; n < want || n > want+1 {
+			c.errorf(whole, "invalid operation: %s expects %d or %d arguments; found %d", exprString(whole), want, want+1, n)
+			c.exprs(sizes)
+			return &operand{}
+		}
+		var vals []constant.Value
+		for _, s := range sizes {
+			if v := c.size(s); v != nil {
+				vals = append(vals, v)
+			}
+		}
+		if len(vals) == 2 && constant.Compare(vals[0], ">", vals[1]) {
+			c.errorf(sizes[0], "invalid argument: length and capacity swapped")
+		}
+		return &operand{mode: value, typ: t}
+	case "new":
+		// func new(Type) *Type
+		t, rest, ok := c.typeArg(x, whole, typ, args)
+		if !ok {
+			return &operand{}
+		}
+		if len(rest) != 0 {
+			c.builtinArgs(x, whole, args, 1)
+			return &operand{}
+		}
+		return &operand{mode: value, typ: &stable.Pointer{Elem: t}}
+	case "copy":
+		// func copy(dst, src []Type) int
+		if !c.builtinArgs(x, whole, args, 2) {
+			return &operand{}
+		}
+		dst, src := c.expr(args[0]), c.expr(args[1])
+		c.singleValue(dst)
+		c.singleValue(src)
+		if dst.mode == invalid || src.mode == invalid {
+			return &operand{}
+		}
+		d, ok := underlying(dst.typ).(*stable.Slice)
+		var elem stable.Type
+		if s, ok := underlying(src.typ).(*stable.Slice); ok {
+			elem = s.Elem
+		} else if isString(src.typ) {
+			// copy([]byte, string)
+			elem = stable.Predeclared("uint8")
+		}
+		if !ok || elem == nil {
+			c.errorf(whole, "invalid argument: copy expects slice arguments; found %s and %s", dst, src)
+			return &operand{}
+		}
+		if !stable.Identical(d.Elem, elem) {
+			c.errorf(whole, "invalid argument: arguments to copy %s and %s have different element types %s and %s", dst, src, d.Elem, elem)
+			return &operand{}
+		}
+		c.defaultType(src)
+		return &operand{mode: value, typ: stable.Predeclared("int")}
+	case "delete":
+		// func delete(m map[Type]Type1, key Type)
+		if !c.builtinArgs(x, whole, args, 2) {
+			return &operand{}
+		}
+		m := c.expr(args[0])
+		k := c.expr(args[1])
+		c.singleValue(m)
+		if m.mode == invalid || k.mode == invalid {
+			return &operand{}
+		}
+		mt, ok := underlying(m.typ).(*stable.Map)
+		if !ok {
+			c.errorf(m.node, "invalid argument: %s is not a map", m)
+			return &operand{}
+		}
+		c.assignment(k, mt.Key, "argument to delete")
+		return &operand{mode: novalue}
+	case "panic":
+		// func panic(v interface{})
+		if !c.builtinArgs(x, whole, args, 1) {
+			return &operand{}
+		}
+		v := c.expr(args[0])
+		c.assignment(v, &stable.Interface{}, "argument to panic")
+		return &operand{mode: novalue}
+	case "print", "println":
+		// func print(args ...Type)
+		for _, a := range args {
+			v := c.expr(a)
+			c.singleValue(v)
+			if v.mode == invalid {
+				continue
+			}
+			if isNil(v.typ) {
+				c.errorf(v.node, "use of untyped nil in argument to built-in %s", name)
+				continue
+			}
+			c.defaultType(v)
+		}
+		return &operand{mode: novalue}
+	}
+	c.errorf(x.node, "%s is not supported yet", name)
+	return &operand{}
+}
+
+// builtinArgs reports an error unless there are n args, and checks the
+// args if there aren't.
+func (c *checker) builtinArgs(x *operand, whole parse.Node, args []*parse.Expr, n int) bool {
+	if len(args) == n {
+		return true
+	}
+	c.exprs(args)
+	msg := "not enough"
+	if len(args) > n {
+		msg = "too many"
+	}
+	c.errorf(x.node, "%s arguments for %s (expected %d, found %d)", msg, exprString(whole), n, len(args))
+	return false
+}
+
+// typeArg returns the type argument of a call to make or new, and the
+// rest of the arguments.
+func (c *checker) typeArg(x *operand, whole parse.Node, typ *parse.Typ, args []*parse.Expr) (stable.Type, []*parse.Expr, bool) {
+	if typ != nil {
+		t := typeOf(typ)
+		if t == nil {
+			c.exprs(args)
+		}
+		return t, args, t != nil
+	}
+	if len(args) == 0 {
+		c.builtinArgs(x, whole, args, 1)
+		return nil, nil, false
+	}
+	t := c.expr(args[0])
+	if t.mode == invalid {
+		c.exprs(args[1:])
+		return nil, nil, false
+	}
+	if t.mode != typexpr {
+		c.errorf(t.node, "%s is not a type", exprString(t.node))
+		c.exprs(args[1:])
+		return nil, nil, false
+	}
+	return t.typ, args[1:], true
+}
+
+// size checks a length or capacity argument to make. It returns the
+// size if it's a constant.
+func (c *checker) size(e *parse.Expr) constant.Value {
+	x := c.expr(e)
+	c.singleValue(x)
+	if x.mode == invalid {
+		return nil
+	}
+	untyped := x.mode == constexpr && isUntyped(x.typ) && isNumeric(x.typ)
+	if !isInteger(x.typ) && !untyped {
+		c.errorf(e, "cannot convert %s to type int", x)
+		return nil
+	}
+	if x.mode != constexpr {
+		return nil
+	}
+	if constant.Sign(x.val) < 0 {
+		c.errorf(e, "invalid argument: index %s must not be negative", x)
+		return nil
+	}
+	if untyped {
+		c.assignment(x, stable.Predeclared("int"), "argument to make")
+		if x.mode == invalid {
+			return nil
+		}
+	}
+	return constant.ToInt(x.val)
+}
+
+// exprs checks each of exprs, for when their values don't matter
+// because of an error elsewhere.
+func (c *checker) exprs(exprs []*parse.Expr) {
+	for _, e := range exprs {
+		c.expr(e)
+	}
+}
+
+// calledBuiltin returns the name of the built-in function that the
+// expression n calls, or "" if n isn't a call to a built-in.
+func calledBuiltin(n parse.Node) string {
+	if e, ok := n.(*parse.Expr); ok {
+		n = e.Binary()
+	}
+	u, ok := n.(*parse.UnaryE)
+	if !ok || u.Op != "" {
+		return ""
+	}
+	pe, ok := u.Expr.(*parse.PrimaryE)
+	if !ok {
+		return ""
+	}
+	var id *parse.Ident
+	switch e := pe.Expr.(type) {
+	case *parse.Builtin:
+		if pe.Prime == nil {
+			id = e.Name
+		}
+	case *parse.Ident:
+		if pe.Prime == nil || pe.Prime.Prime != nil {
+			return ""
+		}
+		if _, ok := pe.Prime.Expr.(*parse.Call); ok {
+			id = e
+		}
+	}
+	if id == nil || id.Info == nil || id.Info.Kind != stable.Builtin {
+		return ""
+	}
+	return id.Name
+}
+
+func isByte(t stable.Type) bool {
+	b, ok := underlying(t).(*stable.Basic)
+	return ok && b.Name == "uint8"
+}
@@ -0,0 +1,403 @@
+// Package constant implements the values of Go's constants. Numeric
+// constants are exact: integers are arbitrary precision, and floats
+// are arbitrary precision fractions, so that untyped constant
+// expressions are evaluated the way the spec says.
+package constant
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Kind is the kind of a Value.
+type Kind int
+
+const (
+	// Unknown is the kind of the result of an operation that
+	// couldn't be evaluated.
+	Unknown Kind = iota
+	Bool
+	String
+	Int
+	Float
+)
+
+// Value is the value of a constant. Values are immutable.
+type Value interface {
+	Kind() Kind
+	// String returns the value as it would be written in Go.
+	String() string
+}
+
+type (
+	unknownVal struct{}
+	boolVal    bool
+	stringVal  string
+	intVal     struct{ val *big.Int }
+	floatVal   struct{ val *big.Rat }
+)
+
+func (unknownVal) Kind() Kind { return Unknown }
+func (boolVal) Kind() Kind    { return Bool }
+func (stringVal) Kind() Kind  { return String }
+func (intVal) Kind() Kind     { return Int }
+func (floatVal) Kind() Kind   { return Float }
+
+func (unknownVal) String() string  { return "unknown" }
+func (b boolVal) String() string   { return strconv.FormatBool(bool(b)) }
+func (s stringVal) String() string { return strconv.Quote(string(s)) }
+func (i intVal) String() string    { return i.val.String() }
+
+func (f floatVal) String() string {
+	if f.val.IsInt() {
+		return f.val.Num().String()
+	}
+	if x, _ := f.val.Float64(); !math.IsInf(x, 0) {
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	return f.val.FloatString(10)
+}
+
+func MakeUnknown() Value        { return unknownVal{} }
+func MakeBool(b bool) Value     { return boolVal(b) }
+func MakeString(s string) Value { return stringVal(s) }
+func MakeInt64(x int64) Value   { return intVal{big.NewInt(x)} }
+
+// MakeFloat64 returns the exact value of x, which mustn't be infinite
+// or NaN.
+func MakeFloat64(x float64) Value {
+	return floatVal{new(big.Rat).SetFloat64(x)}
+}
+
+// MakeFromLiteral returns the value of a literal token. kind is the
+// token's type: "Int", "Float", "Rune" or "String". The values of rune
+// and string tokens are written without their quotes. It returns an
+// Unknown value if lit is malformed.
+func MakeFromLiteral(lit, kind string) Value {
+	switch kind {
+	case "Int":
+		// base 0 understands the 0x and 0 prefixes
+		if x, ok := new(big.Int).SetString(lit, 0); ok {
+			return intVal{x}
+		}
+	case "Float":
+		if x, ok := new(big.Rat).SetString(lit); ok {
+			return floatVal{x}
+		}
+	case "Rune":
+		r, _, tail, err := strconv.UnquoteChar(lit, '\'')
+		if err == nil && tail == "" {
+			return MakeInt64(int64(r))
+		}
+	case "String":
+		if s, err := strconv.Unquote(`"` + lit + `"`); err == nil {
+			return stringVal(s)
+		}
+	}
+	return unknownVal{}
+}
+
+// ToInt returns x as an Int value if it's an integer, or a float with
+// an integral value. Otherwise it returns an Unknown value.
+func ToInt(x Value) Value {
+	switch x := x.(type) {
+	case intVal:
+		return x
+	case floatVal:
+		if x.val.IsInt() {
+			return intVal{new(big.Int).Set(x.val.Num())}
+		}
+	}
+	return unknownVal{}
+}
+
+// ToFloat returns the numeric value x as a Float value, or an Unknown
+// value if x isn't numeric.
+func ToFloat(x Value) Value {
+	switch x := x.(type) {
+	case intVal:
+		return floatVal{new(big.Rat).SetInt(x.val)}
+	case floatVal:
+		return x
+	}
+	return unknownVal{}
+}
+
+// BoolVal returns the value of the Bool x.
+func BoolVal(x Value) bool {
+	b, _ := x.(boolVal)
+	return bool(b)
+}
+
+// StringVal returns the value of the String x.
+func StringVal(x Value) string {
+	s, _ := x.(stringVal)
+	return string(s)
+}
+
+// Int64Val returns the value of the Int x, and whether it fits in an
+// int64.
+func Int64Val(x Value) (int64, bool) {
+	i, ok := x.(intVal)
+	if !ok || !i.val.IsInt64() {
+		return 0, false
+	}
+	return i.val.Int64(), true
+}
+
+// Float64Val returns the numeric value x as the nearest float64, and
+// whether it's exact. Values too large for a float64 are infinite.
+func Float64Val(x Value) (float64, bool) {
+	f, ok := ToFloat(x).(floatVal)
+	if !ok {
+		return 0, false
+	}
+	return f.val.Float64()
+}
+
+// Float32Val is Float64Val for float32.
+func Float32Val(x Value) (float32, bool) {
+	f, ok := ToFloat(x).(floatVal)
+	if !ok {
+		return 0, false
+	}
+	return f.val.Float32()
+}
+
+// Sign returns -1, 0 or 1 as the numeric value x is negative, zero or
+// positive. It returns 1 for values that aren't numeric.
+func Sign(x Value) int {
+	switch x := x.(type) {
+	case intVal:
+		return x.val.Sign()
+	case floatVal:
+		return x.val.Sign()
+	}
+	return 1
+}
+
+// BitLen returns the number of bits needed to hold the absolute value
+// of the Int x.
+func BitLen(x Value) int {
+	i, ok := x.(intVal)
+	if !ok {
+		return 0
+	}
+	return i.val.BitLen()
+}
+
+// match converts x and y to the same kind, so that ints mix with
+// floats.
+func match(x, y Value) (Value, Value) {
+	if x.Kind() == Float || y.Kind() == Float {
+		return ToFloat(x), ToFloat(y)
+	}
+	return x, y
+}
+
+// BinaryOp returns x op y, where op is one of Go's binary operators
+// other than the comparisons and shifts. Division of two Ints truncates,
+// and the caller must check for division by zero. The result is
+// Unknown if op isn't defined on the values.
+func BinaryOp(x Value, op string, y Value) Value {
+	x, y = match(x, y)
+	switch x := x.(type) {
+	case boolVal:
+		y, ok := y.(boolVal)
+		if !ok {
+			break
+		}
+		switch op {
+		case "&&":
+			return x && y
+		case "||":
+			return x || y
+		}
+	case stringVal:
+		if y, ok := y.(stringVal); ok && op == "+" {
+			return x + y
+		}
+	case intVal:
+		y, ok := y.(intVal)
+		if !ok {
+			break
+		}
+		z := new(big.Int)
+		switch op {
+		case "+":
+			z.Add(x.val, y.val)
+		case "-":
+			z.Sub(x.val, y.val)
+		case "*":
+			z.Mul(x.val, y.val)
+		case "/":
+			z.Quo(x.val, y.val)
+		case "%":
+			z.Rem(x.val, y.val)
+		case "&":
+			z.And(x.val, y.val)
+		case "|":
+			z.Or(x.val, y.val)
+		case "^":
+			z.Xor(x.val, y.val)
+		case "&^":
+			z.AndNot(x.val, y.val)
+		default:
+			return unknownVal{}
+		}
+		return intVal{z}
+	case floatVal:
+		y, ok := y.(floatVal)
+		if !ok {
+			break
+		}
+		z := new(big.Rat)
+		switch op {
+		case "+":
+			z.Add(x.val, y.val)
+		case "-":
+			z.Sub(x.val, y.val)
+		case "*":
+			z.Mul(x.val, y.val)
+		case "/":
+			z.Quo(x.val, y.val)
+		default:
+			return unknownVal{}
+		}
+		return floatVal{z}
+	}
+	return unknownVal{}
+}
+
+// Shift returns x << s or x >> s for the Int x.
+func Shift(x Value, op string, s uint) Value {
+	i, ok := x.(intVal)
+	if !ok {
+		return unknownVal{}
+	}
+	switch op {
+	case "<<":
+		return intVal{new(big.Int).Lsh(i.val, s)}
+	case ">>":
+		return intVal{new(big.Int).Rsh(i.val, s)}
+	}
+	return unknownVal{}
+}
+
+// UnaryOp returns op x for the unary operators +, -, ! and ^. For ^,
+// prec is the size in bits of an unsigned type, whose values are
+// complemented within that many bits; it's 0 for every other type.
+func UnaryOp(op string, x Value, prec uint) Value {
+	switch x := x.(type) {
+	case boolVal:
+		if op == "!" {
+			return !x
+		}
+	case intVal:
+		switch op {
+		case "+":
+			return x
+		case "-":
+			return intVal{new(big.Int).Neg(x.val)}
+		case "^":
+			z := new(big.Int).Not(x.val)
+			if prec > 0 {
+				// mask off the sign extension
+				mask := new(big.Int).Lsh(big.NewInt(1), prec)
+				z.And(z, mask.Sub(mask, big.NewInt(1)))
+			}
+			return intVal{z}
+		}
+	case floatVal:
+		switch op {
+		case "+":
+			return x
+		case "-":
+			return floatVal{new(big.Rat).Neg(x.val)}
+		}
+	}
+	return unknownVal{}
+}
+
+// Compare reports whether x op y is true, where op is one of the
+// comparison operators.
+func Compare(x Value, op string, y Value) bool {
+	x, y = match(x, y)
+	var cmp int
+	switch x := x.(type) {
+	case boolVal:
+		y, _ := y.(boolVal)
+		switch op {
+		case "==":
+			return x == y
+		case "!=":
+			return x != y
+		}
+		return false
+	case stringVal:
+		y, _ := y.(stringVal)
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	case intVal:
+		y, ok := y.(intVal)
+		if !ok {
+			return false
+		}
+		cmp = x.val.Cmp(y.val)
+	case floatVal:
+		y, ok := y.(floatVal)
+		if !ok {
+			return false
+		}
+		cmp = x.val.Cmp(y.val)
+	default:
+		return false
+	}
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// RuneString returns string(x) for the Int x: the UTF-8 encoding of
+// the rune, or "�" if x isn't a valid rune.
+func RuneString(x Value) Value {
+	r := utf8.RuneError
+	if v, ok := Int64Val(x); ok && v >= 0 && v <= utf8.MaxRune {
+		r = rune(v)
+	}
+	return stringVal(string(r))
+}
+
+// Representable reports whether the numeric value x lies within the
+// integers that can be held in bits bits, signed or unsigned.
+func Representable(x Value, bits uint, unsigned bool) bool {
+	i, ok := x.(intVal)
+	if !ok {
+		return false
+	}
+	if unsigned {
+		return i.val.Sign() >= 0 && uint(i.val.BitLen()) <= bits
+	}
+	// -1<<(bits-1) <= x < 1<<(bits-1)
+	min := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), bits-1))
+	max := new(big.Int).Lsh(big.NewInt(1), bits-1)
+	return i.val.Cmp(min) >= 0 && i.val.Cmp(max) < 0
+}
@@ -0,0 +1,148 @@
+package constant
+
+import "testing"
+
+func TestMakeFromLiteral(t *testing.T) {
+	tests := []struct {
+		lit, kind string
+		want      string
+	}{
+		{"42", "Int", "42"},
+		{"0x1F", "Int", "31"},
+		{"017", "Int", "15"},
+		{"123456789012345678901234567890", "Int", "123456789012345678901234567890"},
+		{"2.5", "Float", "2.5"},
+		{"1e3", "Float", "1000"},
+		{"a", "Rune", "97"},
+		{`\n`, "Rune", "10"},
+		{"é", "Rune", "233"},
+		{`a\tb`, "String", `"a\tb"`},
+		{"0x", "Int", "unknown"},
+		{"ab", "Rune", "unknown"},
+	}
+	for _, test := range tests {
+		if got := MakeFromLiteral(test.lit, test.kind).String(); got != test.want {
+			t.Errorf("MakeFromLiteral(%q, %q) = %s, want %s", test.lit, test.kind, got, test.want)
+		}
+	}
+}
+
+func TestBinaryOp(t *testing.T) {
+	i := MakeInt64
+	tests := []struct {
+		x    Value
+		op   string
+		y    Value
+		want string
+	}{
+		{i(7), "+", i(5), "12"},
+		{i(7), "-", i(9), "-2"},
+		{i(-7), "/", i(2), "-3"},
+		{i(-7), "%", i(2), "-1"},
+		{i(12), "&^", i(10), "4"},
+		{i(12), "^", i(10), "6"},
+		{i(1), "+", MakeFromLiteral("0.5", "Float"), "1.5"},
+		{MakeFromLiteral("1", "Float"), "/", i(4), "0.25"},
+		{MakeString("ab"), "+", MakeString("c"), `"abc"`},
+		{MakeBool(true), "&&", MakeBool(false), "false"},
+		{i(1), "&&", i(2), "unknown"},
+		{MakeString("a"), "-", MakeString("b"), "unknown"},
+		{MakeFromLiteral("1.5", "Float"), "%", i(1), "unknown"},
+	}
+	for _, test := range tests {
+		if got := BinaryOp(test.x, test.op, test.y).String(); got != test.want {
+			t.Errorf("%s %s %s = %s, want %s", test.x, test.op, test.y, got, test.want)
+		}
+	}
+}
+
+func TestUnaryOpAndShift(t *testing.T) {
+	if got := UnaryOp("^", MakeInt64(5), 0).String(); got != "-6" {
+		t.Errorf("^5 = %s, want -6", got)
+	}
+	if got := UnaryOp("^", MakeInt64(5), 8).String(); got != "250" {
+		t.Errorf("^uint8(5) = %s, want 250", got)
+	}
+	if got := UnaryOp("!", MakeBool(false), 0).String(); got != "true" {
+		t.Errorf("!false = %s", got)
+	}
+	if got := Shift(MakeInt64(1), "<<", 100).String(); got != "1267650600228229401496703205376" {
+		t.Errorf("1<<100 = %s", got)
+	}
+	if got := Shift(MakeInt64(-9), ">>", 1).String(); got != "-5" {
+		t.Errorf("-9>>1 = %s, want -5", got)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	half := MakeFromLiteral("0.5", "Float")
+	tests := []struct {
+		x    Value
+		op   string
+		y    Value
+		want bool
+	}{
+		{MakeInt64(1), "<", MakeInt64(2), true},
+		{MakeInt64(1), ">=", half, true},
+		{half, "==", MakeFromLiteral("5e-1", "Float"), true},
+		{MakeString("abc"), "<", MakeString("abd"), true},
+		{MakeBool(true), "!=", MakeBool(true), false},
+		{MakeBool(true), "<", MakeBool(false), false},
+	}
+	for _, test := range tests {
+		if got := Compare(test.x, test.op, test.y); got != test.want {
+			t.Errorf("%s %s %s = %v, want %v", test.x, test.op, test.y, got, test.want)
+		}
+	}
+}
+
+func TestConversions(t *testing.T) {
+	if got := ToInt(MakeFromLiteral("3.0", "Float")).String(); got != "3" {
+		t.Errorf("ToInt(3.0) = %s", got)
+	}
+	if got := ToInt(MakeFromLiteral("3.5", "Float")).Kind(); got != Unknown {
+		t.Errorf("ToInt(3.5) has kind %v, want Unknown", got)
+	}
+	if f, exact := Float64Val(MakeInt64(3)); f != 3 || !exact {
+		t.Errorf("Float64Val(3) = %v, %v", f, exact)
+	}
+	if _, exact := Float32Val(MakeFromLiteral("0.1", "Float")); exact {
+		t.Error("0.1 is exact as a float32")
+	}
+	if _, ok := Int64Val(Shift(MakeInt64(1), "<<", 63)); ok {
+		t.Error("1<<63 fits in an int64")
+	}
+	if got := StringVal(RuneString(MakeInt64(0x4e16))); got != "世" {
+		t.Errorf("string(0x4e16) = %q", got)
+	}
+	if got := StringVal(RuneString(MakeInt64(-1))); got != "�" {
+		t.Errorf("string(-1) = %q", got)
+	}
+}
+
+func TestRepresentable(t *testing.T) {
+	tests := []struct {
+		x        int64
+		bits     uint
+		unsigned bool
+		want     bool
+	}{
+		{127, 8, false, true},
+		{128, 8, false, false},
+		{-128, 8, false, true},
+		{-129, 8, false, false},
+		{255, 8, true, true},
+		{256, 8, true, false},
+		{-1, 32, true, false},
+		{1<<31 - 1, 32, false, true},
+		{1 << 31, 32, false, false},
+	}
+	for _, test := range tests {
+		if got := Representable(MakeInt64(test.x), test.bits, test.unsigned); got != test.want {
+			t.Errorf("Representable(%d, %d, %v) = %v, want %v", test.x, test.bits, test.unsigned, got, test.want)
+		}
+	}
+	if Representable(MakeFromLiteral("1.5", "Float"), 64, false) {
+		t.Error("1.5 is representable as an integer")
+	}
+}
@@ -0,0 +1,229 @@
+package semantic
+
+import (
+	"strings"
+
+	"github.com/samertm/chompy/parse"
+	"github.com/samertm/chompy/semantic/stable"
+)
+
+// initializer is a package level var spec with initial values.
+type initializer struct {
+	file  string
+	ids   []*parse.Ident
+	exprs []*parse.Expr
+}
+
+// initOrder works out the order that the package level variables are
+// initialized in, and records it in p.inits. A variable is initialized
+// once every variable that its initial value refers to, directly or
+// through the functions it calls, has been; ties go to the one declared
+// first. It reports variables that depend on themselves, and init
+// functions with the wrong signature.
+func initOrder(p *pkg) sErrors {
+	g := &initGraph{
+		vars:  make(map[*stable.NodeInfo]*initializer),
+		funcs: make(map[*stable.NodeInfo]*parse.Funcdecl),
+		names: make(map[interface{}]string),
+	}
+	var errs sErrors
+	var inits []*initializer
+	for _, t := range p.files {
+		for _, kid := range t.Kids {
+			switch n := kid.(type) {
+			case *parse.Vars:
+				for _, v := range n.Vs {
+					for _, in := range splitSpec(t.Name, v) {
+						inits = append(inits, in)
+						g.names[in] = in.ids[0].Name
+						for _, id := range in.ids {
+							if id.Info != nil {
+								g.vars[id.Info] = in
+							}
+						}
+					}
+				}
+			case *parse.Funcdecl:
+				if n.Name.Name == "init" {
+					if sig := n.Func.Sig; len(sig.Params) != 0 || sig.Result != nil {
+						errs = append(errs, errorAt(t.Name, n.Name, "func init must have no arguments and no return values"))
+					}
+					continue
+				}
+				if n.Name.Info != nil {
+					g.funcs[n.Name.Info] = n
+					g.names[n] = n.Name.Name
+				}
+			}
+		}
+	}
+	reported := make(map[interface{}]bool)
+	for _, in := range inits {
+		if reported[in] {
+			continue
+		}
+		if path := g.cycle(in); path != nil {
+			errs = append(errs, errorAt(in.file, in.ids[0], "initialization cycle: %s", g.describe(path)))
+			for _, node := range path {
+				reported[node] = true
+			}
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	deps := make(map[*initializer]map[*initializer]bool)
+	for _, in := range inits {
+		deps[in] = g.varDeps(in)
+	}
+	done := make(map[*initializer]bool)
+	for len(p.inits) < len(inits) {
+		for _, in := range inits {
+			if !done[in] && ready(deps[in], done) {
+				done[in] = true
+				p.inits = append(p.inits, in)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// splitSpec returns an initializer for each variable of v, or one for
+// all of them if they're initialized by a single multi-valued
+// expression.
+func splitSpec(file string, v *parse.Varspec) []*initializer {
+	if len(v.Exprs) == 0 {
+		return nil
+	}
+	if len(v.Exprs) != len(v.Idents) {
+		return []*initializer{{file: file, ids: v.Idents, exprs: v.Exprs}}
+	}
+	var inits []*initializer
+	for i, id := range v.Idents {
+		inits = append(inits, &initializer{file: file, ids: []*parse.Ident{id}, exprs: v.Exprs[i : i+1]})
+	}
+	return inits
+}
+
+func ready(deps, done map[*initializer]bool) bool {
+	for d := range deps {
+		if !done[d] {
+			return false
+		}
+	}
+	return true
+}
+
+// initGraph is the graph of references between package level variables
+// and functions. Its nodes are *initializers and *parse.Funcdecls.
+type initGraph struct {
+	vars  map[*stable.NodeInfo]*initializer
+	funcs map[*stable.NodeInfo]*parse.Funcdecl
+	names map[interface{}]string
+}
+
+// refs returns the variables and functions that node refers to, in the
+// order they appear.
+func (g *initGraph) refs(node interface{}) []interface{} {
+	var roots []parse.Node
+	switch n := node.(type) {
+	case *initializer:
+		for _, e := range n.exprs {
+			roots = append(roots, e)
+		}
+	case *parse.Funcdecl:
+		roots = append(roots, n.Func.Body)
+	}
+	var refs []interface{}
+	seen := make(map[interface{}]bool)
+	for _, root := range roots {
+		parse.Inspect(root, func(n parse.Node) bool {
+			id, ok := n.(*parse.Ident)
+			if !ok || id.Info == nil {
+				return true
+			}
+			var ref interface{}
+			if in, ok := g.vars[id.Info]; ok {
+				ref = in
+			} else if f, ok := g.funcs[id.Info]; ok {
+				ref = f
+			}
+			if ref != nil && !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+			return true
+		})
+	}
+	return refs
+}
+
+// cycle returns a path of references from in back to itself, or nil if
+// there isn't one.
+func (g *initGraph) cycle(in *initializer) []interface{} {
+	var path []interface{}
+	visited := make(map[interface{}]bool)
+	var find func(node interface{}) bool
+	find = func(node interface{}) bool {
+		path = append(path, node)
+		for _, ref := range g.refs(node) {
+			if ref == in {
+				return true
+			}
+			if visited[ref] {
+				continue
+			}
+			visited[ref] = true
+			if find(ref) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if !find(in) {
+		return nil
+	}
+	return path
+}
+
+// describe describes the cycle path.
+func (g *initGraph) describe(path []interface{}) string {
+	if len(path) == 1 {
+		return g.names[path[0]] + " refers to itself"
+	}
+	var steps []string
+	for i, node := range path {
+		to := path[0]
+		if i+1 < len(path) {
+			to = path[i+1]
+		}
+		steps = append(steps, g.names[node]+" refers to "+g.names[to])
+	}
+	return strings.Join(steps, ", ")
+}
+
+// varDeps returns the variables that in's initial values depend on:
+// the ones they refer to, and the ones that the functions they call
+// refer to.
+func (g *initGraph) varDeps(in *initializer) map[*initializer]bool {
+	deps := make(map[*initializer]bool)
+	visited := make(map[interface{}]bool)
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		for _, ref := range g.refs(node) {
+			if visited[ref] {
+				continue
+			}
+			visited[ref] = true
+			if v, ok := ref.(*initializer); ok {
+				deps[v] = true
+				continue
+			}
+			walk(ref)
+		}
+	}
+	walk(in)
+	return deps
+}
@@ -0,0 +1,144 @@
+package semantic
+
+import (
+	"github.com/samertm/chompy/parse"
+)
+
+// checkLabels checks the labels of every function, and the gotos,
+// breaks and continues. Labels are in a namespace of their own, and
+// their scope is the body of the function they're declared in.
+func checkLabels(p *pkg) sErrors {
+	var errs sErrors
+	for _, t := range p.files {
+		for _, kid := range t.Kids {
+			f, ok := kid.(*parse.Funcdecl)
+			if !ok || f.Func == nil || f.Func.Body == nil {
+				continue
+			}
+			lc := &labelChecker{file: t.Name, labels: make(map[string]*parse.LabeledStmt), used: make(map[*parse.LabeledStmt]bool)}
+			lc.check(f.Func.Body)
+			errs = append(errs, lc.errs...)
+		}
+	}
+	return errs
+}
+
+type labelChecker struct {
+	file   string
+	errs   sErrors
+	labels map[string]*parse.LabeledStmt
+	used   map[*parse.LabeledStmt]bool
+}
+
+func (lc *labelChecker) errorf(n parse.Node, format string, a ...interface{}) {
+	lc.errs = append(lc.errs, errorAt(lc.file, n, format, a...))
+}
+
+func (lc *labelChecker) check(body *parse.Block) {
+	// declare every label first, since gotos can jump forwards
+	var order []*parse.LabeledStmt
+	parse.Inspect(body, func(n parse.Node) bool {
+		if l, ok := n.(*parse.LabeledStmt); ok && l.Label != nil {
+			if prev, ok := lc.labels[l.Label.Name]; ok {
+				lc.errorf(l.Label, "label %s already defined at %s", l.Label.Name, parse.Position(prev.Label))
+			} else {
+				lc.labels[l.Label.Name] = l
+				order = append(order, l)
+			}
+		}
+		return true
+	})
+	parse.Inspect(body, func(n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.GotoStmt:
+			lc.gotoStmt(n)
+		case *parse.BreakStmt:
+			lc.branch(n, n.Label, "break")
+		case *parse.ContinueStmt:
+			lc.branch(n, n.Label, "continue")
+		}
+		return true
+	})
+	for _, l := range order {
+		if !lc.used[l] {
+			lc.errorf(l.Label, "label %s defined and not used", l.Label.Name)
+		}
+	}
+}
+
+// gotoStmt checks that the label of g is in the same block as g or an
+// enclosing one, and that the jump doesn't skip any variable
+// declarations in that block.
+func (lc *labelChecker) gotoStmt(g *parse.GotoStmt) {
+	if g.Label == nil {
+		return
+	}
+	l, ok := lc.labels[g.Label.Name]
+	if !ok {
+		lc.errorf(g.Label, "label %s not defined", g.Label.Name)
+		return
+	}
+	lc.used[l] = true
+	block, ok := l.Up().(*parse.Block)
+	if !ok {
+		return
+	}
+	// find the statement of the label's block that holds g
+	var from parse.Node = g
+	for from != nil && from.Up() != block {
+		from = from.Up()
+	}
+	if from == nil {
+		lc.errorf(g, "goto %s jumps into block starting at %s", g.Label.Name, parse.Position(block))
+		return
+	}
+	i, j := indexOf(block.Stmts, from), indexOf(block.Stmts, l)
+	if i >= j {
+		// jumping backwards leaves the declarations behind
+		return
+	}
+	for _, s := range block.Stmts[i+1 : j] {
+		switch s.(type) {
+		case *parse.Vars, *parse.ShortVarDecl:
+			lc.errorf(g, "goto %s jumps over variable declaration at line %d", g.Label.Name, parse.Position(s).Line)
+			return
+		}
+	}
+}
+
+// branch checks a break or continue statement n, with the label label
+// (which may be nil).
+func (lc *labelChecker) branch(n parse.Node, label *parse.Ident, keyword string) {
+	if label == nil {
+		if parse.EnclosingFor(n) == nil {
+			if keyword == "break" {
+				lc.errorf(n, "break is not in a loop, switch, or select")
+			} else {
+				lc.errorf(n, "continue is not in a loop")
+			}
+		}
+		return
+	}
+	l, ok := lc.labels[label.Name]
+	if !ok {
+		lc.errorf(label, "%s label not defined: %s", keyword, label.Name)
+		return
+	}
+	lc.used[l] = true
+	// the label has to be on a loop that n is inside of
+	for f := parse.EnclosingFor(n); f != nil; f = parse.EnclosingFor(f) {
+		if f.Up() == l {
+			return
+		}
+	}
+	lc.errorf(label, "invalid %s label %s", keyword, label.Name)
+}
+
+func indexOf(stmts []parse.Node, s parse.Node) int {
+	for i, t := range stmts {
+		if t == s {
+			return i
+		}
+	}
+	return -1
+}
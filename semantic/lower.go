@@ -0,0 +1,974 @@
+package semantic
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/samertm/chompy/ir"
+	"github.com/samertm/chompy/parse"
+	"github.com/samertm/chompy/semantic/constant"
+	"github.com/samertm/chompy/semantic/stable"
+)
+
+// lowerer lowers a checked package to IR.
+type lowerer struct {
+	p   *pkg
+	out *ir.Package
+	// globals maps the package level variables of p, and the ones of
+	// the packages it imports, to their addresses.
+	globals map[*stable.NodeInfo]*ir.Global
+	// funcs maps the functions that the code can call to their labels.
+	funcs map[*stable.NodeInfo]string
+	// initdone is set once p's init function has run.
+	initdone *ir.Global
+	// file is the name of the file that the code being lowered is in.
+	file string
+
+	// The rest is about the function being lowered.
+	fn *ir.Func
+	// vars maps the function's variables to their Vars, and names
+	// holds the names that its Vars have been given.
+	vars  map[*stable.NodeInfo]*ir.Var
+	names map[string]bool
+	temps int
+	// labels maps the function's labels to theirs in the IR.
+	labels  map[string]*ir.Label
+	nlabels int
+	loops   []*loop
+	// named are the function's named results.
+	named []*ir.Var
+}
+
+// loop is a for statement that's being lowered, for the break and
+// continue statements inside of it.
+type loop struct {
+	// label is the name of the statement's label, if it has one.
+	label string
+	// cont is where continue jumps to, and end is where break does.
+	cont, end *ir.Label
+}
+
+// lower lowers p, which has been checked, to IR.
+func lower(p *pkg) *ir.Package {
+	l := &lowerer{
+		p:       p,
+		out:     &ir.Package{Path: p.path, Main: p.name == "main"},
+		globals: make(map[*stable.NodeInfo]*ir.Global),
+		funcs:   make(map[*stable.NodeInfo]string),
+	}
+	l.declare()
+	var inits int
+	for _, t := range p.files {
+		l.file = t.Name
+		for _, kid := range t.Kids {
+			n, ok := kid.(*parse.Funcdecl)
+			if !ok {
+				continue
+			}
+			name := funcLabel(p, n.Name.Name)
+			if n.Name.Name == "init" {
+				// there may be any number of them
+				name = fmt.Sprintf("%s.%d", ir.InitName(p.path), inits)
+				inits++
+			}
+			l.out.Funcs = append(l.out.Funcs, l.function(name, n))
+		}
+	}
+	l.out.Funcs = append(l.out.Funcs, l.initFunc(inits))
+	return l.out
+}
+
+// declare fills in the functions and the package level variables of p
+// and of the packages it imports. Only p's own variables are added to
+// the package; imported packages have their own. Variables whose
+// initial value is a constant start out with it, and the init function
+// leaves them alone.
+func (l *lowerer) declare() {
+	for path, ip := range l.p.imports {
+		for _, name := range ip.Scope.Names() {
+			ni, _ := ip.Scope.LookupLocal(name)
+			switch ni.Kind {
+			case stable.Func:
+				l.funcs[ni] = path + "." + name
+			case stable.Var:
+				l.globals[ni] = &ir.Global{Name: path + "." + name, Size: globalSize(ni.T)}
+			}
+		}
+	}
+	for _, name := range l.p.scope.Names() {
+		if ni, _ := l.p.scope.LookupLocal(name); ni.Kind == stable.Func {
+			l.funcs[ni] = funcLabel(l.p, name)
+		}
+	}
+	for _, f := range l.p.files {
+		for _, kid := range f.Kids {
+			vars, ok := kid.(*parse.Vars)
+			if !ok {
+				continue
+			}
+			for _, v := range vars.Vs {
+				for i, id := range v.Idents {
+					if id.Name == "_" || id.Info == nil {
+						continue
+					}
+					// prefixed by the import path, so that variables
+					// can't clash with functions or register names
+					g := &ir.Global{Name: l.p.path + "." + id.Name, Size: globalSize(id.Info.T)}
+					if len(v.Exprs) == len(v.Idents) {
+						g.Init, _ = l.constWord(v.Exprs[i])
+					}
+					l.globals[id.Info] = g
+					l.out.Globals = append(l.out.Globals, g)
+				}
+			}
+		}
+	}
+	l.initdone = &ir.Global{Name: l.p.path + ".initdone", Size: 4}
+	l.out.Globals = append(l.out.Globals, l.initdone)
+}
+
+// globalSize is the number of bytes a package level variable of type t
+// takes, rounded up to a whole number of words.
+func globalSize(t stable.Type) int {
+	return int(stable.ARM.Sizeof(t)+3) &^ 3
+}
+
+// constWord returns the value of e if it's a constant that fits in a
+// word.
+func (l *lowerer) constWord(e *parse.Expr) (int64, bool) {
+	v, ok := l.p.consts[e]
+	if !ok || stable.ARM.Sizeof(l.p.types[e]) > 4 {
+		return 0, false
+	}
+	switch v.Kind() {
+	case constant.Bool, constant.Int:
+		return constValue(v).(ir.Const).Val, true
+	}
+	return 0, false
+}
+
+// initFunc lowers the function that initializes p, which runs once,
+// before main. It initializes the packages that p imports, then p's
+// variables in the order that initOrder worked out, then calls p's init
+// functions. inits is the number of init functions.
+func (l *lowerer) initFunc(inits int) *ir.Func {
+	l.begin(ir.InitName(l.p.path))
+	done := l.temp()
+	run := l.newLabel()
+	l.emit(&ir.Load{Dst: done, Addr: l.initdone})
+	l.emit(&ir.IfZ{Cond: done, Label: run})
+	l.emit(&ir.Return{})
+	l.emit(run)
+	l.emit(&ir.Store{Addr: l.initdone, Val: ir.Const{Val: 1}})
+	for _, path := range importPaths(l.p) {
+		l.emit(&ir.Call{Func: ir.InitName(path)})
+	}
+	for _, in := range l.p.inits {
+		l.file = in.file
+		if len(in.ids) == len(in.exprs) {
+			if _, ok := l.constWord(in.exprs[0]); ok {
+				// it starts out with its value
+				continue
+			}
+		}
+		l.assign(in.ids, in.exprs)
+	}
+	for i := 0; i < inits; i++ {
+		l.emit(&ir.Call{Func: fmt.Sprintf("%s.%d", ir.InitName(l.p.path), i)})
+	}
+	l.emit(&ir.Return{})
+	return l.fn
+}
+
+// importPaths returns the import paths of the packages that p imports,
+// sorted.
+func importPaths(p *pkg) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(i *parse.Impt) {
+		if !seen[i.ImptName] {
+			seen[i.ImptName] = true
+			paths = append(paths, i.ImptName)
+		}
+	}
+	for _, f := range p.files {
+		for _, kid := range f.Kids {
+			switch n := kid.(type) {
+			case *parse.Impt:
+				add(n)
+			case *parse.Impts:
+				for _, i := range n.Imports {
+					add(i)
+				}
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// begin starts lowering the function called name.
+func (l *lowerer) begin(name string) {
+	l.fn = &ir.Func{Name: name}
+	l.vars = make(map[*stable.NodeInfo]*ir.Var)
+	l.names = make(map[string]bool)
+	l.temps = 0
+	l.labels = make(map[string]*ir.Label)
+	l.nlabels = 0
+	l.loops = nil
+	l.named = nil
+}
+
+// function lowers the function d under the label name. Named results
+// start out as zero.
+func (l *lowerer) function(name string, d *parse.Funcdecl) *ir.Func {
+	l.begin(name)
+	sig := d.Name.Info.T.(*stable.Signature)
+	l.fn.Results = len(sig.Results)
+	for _, p := range d.Func.Sig.Params {
+		if len(p.Idents) == 0 {
+			l.fn.Params = append(l.fn.Params, &ir.Var{Name: l.unique("_")})
+		}
+		for _, id := range p.Idents {
+			v := &ir.Var{Name: l.unique(id.Name)}
+			l.vars[id.Info] = v
+			l.fn.Params = append(l.fn.Params, v)
+		}
+	}
+	if r := d.Func.Sig.Result; r != nil {
+		for _, p := range r.Params {
+			for _, id := range p.Idents {
+				v := l.local(id.Info)
+				l.emit(&ir.Assign{Dst: v, X: ir.Const{}, Type: irType(id.Info.T)})
+				l.named = append(l.named, v)
+			}
+		}
+	}
+	l.block(d.Func.Body)
+	if !l.returned() {
+		// Falling off the end of a function with results can't
+		// happen, since its body has to be terminating, but the code
+		// still has to end.
+		var vals []ir.Value
+		for i := 0; i < l.fn.Results; i++ {
+			if l.named != nil {
+				vals = append(vals, l.named[i])
+			} else {
+				vals = append(vals, ir.Const{})
+			}
+		}
+		l.emit(&ir.Return{Vals: vals})
+	}
+	return l.fn
+}
+
+// returned reports whether the code so far ends by leaving the
+// function or jumping.
+func (l *lowerer) returned() bool {
+	if len(l.fn.Code) == 0 {
+		return false
+	}
+	switch l.fn.Code[len(l.fn.Code)-1].(type) {
+	case *ir.Return, *ir.Goto:
+		return true
+	}
+	return false
+}
+
+func (l *lowerer) emit(in ir.Instr) {
+	l.fn.Code = append(l.fn.Code, in)
+}
+
+// unique returns name, or name with a number after it if the function
+// being lowered already has a Var called name.
+func (l *lowerer) unique(name string) string {
+	u := name
+	for i := 1; l.names[u]; i++ {
+		u = fmt.Sprintf("%s.%d", name, i)
+	}
+	l.names[u] = true
+	return u
+}
+
+// newVar adds a local called name to the function.
+func (l *lowerer) newVar(name string) *ir.Var {
+	return l.fn.NewVar(l.unique(name))
+}
+
+// temp adds a temporary to the function.
+func (l *lowerer) temp() *ir.Var {
+	v := l.newVar(fmt.Sprintf("t%d", l.temps))
+	l.temps++
+	return v
+}
+
+func (l *lowerer) newLabel() *ir.Label {
+	lb := &ir.Label{Name: fmt.Sprintf("L%d", l.nlabels)}
+	l.nlabels++
+	return lb
+}
+
+// pos returns where n is, for the IR's warnings.
+func (l *lowerer) pos(n parse.Node) string {
+	pos := parse.Position(n)
+	if !pos.IsValid() {
+		return l.file
+	}
+	return l.file + ":" + pos.String()
+}
+
+// label returns the IR label for the function's label called name.
+func (l *lowerer) label(name string) *ir.Label {
+	lb, ok := l.labels[name]
+	if !ok {
+		lb = l.newLabel()
+		l.labels[name] = lb
+	}
+	return lb
+}
+
+// local returns the Var of the local variable ni.
+func (l *lowerer) local(ni *stable.NodeInfo) *ir.Var {
+	v, ok := l.vars[ni]
+	if !ok {
+		v = l.newVar(ni.Name)
+		l.vars[ni] = v
+	}
+	return v
+}
+
+// findLoop returns the innermost loop, or the one labeled label.
+func (l *lowerer) findLoop(label *parse.Ident) *loop {
+	for i := len(l.loops) - 1; i >= 0; i-- {
+		if label == nil || l.loops[i].label == label.Name {
+			return l.loops[i]
+		}
+	}
+	panic(fmt.Sprintf("no loop for %s", label))
+}
+
+// irTypes maps the basic types whose values fit in a word to their
+// types in the IR.
+var irTypes = map[string]ir.Type{
+	"bool":         ir.Bool,
+	"untyped bool": ir.Bool,
+	"int":          ir.Int32,
+	"int32":        ir.Int32,
+	"untyped int":  ir.Int32,
+	"untyped rune": ir.Int32,
+	"int16":        ir.Int16,
+	"int8":         ir.Int8,
+	"uint":         ir.Uint32,
+	"uint32":       ir.Uint32,
+	"uintptr":      ir.Uint32,
+	"uint16":       ir.Uint16,
+	"uint8":        ir.Uint8,
+}
+
+// isWord reports whether values of type t fit in a word, which is all
+// that the IR has so far.
+func isWord(t stable.Type) bool {
+	b := basic(t)
+	if b == nil {
+		return false
+	}
+	_, ok := irTypes[b.Name]
+	return ok
+}
+
+// irType returns the type that values of type t have in the IR. The
+// checker has made sure that they fit in a word.
+func irType(t stable.Type) ir.Type {
+	if !isWord(t) {
+		panic(fmt.Sprintf("lowering a value of type %s", t))
+	}
+	return irTypes[basic(t).Name]
+}
+
+// constValue returns the constant v as a Value. Only integers and
+// booleans fit in a word.
+func constValue(v constant.Value) ir.Value {
+	switch v.Kind() {
+	case constant.Bool:
+		if constant.BoolVal(v) {
+			return ir.Const{Val: 1}
+		}
+		return ir.Const{Val: 0}
+	case constant.Int:
+		// the value has been checked to fit its type
+		i, _ := constant.Int64Val(v)
+		return ir.Const{Val: i}
+	}
+	panic(fmt.Sprintf("lowering the constant %s", v))
+}
+
+func (l *lowerer) block(b *parse.Block) {
+	for _, stmt := range b.Stmts {
+		l.stmt(stmt)
+	}
+}
+
+func (l *lowerer) stmt(stmt parse.Node) {
+	switch s := stmt.(type) {
+	case nil, *parse.EmptyStmt:
+	case *parse.Block:
+		l.block(s)
+	case *parse.Vars:
+		for _, v := range s.Vs {
+			if len(v.Exprs) != 0 {
+				l.assign(v.Idents, v.Exprs)
+				continue
+			}
+			for _, id := range v.Idents {
+				if id.Name != "_" {
+					l.emit(&ir.Assign{Dst: l.local(id.Info), X: ir.Const{}, Type: irType(id.Info.T)})
+				}
+			}
+		}
+	case *parse.Consts, *parse.Types:
+		// constants are folded into the code that uses them
+	case *parse.Assign:
+		if s.Op != "=" {
+			l.opAssign(s)
+			return
+		}
+		var ids []*parse.Ident
+		for _, e := range s.LeftExpr {
+			ids = append(ids, assignedIdent(e))
+		}
+		l.assign(ids, s.RightExpr)
+	case *parse.ShortVarDecl:
+		l.assign(s.Idents, s.Exprs)
+	case *parse.ReturnStmt:
+		l.ret(s.Exprs)
+	case *parse.IfStmt:
+		l.ifStmt(s)
+	case *parse.ForStmt:
+		l.forStmt(s)
+	case *parse.IncDecStmt:
+		op := "+"
+		if s.Postfix == "--" {
+			op = "-"
+		}
+		id := assignedIdent(s.Expr.(*parse.Expr))
+		t := l.temp()
+		l.emit(&ir.Assign{Dst: t, Op: op, X: l.load(id), Y: ir.Const{Val: 1}, Type: irType(l.p.types[s.Expr]), Pos: l.pos(s)})
+		l.store(id, t)
+	case *parse.LabeledStmt:
+		l.emit(l.label(s.Label.Name))
+		l.stmt(s.Stmt)
+	case *parse.GotoStmt:
+		l.emit(&ir.Goto{Label: l.label(s.Label.Name)})
+	case *parse.BreakStmt:
+		l.emit(&ir.Goto{Label: l.findLoop(s.Label).end})
+	case *parse.ContinueStmt:
+		l.emit(&ir.Goto{Label: l.findLoop(s.Label).cont})
+	case *parse.Expr:
+		if name := calledBuiltin(s); name != "" {
+			l.builtinCall(name, callArgs(s))
+			return
+		}
+		pe := l.callOf(s)
+		if pe == nil {
+			panic(fmt.Sprintf("lowering %s as a statement", exprString(s)))
+		}
+		l.call(pe, false)
+	default:
+		panic(fmt.Sprintf("lowering a %s", reflect.TypeOf(s)))
+	}
+}
+
+// assign assigns the values of exprs to ids, declaring the ones that
+// haven't been. The values are all evaluated first, so that a, b = b, a
+// swaps a and b.
+func (l *lowerer) assign(ids []*parse.Ident, exprs []*parse.Expr) {
+	var vals []ir.Value
+	if len(ids) != len(exprs) {
+		for _, v := range l.results(exprs[0]) {
+			vals = append(vals, v)
+		}
+	} else {
+		for _, e := range exprs {
+			v := l.expr(e)
+			if _, ok := v.(*ir.Var); ok && len(exprs) > 1 {
+				t := l.temp()
+				l.emit(&ir.Assign{Dst: t, X: v, Type: irType(l.p.types[e])})
+				v = t
+			}
+			vals = append(vals, v)
+		}
+	}
+	for i, id := range ids {
+		l.store(id, vals[i])
+	}
+}
+
+// opAssign lowers x op= y.
+func (l *lowerer) opAssign(a *parse.Assign) {
+	id := assignedIdent(a.LeftExpr[0])
+	x := l.load(id)
+	y := l.expr(a.RightExpr[0])
+	t := l.temp()
+	l.emit(&ir.Assign{Dst: t, Op: strings.TrimSuffix(a.Op, "="), X: x, Y: y, Type: irType(l.p.types[a.LeftExpr[0]]), Pos: l.pos(a)})
+	l.store(id, t)
+}
+
+// assignedIdent returns the identifier that e, the left of an
+// assignment, consists of. The checker only lets identifiers through.
+func assignedIdent(e *parse.Expr) *parse.Ident {
+	id := identOf(e)
+	if id == nil {
+		panic(fmt.Sprintf("assigning to %s", exprString(e)))
+	}
+	return id
+}
+
+// identOf returns the identifier that e consists of, or nil.
+func identOf(e *parse.Expr) *parse.Ident {
+	if e.SecondN != nil || e.FirstN.Op != "" {
+		return nil
+	}
+	pe, ok := e.FirstN.Expr.(*parse.PrimaryE)
+	if !ok || pe.Prime != nil {
+		return nil
+	}
+	id, _ := pe.Expr.(*parse.Ident)
+	return id
+}
+
+// load returns the value of the variable id.
+func (l *lowerer) load(id *parse.Ident) ir.Value {
+	if g, ok := l.globals[id.Info]; ok {
+		t := l.temp()
+		l.emit(&ir.Load{Dst: t, Addr: g})
+		return t
+	}
+	return l.local(id.Info)
+}
+
+// store sets the variable id to v. Assigning to _ discards it.
+func (l *lowerer) store(id *parse.Ident, v ir.Value) {
+	if id.Name == "_" {
+		return
+	}
+	if g, ok := l.globals[id.Info]; ok {
+		l.emit(&ir.Store{Addr: g, Val: v})
+		return
+	}
+	l.emit(&ir.Assign{Dst: l.local(id.Info), X: v, Type: irType(id.Info.T)})
+}
+
+// ret returns from the function with the values of exprs, or of its
+// named results if there aren't any.
+func (l *lowerer) ret(exprs []*parse.Expr) {
+	var vals []ir.Value
+	switch {
+	case l.fn.Results == 0:
+	case len(exprs) == 0:
+		for _, v := range l.named {
+			vals = append(vals, v)
+		}
+	case len(exprs) < l.fn.Results:
+		// return f()
+		for _, v := range l.results(exprs[0]) {
+			vals = append(vals, v)
+		}
+	default:
+		for _, e := range exprs {
+			vals = append(vals, l.expr(e))
+		}
+	}
+	l.emit(&ir.Return{Vals: vals})
+}
+
+// ifStmt lowers the if statement s, and the else ifs and else that
+// follow it.
+func (l *lowerer) ifStmt(s *parse.IfStmt) {
+	l.stmt(s.SimpleStmt)
+	next := l.newLabel()
+	l.cond(s.Expr, next, false)
+	l.block(s.Body)
+	if s.Else == nil {
+		l.emit(next)
+		return
+	}
+	end := l.newLabel()
+	l.emit(&ir.Goto{Label: end})
+	l.emit(next)
+	switch e := s.Else.(type) {
+	case *parse.IfStmt:
+		l.ifStmt(e)
+	case *parse.Block:
+		l.block(e)
+	}
+	l.emit(end)
+}
+
+// forStmt lowers the for statement s. Go gives each iteration fresh
+// copies of the variables that the loop declares, but keeping one copy
+// is the same as long as nothing can take their address.
+func (l *lowerer) forStmt(s *parse.ForStmt) {
+	lp := &loop{cont: l.newLabel(), end: l.newLabel()}
+	if ls, ok := s.Up().(*parse.LabeledStmt); ok {
+		lp.label = ls.Label.Name
+	}
+	if r, ok := s.Clause.(*parse.RangeClause); ok {
+		l.rangeLoop(s, r, lp)
+		return
+	}
+	var cond, post parse.Node
+	switch c := s.Clause.(type) {
+	case *parse.ForClause:
+		l.stmt(c.InitStmt)
+		cond, post = c.Condition, c.PostStmt
+	case parse.Node:
+		cond = c
+	}
+	// the condition is at the bottom, so that each iteration only
+	// branches once
+	top, check := l.newLabel(), l.newLabel()
+	l.emit(&ir.Goto{Label: check})
+	l.emit(top)
+	l.loops = append(l.loops, lp)
+	l.block(s.Body)
+	l.loops = l.loops[:len(l.loops)-1]
+	l.emit(lp.cont)
+	l.stmt(post)
+	l.emit(check)
+	if cond == nil {
+		l.emit(&ir.Goto{Label: top})
+	} else {
+		l.cond(cond, top, true)
+	}
+	l.emit(lp.end)
+}
+
+// rangeLoop lowers the range loop s, whose clause is r. Only constant
+// strings can be ranged over so far; runtime.decoderune decodes their
+// runes as the loop goes.
+func (l *lowerer) rangeLoop(s *parse.ForStmt, r *parse.RangeClause, lp *loop) {
+	v, ok := l.p.consts[r.Expr]
+	if !ok || v.Kind() != constant.String {
+		// the checker only lets constant strings through
+		panic(fmt.Sprintf("ranging over %s", l.p.types[r.Expr]))
+	}
+	str := constant.StringVal(v)
+	var ids []*parse.Ident
+	switch r.Op {
+	case ":=":
+		ids = r.Idents
+	case "=":
+		for _, e := range r.Exprs {
+			ids = append(ids, assignedIdent(e))
+		}
+	}
+	// i is the index of the rune, and w its width
+	i, w := l.newVar(".i"), l.newVar(".w")
+	l.emit(&ir.Assign{Dst: i, X: ir.Const{}, Type: ir.Int32})
+	l.emit(&ir.Assign{Dst: w, X: ir.Const{}, Type: ir.Int32})
+	l.emit(lp.cont)
+	l.emit(&ir.Assign{Dst: i, Op: "+", X: i, Y: w, Type: ir.Int32})
+	more, p, n := l.temp(), l.temp(), l.temp()
+	l.emit(&ir.Assign{Dst: more, Op: "<", X: i, Y: ir.Const{Val: int64(len(str))}, Type: ir.Int32})
+	l.emit(&ir.IfZ{Cond: more, Label: lp.end})
+	l.emit(&ir.Assign{Dst: p, Op: "+", X: ir.Str{S: str}, Y: i, Type: ir.Uint32})
+	l.emit(&ir.Assign{Dst: n, Op: "-", X: ir.Const{Val: int64(len(str))}, Y: i, Type: ir.Int32})
+	var rn *ir.Var
+	if len(ids) > 1 {
+		rn = l.temp()
+	}
+	l.emit(&ir.Call{Dsts: []*ir.Var{rn, w}, Func: "runtime.decoderune", Args: []ir.Value{p, n}})
+	if len(ids) > 0 {
+		l.store(ids[0], i)
+	}
+	if len(ids) > 1 {
+		l.store(ids[1], rn)
+	}
+	l.loops = append(l.loops, lp)
+	l.block(s.Body)
+	l.loops = l.loops[:len(l.loops)-1]
+	l.emit(&ir.Goto{Label: lp.cont})
+	l.emit(lp.end)
+}
+
+// negated maps each comparison to the one that holds when it doesn't.
+var negated = map[string]string{
+	"==": "!=",
+	"!=": "==",
+	"<":  ">=",
+	">=": "<",
+	">":  "<=",
+	"<=": ">",
+}
+
+// expr lowers ex, returning its value. Booleans are 0 or 1.
+func (l *lowerer) expr(ex *parse.Expr) ir.Value {
+	return l.node(ex.Binary())
+}
+
+// node lowers the expression tree n, returning its value.
+func (l *lowerer) node(n parse.Node) ir.Value {
+	if v, ok := l.p.consts[n]; ok {
+		return constValue(v)
+	}
+	switch n := n.(type) {
+	case *parse.BinaryE:
+		if n.Op == "&&" || n.Op == "||" {
+			return l.boolean(n)
+		}
+		typ := l.p.types[n]
+		if ir.Comparison(n.Op) {
+			typ = l.operandType(n)
+		}
+		x := l.node(n.X)
+		y := l.node(n.Y)
+		if n.Op == "<<" || n.Op == ">>" {
+			l.checkShift(n.Y, y)
+		}
+		t := l.temp()
+		l.emit(&ir.Assign{Dst: t, Op: n.Op, X: x, Y: y, Type: irType(typ), Pos: l.pos(n)})
+		return t
+	case *parse.UnaryE:
+		switch n.Op {
+		case "":
+			return l.operand(n.Expr.(*parse.PrimaryE))
+		case "+":
+			return l.node(n.Expr)
+		case "-", "^", "!":
+			x := l.node(n.Expr)
+			t := l.temp()
+			l.emit(&ir.Assign{Dst: t, Op: n.Op, X: x, Type: irType(l.p.types[n]), Pos: l.pos(n)})
+			return t
+		}
+	}
+	panic(fmt.Sprintf("lowering %s", exprString(n)))
+}
+
+// checkShift panics if the shift count n, whose value is y, is negative.
+// The IR's counts are unsigned, so only signed counts need it, and the
+// checker has already rejected negative constants.
+func (l *lowerer) checkShift(n parse.Node, y ir.Value) {
+	typ := irType(l.p.types[n])
+	if _, ok := y.(ir.Const); ok || !typ.Signed() {
+		return
+	}
+	neg := l.temp()
+	ok := l.newLabel()
+	l.emit(&ir.Assign{Dst: neg, Op: "<", X: y, Y: ir.Const{Val: 0}, Type: typ})
+	l.emit(&ir.IfZ{Cond: neg, Label: ok})
+	l.emit(&ir.Call{Func: "runtime.panicshift"})
+	l.emit(ok)
+}
+
+// operandType returns the type of the operands of the comparison n,
+// one of which may be untyped.
+func (l *lowerer) operandType(n *parse.BinaryE) stable.Type {
+	typ := l.p.types[n.X]
+	if isUntyped(typ) {
+		typ = l.p.types[n.Y]
+	}
+	if b := basic(typ); b == nil || !(b.IsInteger() || b.IsBoolean()) {
+		panic(fmt.Sprintf("comparing values of type %s", typ))
+	}
+	return typ
+}
+
+// boolean lowers the boolean expression n by branching on it.
+func (l *lowerer) boolean(n parse.Node) ir.Value {
+	f, end := l.newLabel(), l.newLabel()
+	t := l.temp()
+	l.cond(n, f, false)
+	l.emit(&ir.Assign{Dst: t, X: ir.Const{Val: 1}, Type: ir.Bool})
+	l.emit(&ir.Goto{Label: end})
+	l.emit(f)
+	l.emit(&ir.Assign{Dst: t, X: ir.Const{Val: 0}, Type: ir.Bool})
+	l.emit(end)
+	return t
+}
+
+// cond jumps to to if the boolean expression n is jump. The right
+// operands of && and || are only evaluated if they decide the result.
+func (l *lowerer) cond(n parse.Node, to *ir.Label, jump bool) {
+	if v, ok := l.p.consts[n]; ok {
+		if constant.BoolVal(v) == jump {
+			l.emit(&ir.Goto{Label: to})
+		}
+		return
+	}
+	switch n := n.(type) {
+	case *parse.Expr:
+		l.cond(n.Binary(), to, jump)
+		return
+	case *parse.BinaryE:
+		switch {
+		case n.Op == "&&" || n.Op == "||":
+			// the value of the left operand that decides the result
+			decides := n.Op == "||"
+			if jump == decides {
+				l.cond(n.X, to, jump)
+				l.cond(n.Y, to, jump)
+				return
+			}
+			skip := l.newLabel()
+			l.cond(n.X, skip, decides)
+			l.cond(n.Y, to, jump)
+			l.emit(skip)
+			return
+		case ir.Comparison(n.Op):
+			// IfZ jumps if the comparison doesn't hold
+			op := n.Op
+			if jump {
+				op = negated[op]
+			}
+			typ := l.operandType(n)
+			x := l.node(n.X)
+			y := l.node(n.Y)
+			t := l.temp()
+			l.emit(&ir.Assign{Dst: t, Op: op, X: x, Y: y, Type: irType(typ)})
+			l.emit(&ir.IfZ{Cond: t, Label: to})
+			return
+		}
+	case *parse.UnaryE:
+		if n.Op == "!" {
+			l.cond(n.Expr, to, !jump)
+			return
+		}
+	}
+	v := l.node(n)
+	if jump {
+		t := l.temp()
+		l.emit(&ir.Assign{Dst: t, Op: "!", X: v, Type: ir.Bool})
+		v = t
+	}
+	l.emit(&ir.IfZ{Cond: v, Label: to})
+}
+
+// operand lowers the operand e, returning its value.
+func (l *lowerer) operand(e *parse.PrimaryE) ir.Value {
+	if v, ok := l.p.consts[e]; ok {
+		return constValue(v)
+	}
+	if arg, to := conversionOf(e); arg != nil {
+		from := l.p.types[arg]
+		if f, t := basic(from), basic(to); f == nil || t == nil || !f.IsInteger() || !t.IsInteger() {
+			// the checker only lets integer conversions through
+			panic(fmt.Sprintf("converting %s to %s", from, to))
+		}
+		x := l.expr(arg)
+		t := l.temp()
+		l.emit(&ir.Assign{Dst: t, Op: ir.Conv, X: x, Type: irType(to)})
+		return t
+	}
+	if label, _, _ := l.calledFunc(e); label != "" {
+		return l.call(e, true)[0]
+	}
+	if id, ok := e.Expr.(*parse.Ident); ok && e.Prime == nil {
+		return l.load(id)
+	}
+	panic(fmt.Sprintf("lowering %s", exprString(e)))
+}
+
+// conversionOf returns the operand of the conversion e and the type it's
+// converted to, or nil if e isn't a conversion.
+func conversionOf(e *parse.PrimaryE) (*parse.Expr, stable.Type) {
+	switch n := e.Expr.(type) {
+	case *parse.Conversion:
+		if e.Prime != nil {
+			break
+		}
+		if arg, ok := n.Expr.(*parse.Expr); ok {
+			return arg, typeOf(n.Typ)
+		}
+	case *parse.Ident:
+		if n.Info == nil || n.Info.Kind != stable.TypeName {
+			break
+		}
+		if e.Prime == nil || e.Prime.Prime != nil {
+			break
+		}
+		if c, ok := e.Prime.Expr.(*parse.Call); ok && c.Args != nil && len(c.Args.Exprs) == 1 {
+			return c.Args.Exprs[0], n.Info.T
+		}
+	}
+	return nil, nil
+}
+
+// calledFunc returns the label and type of the function that e calls,
+// and the arguments, or "" if e isn't a call of a function.
+func (l *lowerer) calledFunc(e *parse.PrimaryE) (string, *stable.Signature, []*parse.Expr) {
+	if e.Prime == nil || e.Prime.Prime != nil {
+		return "", nil, nil
+	}
+	call, ok := e.Prime.Expr.(*parse.Call)
+	if !ok {
+		return "", nil, nil
+	}
+	id, ok := e.Expr.(*parse.Ident)
+	if !ok || id.Info == nil || id.Info.Kind == stable.TypeName || id.Info.Kind == stable.Builtin {
+		return "", nil, nil
+	}
+	label, ok := l.funcs[id.Info]
+	if !ok {
+		panic(fmt.Sprintf("calling the function value %s", exprString(e)))
+	}
+	var args []*parse.Expr
+	if call.Args != nil {
+		args = call.Args.Exprs
+	}
+	return label, id.Info.T.(*stable.Signature), args
+}
+
+// callOf returns the call that the expression e consists of, or nil.
+func (l *lowerer) callOf(e *parse.Expr) *parse.PrimaryE {
+	if e.SecondN != nil || e.FirstN.Op != "" {
+		return nil
+	}
+	pe, ok := e.FirstN.Expr.(*parse.PrimaryE)
+	if !ok {
+		return nil
+	}
+	if label, _, _ := l.calledFunc(pe); label == "" {
+		return nil
+	}
+	return pe
+}
+
+// call lowers the call e of a function. If keep is set, it returns the
+// temporaries that hold the results; otherwise they're dropped.
+func (l *lowerer) call(e *parse.PrimaryE, keep bool) []*ir.Var {
+	label, sig, args := l.calledFunc(e)
+	if sig.Variadic {
+		panic(fmt.Sprintf("calling the variadic function %s", exprString(e)))
+	}
+	c := &ir.Call{Func: label}
+	if len(args) == 1 && len(sig.Params) > 1 {
+		// f(g()) passes the results of g
+		for _, v := range l.results(args[0]) {
+			c.Args = append(c.Args, v)
+		}
+	} else {
+		for _, a := range args {
+			c.Args = append(c.Args, l.expr(a))
+		}
+	}
+	for range sig.Results {
+		var t *ir.Var
+		if keep {
+			t = l.temp()
+		}
+		c.Dsts = append(c.Dsts, t)
+	}
+	l.emit(c)
+	return c.Dsts
+}
+
+// results lowers e, a call with multiple results, returning them.
+func (l *lowerer) results(e *parse.Expr) []*ir.Var {
+	pe := l.callOf(e)
+	if pe == nil {
+		panic(fmt.Sprintf("lowering the results of %s", exprString(e)))
+	}
+	return l.call(pe, true)
+}
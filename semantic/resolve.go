@@ -0,0 +1,635 @@
+package semantic
+
+import (
+	"github.com/samertm/chompy/parse"
+	"github.com/samertm/chompy/semantic/stable"
+)
+
+// resolveIdents binds every identifier in the package to its
+// declaration (by setting Ident.Info). Imports are looked up in
+// p.imports, which holds the packages that have already been checked.
+//
+// The scopes nest the same way they do in Go: the universe, then the
+// package, then the file (which holds the imports), then functions and
+// blocks. Every file shares the package scope.
+func resolveIdents(p *pkg) sErrors {
+	r := &resolver{
+		imports:    p.imports,
+		path:       p.path,
+		dotImports: make(map[string]map[*stable.NodeInfo]*stable.NodeInfo),
+	}
+	scope := stable.New(stable.Universe())
+	for _, t := range p.files {
+		r.file = t.Name
+		r.declarePkg(scope, t)
+	}
+	for _, t := range p.files {
+		r.file = t.Name
+		r.resolveFile(scope, t)
+		t.RootStable = scope
+	}
+	p.scope = scope
+	return r.errs
+}
+
+type resolver struct {
+	imports map[string]*stable.Pkg
+	// path is the import path of the package, for named types
+	path string
+	// file is the name of the file being resolved, for errors
+	file string
+	errs sErrors
+	// dotImports maps each file to the names that its dot imports
+	// declare, and those to the imports, so that using a name uses its
+	// import. The names are the imported package's own NodeInfos, which
+	// other files may import too.
+	dotImports map[string]map[*stable.NodeInfo]*stable.NodeInfo
+}
+
+func (r *resolver) errorf(n parse.Node, format string, a ...interface{}) {
+	r.errs = append(r.errs, errorAt(r.file, n, format, a...))
+}
+
+// declare adds id to the scope s. Blank identifiers are never added.
+func (r *resolver) declare(s *stable.Stable, id *parse.Ident, kind stable.Kind) {
+	ni := &stable.NodeInfo{Kind: kind, Name: id.Name}
+	id.Info = ni
+	if id.Name == "_" {
+		return
+	}
+	if _, ok := s.LookupLocal(id.Name); ok {
+		r.errorf(id, "%s redeclared in this block", id.Name)
+		return
+	}
+	s.Insert(id.Name, ni)
+}
+
+// declareType declares the named type id. Its declaration is filled in
+// by typeSpec.
+func (r *resolver) declareType(s *stable.Stable, id *parse.Ident) {
+	r.declare(s, id, stable.TypeName)
+	path := r.path
+	if path == "main" {
+		path = ""
+	}
+	id.Info.T = stable.NewNamed(path, id.Name, nil)
+}
+
+// typeSpec resolves the type that ts declares its name as.
+func (r *resolver) typeSpec(s *stable.Stable, ts *parse.Typespec) {
+	r.typ(s, ts.Typ)
+	if n, ok := ts.I.Info.T.(*stable.Named); ok {
+		n.SetDecl(typeOf(ts.Typ))
+	}
+}
+
+// declarePkg adds all of the top level declarations of t to the
+// package scope. This happens before any bodies are resolved, so that
+// declarations can refer to each other in any order.
+func (r *resolver) declarePkg(pkg *stable.Stable, t *parse.Tree) {
+	for _, kid := range t.Kids {
+		switch n := kid.(type) {
+		case *parse.Funcdecl:
+			if n.Name.Name == "init" {
+				// init can't be referred to, so it isn't declared.
+				n.Name.Info = &stable.NodeInfo{Kind: stable.Func, Name: "init"}
+				continue
+			}
+			r.declare(pkg, n.Name, stable.Func)
+		case *parse.Vars:
+			for _, v := range n.Vs {
+				for _, id := range v.Idents {
+					r.declare(pkg, id, stable.Var)
+				}
+			}
+		case *parse.Consts:
+			for _, c := range n.Cs {
+				for _, id := range c.Is {
+					r.declare(pkg, id, stable.Const)
+				}
+			}
+		case *parse.Types:
+			for _, ts := range n.Typspecs {
+				r.declareType(pkg, ts.I)
+			}
+		}
+	}
+}
+
+// resolveFile resolves the imports and the bodies of the top level
+// declarations of t.
+func (r *resolver) resolveFile(pkg *stable.Stable, t *parse.Tree) {
+	file := stable.New(pkg)
+	for _, kid := range t.Kids {
+		if impts, ok := kid.(*parse.Impts); ok {
+			for _, i := range impts.Imports {
+				r.importSpec(pkg, file, i)
+			}
+		}
+	}
+	for _, kid := range t.Kids {
+		switch n := kid.(type) {
+		case *parse.Funcdecl:
+			r.function(file, n.Func)
+			if n.Name.Info != nil && n.Func != nil {
+				n.Name.Info.T = signatureOf(n.Func.Sig)
+			}
+		case *parse.Vars:
+			for _, v := range n.Vs {
+				r.varspec(file, v)
+			}
+		case *parse.Consts:
+			for _, c := range n.Cs {
+				r.cnst(file, c)
+			}
+		case *parse.Types:
+			for _, ts := range n.Typspecs {
+				r.typeSpec(file, ts)
+			}
+		}
+	}
+}
+
+// importSpec adds the import i to the file scope.
+func (r *resolver) importSpec(pkg, file *stable.Stable, i *parse.Impt) {
+	p, ok := r.imports[i.ImptName]
+	if !ok {
+		r.errorf(i, "could not import %q", i.ImptName)
+		return
+	}
+	switch i.PkgName {
+	case "_":
+		// only imported for its side effects
+	case ".":
+		// every exported name is declared in the file scope
+		i.Info = &stable.NodeInfo{Kind: stable.Package, Name: ".", Pkg: p}
+		for _, name := range p.Scope.Names() {
+			if !stable.IsExported(name) {
+				continue
+			}
+			ni, _ := p.Scope.LookupLocal(name)
+			if _, ok := pkg.LookupLocal(name); ok {
+				r.errorf(i, "%s redeclared during import %q", name, i.ImptName)
+				continue
+			}
+			file.Insert(name, ni)
+			if r.dotImports[r.file] == nil {
+				r.dotImports[r.file] = make(map[*stable.NodeInfo]*stable.NodeInfo)
+			}
+			r.dotImports[r.file][ni] = i.Info
+		}
+	default:
+		name := i.PkgName
+		if name == "" {
+			name = p.Name
+		}
+		if _, ok := pkg.LookupLocal(name); ok {
+			r.errorf(i, "%s redeclared as imported package name", name)
+			return
+		}
+		if _, ok := file.LookupLocal(name); ok {
+			r.errorf(i, "%s redeclared as imported package name", name)
+			return
+		}
+		i.Info = &stable.NodeInfo{Kind: stable.Package, Name: name, Pkg: p}
+		file.Insert(name, i.Info)
+	}
+}
+
+func (r *resolver) function(s *stable.Stable, f *parse.Func) {
+	if f == nil {
+		return
+	}
+	// The parameters, the results and the top level of the body share
+	// a scope.
+	fs := stable.New(s)
+	if f.Sig != nil {
+		for _, p := range f.Sig.Params {
+			r.param(fs, p)
+		}
+		if res := f.Sig.Result; res != nil {
+			for _, p := range res.Params {
+				r.param(fs, p)
+			}
+			if res.Typ != nil {
+				r.typ(s, res.Typ)
+			}
+		}
+	}
+	if f.Body != nil {
+		r.stmts(fs, f.Body.Stmts)
+	}
+}
+
+// signatureOf returns the type of a function with the resolved
+// signature sig.
+func signatureOf(sig *parse.Sig) *stable.Signature {
+	f := &stable.Signature{}
+	if sig == nil {
+		return f
+	}
+	f.Params = paramTypes(sig.Params)
+	if res := sig.Result; res != nil {
+		if res.Typ != nil {
+			f.Results = []stable.Type{typeOf(res.Typ)}
+		} else {
+			f.Results = paramTypes(res.Params)
+		}
+	}
+	return f
+}
+
+// paramTypes returns the type of each parameter in params.
+func paramTypes(params []*parse.Param) []stable.Type {
+	var types []stable.Type
+	for _, p := range params {
+		// unnamed parameters have no idents
+		n := len(p.Idents)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			types = append(types, typeOf(p.Typ))
+		}
+	}
+	return types
+}
+
+func (r *resolver) param(s *stable.Stable, p *parse.Param) {
+	r.typ(s, p.Typ)
+	for _, id := range p.Idents {
+		r.declare(s, id, stable.Var)
+	}
+	setTypes(p.Idents, p.Typ)
+}
+
+// typ resolves the type names in t.
+func (r *resolver) typ(s *stable.Stable, t *parse.Typ) {
+	if t == nil {
+		return
+	}
+	var id *parse.Ident
+	switch n := t.T.(type) {
+	case *parse.Ident:
+		id = n
+	case *parse.SliceType:
+		r.typ(s, n.Elem)
+		return
+	case *parse.PointerType:
+		r.typ(s, n.Elem)
+		return
+	case *parse.MapType:
+		r.typ(s, n.Key)
+		r.typ(s, n.Elem)
+		return
+	default:
+		return
+	}
+	var ni *stable.NodeInfo
+	if id.Pkg != "" {
+		ni = r.qualified(s, id)
+	} else {
+		ni = r.lookup(s, id, id.Name)
+	}
+	if ni == nil {
+		return
+	}
+	if ni.Kind != stable.TypeName {
+		r.errorf(id, "%s is not a type", qualifiedName(id))
+		return
+	}
+	id.Info = ni
+}
+
+// typeOf returns the type that a resolved parse.Typ stands for, or nil.
+func typeOf(t *parse.Typ) stable.Type {
+	if t == nil {
+		return nil
+	}
+	switch n := t.T.(type) {
+	case *parse.Ident:
+		if n.Info != nil {
+			return n.Info.T
+		}
+	case *parse.SliceType:
+		if elem := typeOf(n.Elem); elem != nil {
+			return &stable.Slice{Elem: elem}
+		}
+	case *parse.PointerType:
+		if elem := typeOf(n.Elem); elem != nil {
+			return &stable.Pointer{Elem: elem}
+		}
+	case *parse.MapType:
+		key, elem := typeOf(n.Key), typeOf(n.Elem)
+		if key != nil && elem != nil {
+			return &stable.Map{Key: key, Elem: elem}
+		}
+	}
+	return nil
+}
+
+func qualifiedName(id *parse.Ident) string {
+	if id.Pkg == "" {
+		return id.Name
+	}
+	return id.Pkg + "." + id.Name
+}
+
+// lookup finds name in s, and reports an error if it isn't there.
+func (r *resolver) lookup(s *stable.Stable, id *parse.Ident, name string) *stable.NodeInfo {
+	if name == "_" {
+		r.errorf(id, "cannot use _ as value")
+		return nil
+	}
+	ni, ok := s.Lookup(name)
+	if !ok {
+		r.errorf(id, "undefined: %s", name)
+		return nil
+	}
+	r.use(ni)
+	return ni
+}
+
+// use records that ni has been referred to.
+func (r *resolver) use(ni *stable.NodeInfo) {
+	ni.Used = true
+	if imp, ok := r.dotImports[r.file][ni]; ok {
+		imp.Used = true
+	}
+}
+
+// qualified resolves a QualifiedIdent (pkg.Name) where pkg must be an
+// import.
+func (r *resolver) qualified(s *stable.Stable, id *parse.Ident) *stable.NodeInfo {
+	ni := r.lookup(s, id, id.Pkg)
+	if ni == nil {
+		return nil
+	}
+	if ni.Kind != stable.Package {
+		r.errorf(id, "%s is not a package", id.Pkg)
+		return nil
+	}
+	if !stable.IsExported(id.Name) {
+		r.errorf(id, "cannot refer to unexported name %s.%s", id.Pkg, id.Name)
+		return nil
+	}
+	target, ok := ni.Pkg.Scope.LookupLocal(id.Name)
+	if !ok {
+		r.errorf(id, "undefined: %s.%s", id.Pkg, id.Name)
+		return nil
+	}
+	id.Info = target
+	return target
+}
+
+// varspec resolves the type and initializers of v. The idents must
+// already be declared.
+func (r *resolver) varspec(s *stable.Stable, v *parse.Varspec) {
+	r.typ(s, v.T)
+	r.exprs(s, v.Exprs)
+	setTypes(v.Idents, v.T)
+}
+
+// cnst resolves the type and values of c. The idents must already be
+// declared.
+func (r *resolver) cnst(s *stable.Stable, c *parse.Cnst) {
+	r.typ(s, c.T)
+	r.exprs(s, c.Es)
+	setTypes(c.Is, c.T)
+}
+
+// setTypes records the declared type t on each of the declared idents.
+func setTypes(ids []*parse.Ident, t *parse.Typ) {
+	for _, id := range ids {
+		if id.Info != nil {
+			id.Info.T = typeOf(t)
+		}
+	}
+}
+
+func (r *resolver) stmts(s *stable.Stable, stmts []parse.Node) {
+	for _, stmt := range stmts {
+		r.stmt(s, stmt)
+	}
+}
+
+func (r *resolver) stmt(s *stable.Stable, stmt parse.Node) {
+	switch n := stmt.(type) {
+	case nil:
+	case *parse.Vars:
+		for _, v := range n.Vs {
+			// the initializers can't see the new variables
+			r.typ(s, v.T)
+			r.exprs(s, v.Exprs)
+			for _, id := range v.Idents {
+				r.declare(s, id, stable.Var)
+			}
+			setTypes(v.Idents, v.T)
+		}
+	case *parse.Consts:
+		for _, c := range n.Cs {
+			r.typ(s, c.T)
+			r.exprs(s, c.Es)
+			for _, id := range c.Is {
+				r.declare(s, id, stable.Const)
+			}
+			setTypes(c.Is, c.T)
+		}
+	case *parse.Types:
+		for _, ts := range n.Typspecs {
+			// the type is in scope in its own declaration
+			r.declareType(s, ts.I)
+			r.typeSpec(s, ts)
+		}
+	case *parse.Block:
+		r.stmts(stable.New(s), n.Stmts)
+	case *parse.LabeledStmt:
+		r.stmt(s, n.Stmt)
+	case *parse.ExprStmt:
+		r.expr(s, n.Expr)
+	case *parse.Expr:
+		r.expr(s, n)
+	case *parse.SendStmt:
+		r.expr(s, n.Chan)
+		r.expr(s, n.Expr)
+	case *parse.IncDecStmt:
+		r.expr(s, n.Expr)
+	case *parse.Assign:
+		for _, e := range n.LeftExpr {
+			if id := blank(e); id != nil && n.Op == "=" {
+				// assigning to _ discards the value
+				id.Info = &stable.NodeInfo{Kind: stable.Var, Name: "_"}
+				continue
+			}
+			if n.Op == "=" {
+				r.assignee(s, e)
+				continue
+			}
+			// x op= y reads x
+			r.expr(s, e)
+		}
+		r.exprs(s, n.RightExpr)
+	case *parse.ShortVarDecl:
+		for _, e := range n.Exprs {
+			r.expr(s, e)
+		}
+		seen := make(map[string]bool)
+		var fresh bool
+		for _, id := range n.Idents {
+			if seen[id.Name] && id.Name != "_" {
+				r.errorf(id, "%s repeated on left side of :=", id.Name)
+			}
+			seen[id.Name] = true
+			if ni, ok := s.LookupLocal(id.Name); ok {
+				// redeclaration assigns to the existing variable
+				id.Info = ni
+				continue
+			}
+			r.declare(s, id, stable.Var)
+			fresh = fresh || id.Name != "_"
+		}
+		if !fresh {
+			r.errorf(n, "no new variables on left side of :=")
+		}
+	case *parse.IfStmt:
+		is := stable.New(s)
+		r.stmt(is, n.SimpleStmt)
+		r.expr(is, n.Expr)
+		if n.Body != nil {
+			r.stmts(stable.New(is), n.Body.Stmts)
+		}
+		r.stmt(is, n.Else)
+	case *parse.ForStmt:
+		fs := stable.New(s)
+		switch c := n.Clause.(type) {
+		case *parse.ForClause:
+			r.stmt(fs, c.InitStmt)
+			r.expr(fs, c.Condition)
+			r.stmt(fs, c.PostStmt)
+		case *parse.RangeClause:
+			r.expr(fs, c.Expr)
+			for _, e := range c.Exprs {
+				r.assignee(fs, e)
+			}
+			for _, id := range c.Idents {
+				r.declare(fs, id, stable.Var)
+			}
+		default:
+			r.expr(fs, c)
+		}
+		if n.Body != nil {
+			r.stmts(stable.New(fs), n.Body.Stmts)
+		}
+	case *parse.GoStmt:
+		r.expr(s, n.Expr)
+	case *parse.DeferStmt:
+		r.expr(s, n.Expr)
+	case *parse.ReturnStmt:
+		r.exprs(s, n.Exprs)
+	}
+}
+
+// assignee resolves e, which is being assigned to. If e is a variable,
+// the assignment isn't a use of it.
+func (r *resolver) assignee(s *stable.Stable, e *parse.Expr) {
+	id := plainIdent(e)
+	if id == nil {
+		r.expr(s, e)
+		return
+	}
+	ni, ok := s.Lookup(id.Name)
+	used := ok && ni.Used
+	r.expr(s, e)
+	if ok && ni.Kind == stable.Var {
+		ni.Used = used
+	}
+}
+
+// blank returns the identifier that e consists of if it's just "_".
+func blank(e *parse.Expr) *parse.Ident {
+	if id := plainIdent(e); id != nil && id.Name == "_" {
+		return id
+	}
+	return nil
+}
+
+// plainIdent returns the identifier that e consists of, if it's just
+// an unqualified identifier.
+func plainIdent(e *parse.Expr) *parse.Ident {
+	if e == nil || e.SecondN != nil || e.FirstN == nil || e.FirstN.Op != "" {
+		return nil
+	}
+	pe, ok := e.FirstN.Expr.(*parse.PrimaryE)
+	if !ok || pe.Prime != nil {
+		return nil
+	}
+	id, ok := pe.Expr.(*parse.Ident)
+	if !ok || id.Pkg != "" {
+		return nil
+	}
+	return id
+}
+
+func (r *resolver) exprs(s *stable.Stable, exprs []*parse.Expr) {
+	for _, e := range exprs {
+		r.expr(s, e)
+	}
+}
+
+// expr resolves every identifier in the expression n.
+func (r *resolver) expr(s *stable.Stable, n parse.Node) {
+	if n == nil {
+		return
+	}
+	parse.Inspect(n, func(n parse.Node) bool {
+		switch e := n.(type) {
+		case *parse.PrimaryE:
+			if id, ok := e.Expr.(*parse.Ident); ok {
+				// ident needs the PrimaryE to split up selectors
+				r.ident(s, e, id)
+				if e.Prime != nil {
+					r.expr(s, e.Prime)
+				}
+				return false
+			}
+		case *parse.Ident:
+			r.ident(s, nil, e)
+		case *parse.Selector:
+			// field names depend on types, which aren't known yet
+			return false
+		case *parse.Typ:
+			r.typ(s, e)
+			return false
+		}
+		return true
+	})
+}
+
+// ident resolves an identifier used as an operand. If the identifier
+// was parsed as a QualifiedIdent but the qualifier isn't an import, the
+// second half is moved into a Selector on pe.
+func (r *resolver) ident(s *stable.Stable, pe *parse.PrimaryE, id *parse.Ident) {
+	if id.Pkg == "" {
+		id.Info = r.lookup(s, id, id.Name)
+		return
+	}
+	ni, ok := s.Lookup(id.Pkg)
+	if ok && ni.Kind != stable.Package && pe != nil {
+		r.use(ni)
+		// The parser only kept the position of the qualifier; the
+		// name is assumed to follow the "." directly.
+		pos := id.Pos
+		pos.Col += len(id.Pkg) + 1
+		sel := &parse.PrimaryE{
+			Expr:  &parse.Selector{Ident: &parse.Ident{Name: id.Name, Pos: pos}},
+			Prime: pe.Prime,
+		}
+		pe.Prime = sel
+		sel.SetUp(pe)
+		parse.SetParents(sel)
+		id.Name, id.Pkg = id.Pkg, ""
+		id.Info = ni
+		return
+	}
+	r.qualified(s, id)
+}
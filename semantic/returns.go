@@ -0,0 +1,136 @@
+package semantic
+
+import (
+	"github.com/samertm/chompy/parse"
+)
+
+// checkReturns reports functions with results whose bodies can reach
+// their closing brace, using the terminating statements from the spec.
+// Statements that follow a terminating statement can never run, which
+// is worth a warning but isn't an error.
+func checkReturns(p *pkg) sErrors {
+	var errs sErrors
+	for _, t := range p.files {
+		for _, kid := range t.Kids {
+			f, ok := kid.(*parse.Funcdecl)
+			if !ok || f.Func == nil || f.Func.Body == nil {
+				continue
+			}
+			body := f.Func.Body
+			if sig := f.Func.Sig; sig != nil && sig.Result != nil && !terminatingList(body.Stmts) {
+				errs = append(errs, errorAtPos(t.Name, body.Rbrace, "missing return"))
+			}
+			parse.Inspect(body, func(n parse.Node) bool {
+				if b, ok := n.(*parse.Block); ok {
+					if s := unreachable(b.Stmts); s != nil {
+						p.warnings = append(p.warnings, errorAt(t.Name, s, "unreachable code"))
+					}
+				}
+				return true
+			})
+		}
+	}
+	return errs
+}
+
+// unreachable returns the first statement in stmts that follows a
+// terminating statement, or nil. A labeled statement can still be
+// reached with goto.
+func unreachable(stmts []parse.Node) parse.Node {
+	for i, s := range stmts {
+		if !terminating(s) {
+			continue
+		}
+		for _, next := range stmts[i+1:] {
+			switch next.(type) {
+			case nil, *parse.EmptyStmt:
+				continue
+			case *parse.LabeledStmt:
+				return nil
+			}
+			return next
+		}
+		return nil
+	}
+	return nil
+}
+
+// terminatingList reports whether a statement list ends in a
+// terminating statement. Empty statements at the end don't count.
+func terminatingList(stmts []parse.Node) bool {
+	for i := len(stmts) - 1; i >= 0; i-- {
+		switch stmts[i].(type) {
+		case nil, *parse.EmptyStmt:
+			continue
+		}
+		return terminating(stmts[i])
+	}
+	return false
+}
+
+// terminating reports whether s is a terminating statement: control
+// never flows from it to the next statement. Switch and select
+// statements aren't parsed yet.
+func terminating(s parse.Node) bool {
+	switch s := s.(type) {
+	case *parse.ReturnStmt, *parse.GotoStmt:
+		return true
+	case *parse.ExprStmt:
+		return isPanic(s.Expr)
+	case *parse.Expr:
+		return isPanic(s)
+	case *parse.Block:
+		return terminatingList(s.Stmts)
+	case *parse.IfStmt:
+		if s.Else == nil || s.Body == nil {
+			return false
+		}
+		return terminatingList(s.Body.Stmts) && terminating(s.Else)
+	case *parse.ForStmt:
+		if s.Clause != nil {
+			c, ok := s.Clause.(*parse.ForClause)
+			if !ok || c.Condition != nil {
+				return false
+			}
+		}
+		return !hasBreak(s)
+	case *parse.LabeledStmt:
+		return terminating(s.Stmt)
+	}
+	return false
+}
+
+// isPanic reports whether n is a call to the built-in panic.
+func isPanic(n parse.Node) bool {
+	return calledBuiltin(n) == "panic"
+}
+
+// hasBreak reports whether the body of the for statement f has a break
+// that refers to f: either unlabeled and not inside a nested loop, or
+// labeled with f's label.
+func hasBreak(f *parse.ForStmt) bool {
+	var label string
+	if l, ok := f.Up().(*parse.LabeledStmt); ok && l.Label != nil {
+		label = l.Label.Name
+	}
+	found := false
+	var visit func(n parse.Node, nested bool)
+	visit = func(n parse.Node, nested bool) {
+		parse.Inspect(n, func(n parse.Node) bool {
+			switch n := n.(type) {
+			case *parse.BreakStmt:
+				if n.Label == nil && !nested || n.Label != nil && n.Label.Name == label {
+					found = true
+				}
+			case *parse.ForStmt:
+				if n != f {
+					visit(n.Body, true)
+					return false
+				}
+			}
+			return !found
+		})
+	}
+	visit(f.Body, false)
+	return found
+}
@@ -0,0 +1,116 @@
+package semantic
+
+import (
+	"fmt"
+
+	"github.com/samertm/chompy/ir"
+	"github.com/samertm/chompy/parse"
+	"github.com/samertm/chompy/semantic/constant"
+)
+
+// The built-in functions are lowered to calls of the runtime, which the
+// backend provides:
+//
+//	runtime.write(fd, p, n)       writes the n bytes at p to fd
+//	runtime.printint(fd, i)       writes the signed integer i in decimal
+//	runtime.printuint(fd, u)      writes the unsigned integer u in decimal
+//	runtime.exit(code)            exits with the status code
+//	runtime.decoderune(p, n)      decodes the UTF-8 encoded rune at p,
+//	                              which has n bytes left, returning the
+//	                              rune and its width
+//	runtime.panicshift()          panics with a negative shift amount
+
+// callArgs returns the arguments of the call n.
+func callArgs(n parse.Node) []*parse.Expr {
+	if e, ok := n.(*parse.Expr); ok {
+		n = e.Binary()
+	}
+	pe := n.(*parse.UnaryE).Expr.(*parse.PrimaryE)
+	var args *parse.Args
+	switch e := pe.Expr.(type) {
+	case *parse.Builtin:
+		args = e.Args
+	default:
+		args = pe.Prime.Expr.(*parse.Call).Args
+	}
+	if args == nil {
+		return nil
+	}
+	return args.Exprs
+}
+
+// builtinCall lowers a call to a built-in function that's used as a
+// statement.
+func (l *lowerer) builtinCall(name string, args []*parse.Expr) {
+	switch name {
+	case "print", "println":
+		l.print(1, args, name == "println")
+		if name == "println" {
+			l.writeString(1, "\n")
+		}
+	case "panic":
+		l.panic(args[0])
+	default:
+		// the checker reports the rest
+		panic("lowering " + name)
+	}
+}
+
+// panic prints the value of e to standard error, and exits with status
+// 2, like Go does when nothing recovers.
+func (l *lowerer) panic(e *parse.Expr) {
+	l.writeString(2, "panic: ")
+	l.print(2, []*parse.Expr{e}, false)
+	l.writeString(2, "\n")
+	l.emit(&ir.Call{Func: "runtime.exit", Args: []ir.Value{ir.Const{Val: 2}}})
+}
+
+// print writes the values of args to the file descriptor fd, separated
+// by spaces if spaced is set.
+func (l *lowerer) print(fd int, args []*parse.Expr, spaced bool) {
+	for i, a := range args {
+		if i > 0 && spaced {
+			l.writeString(fd, " ")
+		}
+		if v, ok := l.p.consts[a]; ok {
+			switch v.Kind() {
+			case constant.String:
+				l.writeString(fd, constant.StringVal(v))
+			case constant.Bool, constant.Int:
+				l.writeString(fd, v.String())
+			default:
+				panic(fmt.Sprintf("printing %s", v))
+			}
+			continue
+		}
+		typ := basic(l.p.types[a])
+		switch {
+		case typ != nil && typ.IsInteger():
+			l.printInt(fd, l.expr(a), typ.IsUnsigned())
+		case typ != nil && typ.IsBoolean():
+			f, end := l.newLabel(), l.newLabel()
+			l.emit(&ir.IfZ{Cond: l.expr(a), Label: f})
+			l.writeString(fd, "true")
+			l.emit(&ir.Goto{Label: end})
+			l.emit(f)
+			l.writeString(fd, "false")
+			l.emit(end)
+		default:
+			panic(fmt.Sprintf("printing %s", exprString(a)))
+		}
+	}
+}
+
+// printInt writes the integer v to the file descriptor fd.
+func (l *lowerer) printInt(fd int, v ir.Value, unsigned bool) {
+	f := "runtime.printint"
+	if unsigned {
+		f = "runtime.printuint"
+	}
+	l.emit(&ir.Call{Func: f, Args: []ir.Value{ir.Const{Val: int64(fd)}, v}})
+}
+
+// writeString writes the constant s to the file descriptor fd.
+func (l *lowerer) writeString(fd int, s string) {
+	l.emit(&ir.Call{Func: "runtime.write", Args: []ir.Value{ir.Const{Val: int64(fd)}, ir.Str{S: s}, ir.Const{Val: int64(len(s))}}})
+}
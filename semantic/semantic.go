@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"reflect"
-	"strconv"
+	"os"
 
+	"github.com/samertm/chompy/ir"
+	"github.com/samertm/chompy/lex"
 	"github.com/samertm/chompy/parse"
+	"github.com/samertm/chompy/semantic/constant"
 	"github.com/samertm/chompy/semantic/stable"
 )
 
@@ -16,12 +18,10 @@ var _ = fmt.Println // debugging
 
 type sErrors []string
 
-var currentLabel int = 2
-
-func nextLabel() []byte {
-	l := bprintf(".L%d", currentLabel)
-	currentLabel++
-	return l
+// Warn is called with each warning about a package that compiles, like
+// code that can never run. By default it prints to standard error.
+var Warn = func(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
 }
 
 func (e sErrors) Error() string {
@@ -38,239 +38,80 @@ func (e sErrors) Error() string {
 	return string(str)
 }
 
-func Gen(n parse.Node) ([]byte, error) {
-	t, err := check(n)
-	if err != nil {
-		return nil, err
-	}
-	return genCode(t), nil
+// errorAt formats an error about the node n, which is in the file
+// called file.
+func errorAt(file string, n parse.Node, format string, a ...interface{}) string {
+	return errorAtPos(file, parse.Position(n), format, a...)
 }
 
-// check is the "main" method for the semanic package. It runs all
-// of the semanic checks and generates the IR for the backend.
-func check(n parse.Node) (*parse.Tree, error) {
-	t, ok := n.(*parse.Tree)
-	if !ok {
-		return nil, errors.New("Needed a tree.")
+// errorAtPos is errorAt for a position that doesn't belong to a node.
+func errorAtPos(file string, pos lex.Pos, format string, a ...interface{}) string {
+	var where string
+	if file != "" {
+		where = file + ":"
 	}
-	errs := treeWalks(t)
-	if len(errs) != 0 {
-		return nil, errs
+	if pos.IsValid() {
+		where += pos.String() + ":"
 	}
-	return t, nil
-}
-
-// Only deals with main.main right now.
-func genCode(t *parse.Tree) []byte {
-	code := emitStart()
-	for _, node := range t.Kids {
-		switch n := node.(type) {
-		case *parse.Funcdecl:
-			name := n.Name.Name
-			code = append(code, emitFuncHeader(name)...)
-			code = append(code, emitBlock(nil, n.Func.Body)...)
-			code = append(code, emitFuncReturn()...)
-		}
+	if where != "" {
+		where += " "
 	}
-	return code
+	return where + fmt.Sprintf(format, a...)
 }
 
-func emitStart() []byte {
-	code := emitFuncHeader("_start")
-	code = append(code, "\tmov\tr0, #0\n"+
-		"\tbl\tmain\n"+
-		"\tmov\tr7, #1\n"+
-		"\tswi\t#0\n"...)
-	return code
+// pkg is what the semantic checks run over: all of the files of a
+// single package.
+type pkg struct {
+	path    string
+	name    string
+	files   []*parse.Tree
+	imports map[string]*stable.Pkg
+	// filled in by resolveIdents
+	scope *stable.Stable
+	// filled in by typeCheck
+	types  map[parse.Node]stable.Type
+	consts map[parse.Node]constant.Value
+	// filled in by initOrder
+	inits []*initializer
+	// warnings don't stop the package from compiling
+	warnings []string
 }
 
-func emitBlock(table *stable.Stable, b *parse.Block) []byte {
-	t := stable.New(table)
-	var code []byte
-	var stackOffset int
-	for _, stmt := range b.Stmts {
-		code = append(code, emitEvalStmt(t, stmt, &stackOffset)...)
+// Gen checks the files of the package with the import path path and
+// lowers them to IR. imports maps import paths to the packages that the
+// files may import; it may be nil. The returned Pkg is what packages
+// that import this one should be given.
+func Gen(path string, files []*parse.Tree, imports map[string]*stable.Pkg) (*ir.Package, *stable.Pkg, error) {
+	p, err := check(path, files, imports)
+	if err != nil {
+		return nil, nil, err
 	}
-	// Add stack setup to the beginning
-	code = append(emitFuncStackSetup(stackOffset), code...)
-	code = append(code, "\tpop\t{r7}\n"...)
-	return code
-}
-
-// TODO: clean up use of stackOffset (move it into stable?) [Issue: https://github.com/samertm/chompy/issues/12]
-func emitEvalStmt(t *stable.Stable, stmt parse.Node, stackOffset *int) []byte {
-	var code []byte
-	switch s := stmt.(type) {
-	case *parse.Vars:
-		for _, v := range s.Vs {
-			for _, id := range v.Idents {
-				// Assume the type is an int
-				*stackOffset += 4
-				typ := &stable.Basic{Name: "int", Size: 4}
-				t.Insert(id.Name, &stable.NodeInfo{T: typ, StackOffset: *stackOffset})
-			}
-		}
-	case *parse.Assign:
-		if len(s.LeftExpr) != len(s.RightExpr) {
-			log.Fatal("args must match, and you can only have one argument on each side.")
-		}
-		switch s.Op {
-		case "=":
-			return emitFuncAssignment(t, s)
-		}
-		return []byte("")
-	case *parse.ReturnStmt:
-		if len(s.Exprs) == 0 {
-			code = append(code, "\tmov\tr0, #0\n"...)
-			code = append(code, emitFuncReturn()...)
-			return code
-		} else if len(s.Exprs) > 1 {
-			log.Fatalf("I don't handle more than one return value: %s\n", s)
-		}
-		code = append(code, emitEvalExpr(t, s.Exprs[0])...)
-		code = append(code, "\tmov\tr0, r6\n"...)
-		code = append(code, emitFuncReturn()...)
-	case *parse.IfStmt:
-		if s.SimpleStmt != nil {
-			code = append(code, emitEvalStmt(t, s.SimpleStmt, stackOffset)...)
-		}
-		// TODO: check that the Expr is a comparison expression [Issue: https://github.com/samertm/chompy/issues/13]
-		code = append(code, emitEvalExpr(t, s.Expr)...)
-		l := nextLabel()
-		switch s.Expr.BinOp {
-		case "==":
-			code = append(code, bprintf("\tbne\t%s\n", l)...)
-		case "<":
-			code = append(code, bprintf("\tblt\t%s\n", l)...)
-		default:
-			log.Fatal("I don't handle that comparator")
-		}
-		if s.Else != nil {
-			// TODO: handle else statements [Issue: https://github.com/samertm/chompy/issues/14]
-			log.Fatal("I don't handle else statements yet")
-		}
-		code = append(code, emitBlock(t, s.Body)...)
-		code = append(code, bprintf("%s:\n", l)...)
-	case *parse.ForStmt:
-		lClause := nextLabel()
-		lBody := nextLabel()
-		code = append(code, bprintf("\tb\t%s\n" +
-			"%s:\n", lClause, lBody)...)
-		// emit body code
-		if _, ok := s.Clause.(*parse.Expr); !ok {
-			log.Fatal("clause was not an expression")
-		}
-		code = append(code, emitBlock(t, s.Body)...)
-		code = append(code, bprintf("%s:\n", lClause)...)
-		// emit comparator code
-		code = append(code, emitEvalExpr(t, s.Clause.(*parse.Expr))...)
-		switch s.Clause.(*parse.Expr).BinOp {
-		case "==":
-			code = append(code, bprintf("\tbne\t%s\n", lBody)...)
-		case "<":
-			code = append(code, bprintf("\tblt\t%s\n", lBody)...)
-		default:
-			log.Fatal("I don't handle that comparator")
-		}
-	default:
-		log.Fatalf("I don't handle %s yet\n", reflect.TypeOf(s))
+	for _, w := range p.warnings {
+		Warn(w)
 	}
-	return code
-}
-
-func bprintf(format string, a ...interface{}) []byte {
-	return []byte(fmt.Sprintf(format, a...))
+	return lower(p), &stable.Pkg{Name: p.name, Path: p.path, Scope: p.scope}, nil
 }
 
-func emitFuncAssignment(t *stable.Stable, a *parse.Assign) []byte {
-	// First, we need to check to see that the expressions on the left are all idents
-	// TODO: Make this work for more than one variable. [Issue: https://github.com/samertm/chompy/issues/3]
-	if len(a.LeftExpr) == 0 {
-		log.Fatal("Expected idents on the left of the assignment")
-	}
-	id, ok := a.LeftExpr[0].FirstN.Expr.(*parse.PrimaryE).Expr.(*parse.Ident)
-	if !ok {
-		log.Fatalf("Expected left of assignment to be ident: %s", a)
-	}
-	n, ok := t.Get(id.Name)
-	if !ok {
-		log.Fatalf("Ident %s not in scope", id)
+// check is the "main" method for the semanic package. It runs all
+// of the semanic checks and generates the IR for the backend.
+func check(path string, files []*parse.Tree, imports map[string]*stable.Pkg) (*pkg, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files in package " + path)
 	}
-	// TODO: handle more than one expression [Issue: https://github.com/samertm/chompy/issues/5]
-	if len(a.RightExpr) != 1 {
-		log.Fatal("Expected one expression to the right of the assignment")
+	p := &pkg{path: path, files: files, imports: imports}
+	errs := treeWalks(p)
+	if len(errs) != 0 {
+		return nil, errs
 	}
-	code := emitEvalExpr(t, a.RightExpr[0])
-	// TODO: Evaluate the expression on the right. For now, we will assume that it [Issue: https://github.com/samertm/chompy/issues/2]
-	// is 5.
-	return append(code, bprintf("\tstr\tr6, [r7, #%d]\n", n.Offset())...)
+	return p, nil
 }
 
-func emitEvalExpr(t *stable.Stable, ex *parse.Expr) []byte {
-	// TODO: do something with e.Op [Issue: https://github.com/samertm/chompy/issues/4]
-	if ex.FirstN == nil {
-		log.Fatalf("failed on %s", ex)
-	}
-	var exprs []*parse.Expr
-	for e := ex; e != nil; e = e.SecondN {
-		exprs = append([]*parse.Expr{e}, exprs...)
+// funcLabel is the label of the function name in package p.
+// Functions outside of package main are prefixed by their import path,
+// so that packages don't clash.
+func funcLabel(p *pkg, name string) string {
+	if p.name == "main" {
+		return name
 	}
-	var result []byte
-	for _, exp := range exprs {
-		switch e := exp.FirstN.Expr.(type) {
-		case *parse.PrimaryE:
-			switch n := e.Expr.(type) {
-			case *parse.Ident:
-				ni, ok := t.Get(n.Name)
-				if !ok {
-					log.Fatalf("Ident %s not in scope", n)
-				}
-				result = append(result, bprintf("\tldr\tr5, [r7, #%d]\n", ni.Offset())...)
-			case *parse.Lit:
-				if n.Typ != "Int" {
-					log.Fatal("The only type available are ints")
-				}
-				result = append(result, bprintf("\tmovs\tr5, #%s\n", n.Val)...)
-			default:
-				log.Fatalf("I don't handle %s yet\n", reflect.TypeOf(e.Expr))
-			}
-			switch exp.BinOp {
-			case "+":
-				result = append(result, "\tadd\tr6, r6, r5\n"...)
-			case "==":
-				result = append(result, "\tcmp\tr6, r5\n"...)
-			case "<":
-				result = append(result, "\tcmp\tr5, r6\n"...)
-			case "":
-				result = append(result, "\tmovs\tr6, r5\n"...)
-			default:
-				log.Fatalf("Unknown binop: %s", exp)
-			}
-		case *parse.UnaryE:
-			log.Fatalf("Found unarye: %s", exp)
-		default:
-			log.Fatalf("Only deals with primary and unary errors: %s", exp)
-		}
-	}
-	return result
-}
-
-func emitFuncStackSetup(offset int) []byte {
-	return []byte("\tpush\t{r7}\n" +
-		"\tsub\tsp, sp, #" + strconv.Itoa(offset) + "\n" +
-		"\tmov\tr7, sp\n")
-}
-
-func emitFuncReturn() []byte {
-	return []byte("\tbx\tlr\n")
-		
+	return p.path + "." + name
 }
-
-func emitFuncHeader(name string) []byte {
-	return []byte("\t.align\t2\n" +
-		"\t.global\t" + name + "\n" +
-		name + ":\n")
-
-}
-
-//func emitMov(dest int, src int)
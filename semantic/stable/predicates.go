@@ -0,0 +1,191 @@
+package stable
+
+// Identical reports whether x and y are identical types, as defined by
+// the Go spec: named types are only identical to themselves, and other
+// types are identical if they are built the same way from identical
+// types.
+func Identical(x, y Type) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	switch x := x.(type) {
+	case *Basic:
+		y, ok := y.(*Basic)
+		// the universe is rebuilt for each package, so basic types
+		// are compared by name
+		return ok && x.Name == y.Name
+	case *Named:
+		y, ok := y.(*Named)
+		return ok && x == y
+	case *Pointer:
+		y, ok := y.(*Pointer)
+		return ok && Identical(x.Elem, y.Elem)
+	case *Array:
+		y, ok := y.(*Array)
+		return ok && x.Len == y.Len && Identical(x.Elem, y.Elem)
+	case *Slice:
+		y, ok := y.(*Slice)
+		return ok && Identical(x.Elem, y.Elem)
+	case *Map:
+		y, ok := y.(*Map)
+		return ok && Identical(x.Key, y.Key) && Identical(x.Elem, y.Elem)
+	case *Chan:
+		y, ok := y.(*Chan)
+		return ok && x.Dir == y.Dir && Identical(x.Elem, y.Elem)
+	case *Struct:
+		y, ok := y.(*Struct)
+		if !ok || len(x.Fields) != len(y.Fields) {
+			return false
+		}
+		for i, f := range x.Fields {
+			g := y.Fields[i]
+			if f.Name != g.Name || f.Embedded != g.Embedded ||
+				!samePkg(f.Name, f.Pkg, g.Pkg) || !Identical(f.Type, g.Type) {
+				return false
+			}
+		}
+		return true
+	case *Signature:
+		y, ok := y.(*Signature)
+		return ok && x.Variadic == y.Variadic &&
+			identicalList(x.Params, y.Params) && identicalList(x.Results, y.Results)
+	case *Interface:
+		y, ok := y.(*Interface)
+		if !ok || len(x.Methods) != len(y.Methods) {
+			return false
+		}
+		// the methods are sorted, so they line up
+		for i, m := range x.Methods {
+			n := y.Methods[i]
+			if m.Name != n.Name || !samePkg(m.Name, m.Pkg, n.Pkg) || !Identical(m.Sig, n.Sig) {
+				return false
+			}
+		}
+		return true
+	case Tuple:
+		y, ok := y.(Tuple)
+		return ok && identicalList(x, y)
+	}
+	return false
+}
+
+func identicalList(xs, ys []Type) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i := range xs {
+		if !Identical(xs[i], ys[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// samePkg reports whether two fields or methods called name that were
+// declared in the packages xpkg and ypkg are the same. Exported names
+// are the same anywhere.
+func samePkg(name, xpkg, ypkg string) bool {
+	return IsExported(name) || xpkg == ypkg
+}
+
+// isNamed reports whether t is a named type. The predeclared basic
+// types are named.
+func isNamed(t Type) bool {
+	switch t := t.(type) {
+	case *Named:
+		return true
+	case *Basic:
+		return !t.IsUntyped()
+	}
+	return false
+}
+
+// AssignableTo reports whether a value of the (typed) type v can be
+// assigned to a variable of type t. The assignability of untyped
+// constants depends on their values, so the caller deals with those,
+// except for nil.
+func AssignableTo(v, t Type) bool {
+	if Identical(v, t) {
+		return true
+	}
+	vu, tu := v.Underlying(), t.Underlying()
+	if vu == nil || tu == nil {
+		return false
+	}
+	if Identical(v, UntypedNil) {
+		switch tu.(type) {
+		case *Pointer, *Slice, *Map, *Chan, *Signature, *Interface:
+			return true
+		}
+		return false
+	}
+	// identical underlying types, and at least one isn't named
+	if Identical(vu, tu) && (!isNamed(v) || !isNamed(t)) {
+		return true
+	}
+	if it, ok := tu.(*Interface); ok {
+		return Implements(v, it)
+	}
+	// a bidirectional channel can be assigned to a directional one
+	if vc, ok := vu.(*Chan); ok && vc.Dir == SendRecv {
+		if tc, ok := tu.(*Chan); ok && Identical(vc.Elem, tc.Elem) {
+			return !isNamed(v) || !isNamed(t)
+		}
+	}
+	return false
+}
+
+// Implements reports whether t has all of the methods of the interface
+// i. The method set of a pointer to a named type includes the methods
+// of the named type.
+func Implements(t Type, i *Interface) bool {
+	if ti, ok := t.Underlying().(*Interface); ok {
+		for _, m := range i.Methods {
+			if tm := ti.Method(m.Name); tm == nil || !Identical(tm.Sig, m.Sig) {
+				return false
+			}
+		}
+		return true
+	}
+	if p, ok := t.(*Pointer); ok {
+		t = p.Elem
+	}
+	n, ok := t.(*Named)
+	if !ok {
+		return len(i.Methods) == 0
+	}
+	for _, m := range i.Methods {
+		found := false
+		for _, nm := range n.Methods {
+			if nm.Name == m.Name && samePkg(m.Name, nm.Pkg, m.Pkg) && Identical(nm.Sig, m.Sig) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Comparable reports whether values of type t can be compared with ==.
+func Comparable(t Type) bool {
+	switch u := t.Underlying().(type) {
+	case *Basic:
+		return !Identical(u, UntypedNil)
+	case *Pointer, *Chan, *Interface:
+		return true
+	case *Array:
+		return Comparable(u.Elem)
+	case *Struct:
+		for _, f := range u.Fields {
+			if !Comparable(f.Type) {
+				return false
+			}
+		}
+		return true
+	}
+	// slices, maps and funcs can only be compared with nil
+	return false
+}
@@ -0,0 +1,130 @@
+package stable
+
+// Sizes works out the size and alignment of types for a target.
+type Sizes struct {
+	// WordSize is the size of int, uint, uintptr and pointers.
+	WordSize int64
+	// MaxAlign is the largest alignment of any type.
+	MaxAlign int64
+}
+
+// ARM is the only target: 32-bit ARM with the AAPCS, which aligns
+// 64-bit values to 8 bytes.
+var ARM = &Sizes{WordSize: 4, MaxAlign: 8}
+
+// basicSizes holds the sizes of the basic types that don't depend on
+// the word size.
+var basicSizes = map[string]int64{
+	"bool":    1,
+	"int8":    1,
+	"uint8":   1,
+	"int16":   2,
+	"uint16":  2,
+	"int32":   4,
+	"uint32":  4,
+	"float32": 4,
+	"int64":   8,
+	"uint64":  8,
+	"float64": 8,
+}
+
+func (s *Sizes) Sizeof(t Type) int64 {
+	switch u := t.Underlying().(type) {
+	case *Basic:
+		if size, ok := basicSizes[u.Name]; ok {
+			return size
+		}
+		if u.Name == "string" {
+			// pointer and length
+			return 2 * s.WordSize
+		}
+		return s.WordSize
+	case *Array:
+		if u.Len == 0 {
+			return 0
+		}
+		// every element but the last is padded to the alignment
+		elem := s.Sizeof(u.Elem)
+		return align(elem, s.Alignof(u.Elem))*(u.Len-1) + elem
+	case *Slice:
+		// pointer, length and capacity
+		return 3 * s.WordSize
+	case *Interface:
+		// type and value
+		return 2 * s.WordSize
+	case *Struct:
+		if len(u.Fields) == 0 {
+			return 0
+		}
+		offsets := s.Offsetsof(u.Fields)
+		last := len(u.Fields) - 1
+		size := offsets[last] + s.Sizeof(u.Fields[last].Type)
+		return align(size, s.Alignof(u))
+	case Tuple:
+		var size int64
+		for _, e := range u {
+			size = align(size, s.Alignof(e)) + s.Sizeof(e)
+		}
+		return size
+	}
+	// pointers, maps, chans and funcs are all a single pointer
+	return s.WordSize
+}
+
+func (s *Sizes) Alignof(t Type) int64 {
+	var a int64
+	switch u := t.Underlying().(type) {
+	case *Array:
+		return s.Alignof(u.Elem)
+	case *Struct:
+		a = 1
+		for _, f := range u.Fields {
+			if fa := s.Alignof(f.Type); fa > a {
+				a = fa
+			}
+		}
+		return a
+	case Tuple:
+		a = 1
+		for _, e := range u {
+			if ea := s.Alignof(e); ea > a {
+				a = ea
+			}
+		}
+		return a
+	case *Slice, *Interface:
+		a = s.WordSize
+	case *Basic:
+		if u.Name == "string" {
+			a = s.WordSize
+			break
+		}
+		a = s.Sizeof(u)
+	default:
+		a = s.Sizeof(t)
+	}
+	if a < 1 {
+		return 1
+	}
+	if a > s.MaxAlign {
+		return s.MaxAlign
+	}
+	return a
+}
+
+// Offsetsof returns the offset of each of the fields of a struct.
+func (s *Sizes) Offsetsof(fields []*Field) []int64 {
+	offsets := make([]int64, len(fields))
+	var offset int64
+	for i, f := range fields {
+		offset = align(offset, s.Alignof(f.Type))
+		offsets[i] = offset
+		offset += s.Sizeof(f.Type)
+	}
+	return offsets
+}
+
+// align rounds x up to a multiple of a.
+func align(x, a int64) int64 {
+	return (x + a - 1) / a * a
+}
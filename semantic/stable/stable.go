@@ -1,12 +1,62 @@
 package stable
 
+import (
+	"sort"
+
+	"github.com/samertm/chompy/semantic/constant"
+)
+
+// Kind says what sort of entity an identifier is bound to.
+type Kind int
+
+const (
+	Var Kind = iota
+	Const
+	TypeName
+	Func
+	Package
+	Nil
+	Builtin
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Var:
+		return "variable"
+	case Const:
+		return "constant"
+	case TypeName:
+		return "type"
+	case Func:
+		return "function"
+	case Package:
+		return "package"
+	case Nil:
+		return "nil"
+	case Builtin:
+		return "built-in function"
+	}
+	return "unknown"
+}
+
 // Let's create a type to hold information about the variables in
 // our program.
 type NodeInfo struct {
-	// What variables do we need? Probably a pointer to a type
-	T      *Basic // TODO: change to Type [Issue: https://github.com/samertm/chompy/issues/15]
-	StackOffset int
-	scopeOffset int
+	Kind Kind
+	// Name is the identifier the NodeInfo was declared with.
+	Name string
+	// Pkg is set for imports (Kind == Package), and points to the
+	// package that the import refers to.
+	Pkg *Pkg
+	// T is the type of the entity. For type names, it's the type
+	// that the name stands for.
+	T Type
+	// Val is the value of a constant, once it's been checked. It's
+	// nil for iota, whose value depends on where it's used.
+	Val constant.Value
+	// Used is set once the entity is referred to. Assigning to a
+	// variable doesn't count.
+	Used bool
 	// What else? We don't need the identifier name because
 	// that's stored in the symbol table. There may be other
 	// things but I'm not sure what they are.
@@ -14,113 +64,22 @@ type NodeInfo struct {
 	up *NodeInfo
 }
 
-func (n NodeInfo) Offset() int {
-	return n.StackOffset + n.scopeOffset
-}
-
-// Okay, let's create our Type type. Type will hold all the
-// information we need to generate code for a specific type.
-type Type interface {
-	Equal(Type) bool
-	String() string
-}
-
-// type Func struct {
-// 	// Might not need this for anonymous functions
-// 	Name *Basic
-// 	Args []Type
-// 	Result []Type
-// }
-
-// func (f *Func) Equal(t Type) bool {
-// 	fn, ok := t.(*Func)
-// 	if !ok {
-// 		return false
-// 	}
-// 	// Check the names and results for equality.
-// 	// NOTE I'm not sure if I need this, or if this will work
-// 	// with closures.
-// 	return f.Name.Equal(fn) && typesEqual(f.Result, fn.Result) &&
-// 		typesEqual(f.Args, fn.Args)
-// }
-
-func typesEqual(types0, types1 []Type) bool {
-	if len(types0) != len(types1) {
-		return false
-	}
-	for i := 0; i < len(types0); i++ {
-		if types0[i].Equal(types1[i]) == false {
-			return false
-		}
-	}
-	return true
-}
-
-// func (f *Func) String() string {
-// 	s := "func: " + f.Name.String() + "\n"
-// 	s += "args: "
-// 	for _, a := range f.Args {
-// 		s += a.String() + "\n"
-// 	}
-// 	return s
-// }
-
-// Represents all types that are not functions
-type Basic struct {
-	Pkg  string
-	Name string
-	Size int
-	// this is a pointer type if true
-	Pointer bool
+// Exported reports whether the name starts with an upper case letter.
+func (n NodeInfo) Exported() bool {
+	return IsExported(n.Name)
 }
 
-func (b *Basic) Equal(t Type) bool {
-	ba, ok := t.(*Basic)
-	if !ok {
-		return false
-	}
-	return b.Pkg == ba.Pkg && b.Name == ba.Name && b.Pointer == ba.Pointer
+func IsExported(name string) bool {
+	return len(name) > 0 && name[0] >= 'A' && name[0] <= 'Z'
 }
 
-func (b *Basic) String() string {
-	s := "pkg: " + b.Pkg + " name: " + b.Name
-	if b.Pointer {
-		s += " *"
-	}
-	return s
+// Pkg is a checked package. Scope holds its top level declarations.
+type Pkg struct {
+	Name  string
+	Path  string
+	Scope *Stable
 }
 
-// type Struct struct {
-// 	Name   *Basic
-// 	Fields []Type
-// }
-
-// func (s *Struct) Equal(t Type) bool {
-// 	ss, ok := t.(*Struct)
-// 	if !ok {
-// 		return false
-// 	}
-// 	if s.Name != s.Name ||
-// 		len(s.Fields) != len(ss.Fields) {
-// 		return false
-// 	}
-// 	for i := 0; i < len(s.Fields); i++ {
-// 		if s.Fields[i].Equal(ss.Fields[i]) == false {
-// 			return false
-// 		}
-// 	}
-// 	return true
-// }
-
-// func (s *Struct) String() string {
-// 	str := "struct: " + s.Name.String() + "\n"
-// 	str += "fields: "
-// 	for _, f := range s.Fields {
-// 		str += f.String()
-// 	}
-// 	return str
-// }
-
 // TODO: add offset to symbol table [Issue: https://github.com/samertm/chompy/issues/16]
 type Stable struct {
 	table  map[string]*NodeInfo
@@ -142,19 +101,37 @@ func (s *Stable) Insert(name string, value *NodeInfo) {
 	s.table[name] = value
 }
 
-func (s *Stable) Get(name string) (*NodeInfo, bool) {
-	var scopeOffset int
+// Lookup looks name up in s and then in the enclosing scopes.
+func (s *Stable) Lookup(name string) (*NodeInfo, bool) {
 	for tab := s; tab != nil; tab = tab.up {
-		n, ok := tab.table[name]
-		if ok {
-			n.scopeOffset = scopeOffset
+		if n, ok := tab.table[name]; ok {
 			return n, true
 		}
-		scopeOffset += 4
 	}
 	return nil, false
 }
 
+// LookupLocal only looks in the innermost scope.
+func (s *Stable) LookupLocal(name string) (*NodeInfo, bool) {
+	n, ok := s.table[name]
+	return n, ok
+}
+
+// Names returns the names declared in the innermost scope, sorted.
+func (s *Stable) Names() []string {
+	names := make([]string, 0, len(s.table))
+	for name := range s.table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Up returns the enclosing scope, or nil for the outermost scope.
+func (s *Stable) Up() *Stable {
+	return s.up
+}
+
 func (s *Stable) IterScope() chan *NodeInfo {
 	ch := make(chan *NodeInfo)
 	go func() {
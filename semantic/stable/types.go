@@ -0,0 +1,320 @@
+package stable
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Okay, let's create our Type type. Type will hold all the
+// information we need to generate code for a specific type.
+type Type interface {
+	// Equal reports whether the types are identical (see Identical).
+	Equal(Type) bool
+	// Underlying returns the type that a named type is declared
+	// with. Every other type is its own underlying type.
+	Underlying() Type
+	// String returns the type in Go syntax.
+	String() string
+}
+
+// Basic represents the predeclared types, and the types of untyped
+// constants.
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) Equal(t Type) bool { return Identical(b, t) }
+func (b *Basic) Underlying() Type  { return b }
+func (b *Basic) String() string    { return b.Name }
+
+func (b *Basic) IsBoolean() bool {
+	return b.Name == "bool" || b.Name == "untyped bool"
+}
+
+func (b *Basic) IsInteger() bool {
+	switch b.Name {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		"untyped int", "untyped rune":
+		return true
+	}
+	return false
+}
+
+func (b *Basic) IsUnsigned() bool {
+	switch b.Name {
+	case "uint", "uint8", "uint16", "uint32", "uint64", "uintptr":
+		return true
+	}
+	return false
+}
+
+func (b *Basic) IsFloat() bool {
+	switch b.Name {
+	case "float32", "float64", "untyped float":
+		return true
+	}
+	return false
+}
+
+func (b *Basic) IsNumeric() bool {
+	return b.IsInteger() || b.IsFloat()
+}
+
+func (b *Basic) IsString() bool {
+	return b.Name == "string" || b.Name == "untyped string"
+}
+
+// IsOrdered reports whether values of type b can be compared with <.
+func (b *Basic) IsOrdered() bool {
+	return b.IsNumeric() || b.IsString()
+}
+
+func (b *Basic) IsUntyped() bool {
+	return strings.HasPrefix(b.Name, "untyped ")
+}
+
+// Named is a type declared with a type declaration, or one of the
+// predeclared named types (error).
+type Named struct {
+	// Pkg is the import path of the declaring package; it's empty
+	// for package main and for predeclared types.
+	Pkg  string
+	Name string
+	// Methods are the methods declared on the type, sorted by name.
+	Methods []*Method
+	// decl is the type in the declaration, which may itself be
+	// named.
+	decl Type
+}
+
+// NewNamed returns the type called name declared in the package pkg
+// as decl. decl may be nil, and set later with SetDecl, so that types
+// can refer to each other.
+func NewNamed(pkg, name string, decl Type) *Named {
+	return &Named{Pkg: pkg, Name: name, decl: decl}
+}
+
+func (n *Named) SetDecl(t Type) {
+	n.decl = t
+}
+
+// Decl returns the type that n was declared as.
+func (n *Named) Decl() Type {
+	return n.decl
+}
+
+func (n *Named) Equal(t Type) bool { return Identical(n, t) }
+
+// Underlying follows the chain of declarations to a type that isn't
+// named. It returns nil if the declarations form a cycle (type T U;
+// type U T), or if a declaration hasn't been set yet.
+func (n *Named) Underlying() Type {
+	seen := make(map[*Named]bool)
+	var t Type = n
+	for {
+		nt, ok := t.(*Named)
+		if !ok {
+			return t
+		}
+		if seen[nt] || nt.decl == nil {
+			return nil
+		}
+		seen[nt] = true
+		t = nt.decl
+	}
+}
+
+func (n *Named) String() string {
+	if n.Pkg == "" {
+		return n.Name
+	}
+	// only the last element of the import path is the package name
+	return n.Pkg[strings.LastIndex(n.Pkg, "/")+1:] + "." + n.Name
+}
+
+// Method is a method of a named type or of an interface.
+type Method struct {
+	Name string
+	// Pkg is the import path of the declaring package, so that
+	// unexported methods of different packages differ.
+	Pkg string
+	Sig *Signature
+}
+
+type Pointer struct {
+	Elem Type
+}
+
+func (p *Pointer) Equal(t Type) bool { return Identical(p, t) }
+func (p *Pointer) Underlying() Type  { return p }
+func (p *Pointer) String() string    { return "*" + p.Elem.String() }
+
+type Array struct {
+	Len  int64
+	Elem Type
+}
+
+func (a *Array) Equal(t Type) bool { return Identical(a, t) }
+func (a *Array) Underlying() Type  { return a }
+func (a *Array) String() string    { return fmt.Sprintf("[%d]%s", a.Len, a.Elem) }
+
+type Slice struct {
+	Elem Type
+}
+
+func (s *Slice) Equal(t Type) bool { return Identical(s, t) }
+func (s *Slice) Underlying() Type  { return s }
+func (s *Slice) String() string    { return "[]" + s.Elem.String() }
+
+type Map struct {
+	Key  Type
+	Elem Type
+}
+
+func (m *Map) Equal(t Type) bool { return Identical(m, t) }
+func (m *Map) Underlying() Type  { return m }
+func (m *Map) String() string    { return "map[" + m.Key.String() + "]" + m.Elem.String() }
+
+// ChanDir is the direction of a channel type.
+type ChanDir int
+
+const (
+	SendRecv ChanDir = iota
+	SendOnly
+	RecvOnly
+)
+
+type Chan struct {
+	Dir  ChanDir
+	Elem Type
+}
+
+func (c *Chan) Equal(t Type) bool { return Identical(c, t) }
+func (c *Chan) Underlying() Type  { return c }
+
+func (c *Chan) String() string {
+	elem := c.Elem.String()
+	switch c.Dir {
+	case SendOnly:
+		return "chan<- " + elem
+	case RecvOnly:
+		return "<-chan " + elem
+	}
+	// chan (<-chan int) isn't the same as chan<- chan int
+	if e, ok := c.Elem.(*Chan); ok && e.Dir == RecvOnly {
+		elem = "(" + elem + ")"
+	}
+	return "chan " + elem
+}
+
+// Field is a field of a struct.
+type Field struct {
+	Name string
+	// Pkg is the import path of the declaring package, so that
+	// unexported fields of different packages differ.
+	Pkg      string
+	Type     Type
+	Embedded bool
+}
+
+type Struct struct {
+	Fields []*Field
+}
+
+func (s *Struct) Equal(t Type) bool { return Identical(s, t) }
+func (s *Struct) Underlying() Type  { return s }
+
+func (s *Struct) String() string {
+	var fields []string
+	for _, f := range s.Fields {
+		if f.Embedded {
+			fields = append(fields, f.Type.String())
+			continue
+		}
+		fields = append(fields, f.Name+" "+f.Type.String())
+	}
+	return "struct{" + strings.Join(fields, "; ") + "}"
+}
+
+// Signature is the type of a function. Parameter and result names
+// aren't part of the type. If Variadic is set, the last parameter is
+// ...T, and its type is []T.
+type Signature struct {
+	Params   []Type
+	Results  []Type
+	Variadic bool
+}
+
+func (f *Signature) Equal(t Type) bool { return Identical(f, t) }
+func (f *Signature) Underlying() Type  { return f }
+
+func (f *Signature) String() string {
+	return "func" + f.signature()
+}
+
+// signature is the signature without "func", as it appears in
+// interfaces.
+func (f *Signature) signature() string {
+	var params []string
+	for i, p := range f.Params {
+		if f.Variadic && i == len(f.Params)-1 {
+			if s, ok := p.(*Slice); ok {
+				params = append(params, "..."+s.Elem.String())
+				continue
+			}
+		}
+		params = append(params, p.String())
+	}
+	s := "(" + strings.Join(params, ", ") + ")"
+	switch len(f.Results) {
+	case 0:
+	case 1:
+		s += " " + f.Results[0].String()
+	default:
+		s += " " + Tuple(f.Results).String()
+	}
+	return s
+}
+
+type Interface struct {
+	// Methods are sorted by name.
+	Methods []*Method
+}
+
+func (i *Interface) Equal(t Type) bool { return Identical(i, t) }
+func (i *Interface) Underlying() Type  { return i }
+
+func (i *Interface) String() string {
+	var methods []string
+	for _, m := range i.Methods {
+		methods = append(methods, m.Name+m.Sig.signature())
+	}
+	return "interface{" + strings.Join(methods, "; ") + "}"
+}
+
+// Method returns the method of i called name, or nil.
+func (i *Interface) Method(name string) *Method {
+	for _, m := range i.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Tuple is the type of a call to a function with more than one result.
+// It can only be used as the right hand side of an assignment, as the
+// values of a return statement or as the arguments of a call.
+type Tuple []Type
+
+func (tu Tuple) Equal(t Type) bool { return Identical(tu, t) }
+func (tu Tuple) Underlying() Type  { return tu }
+
+func (tu Tuple) String() string {
+	var types []string
+	for _, t := range tu {
+		types = append(types, t.String())
+	}
+	return "(" + strings.Join(types, ", ") + ")"
+}
@@ -0,0 +1,194 @@
+package stable
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	tBool   = &Basic{Name: "bool"}
+	tInt    = &Basic{Name: "int"}
+	tInt8   = &Basic{Name: "int8"}
+	tInt16  = &Basic{Name: "int16"}
+	tInt64  = &Basic{Name: "int64"}
+	tString = &Basic{Name: "string"}
+)
+
+func fields(fs ...*Field) *Struct {
+	return &Struct{Fields: fs}
+}
+
+func TestIdentical(t *testing.T) {
+	celsius := NewNamed("", "celsius", tInt16)
+	other := NewNamed("", "celsius", tInt16)
+	sig := func(variadic bool, params, results []Type) *Signature {
+		return &Signature{Params: params, Results: results, Variadic: variadic}
+	}
+	method := func(name, pkg string, s *Signature) *Interface {
+		return &Interface{Methods: []*Method{{Name: name, Pkg: pkg, Sig: s}}}
+	}
+	noArgs := sig(false, nil, nil)
+	tests := []struct {
+		x, y Type
+		want bool
+	}{
+		{tInt, &Basic{Name: "int"}, true},
+		{tInt, tInt64, false},
+		{celsius, celsius, true},
+		// named types are only identical to themselves
+		{celsius, other, false},
+		{celsius, tInt16, false},
+		{&Pointer{Elem: tInt}, &Pointer{Elem: tInt}, true},
+		{&Array{Len: 3, Elem: tInt}, &Array{Len: 4, Elem: tInt}, false},
+		{&Slice{Elem: tInt}, &Array{Len: 3, Elem: tInt}, false},
+		{&Map{Key: tString, Elem: tInt}, &Map{Key: tString, Elem: tInt}, true},
+		{&Chan{Dir: SendOnly, Elem: tInt}, &Chan{Elem: tInt}, false},
+		{
+			fields(&Field{Name: "x", Type: tInt}, &Field{Name: "y", Type: tString}),
+			fields(&Field{Name: "x", Type: tInt}, &Field{Name: "y", Type: tString}),
+			true,
+		},
+		{fields(&Field{Name: "x", Type: tInt}), fields(&Field{Name: "z", Type: tInt}), false},
+		{fields(&Field{Name: "x", Type: tInt}), fields(&Field{Name: "x", Type: celsius}), false},
+		// unexported fields of different packages differ, and
+		// exported ones don't
+		{fields(&Field{Name: "x", Pkg: "a", Type: tInt}), fields(&Field{Name: "x", Pkg: "b", Type: tInt}), false},
+		{fields(&Field{Name: "X", Pkg: "a", Type: tInt}), fields(&Field{Name: "X", Pkg: "b", Type: tInt}), true},
+		{fields(&Field{Name: "celsius", Type: celsius, Embedded: true}), fields(&Field{Name: "celsius", Type: celsius}), false},
+		{
+			sig(true, []Type{tInt, &Slice{Elem: tString}}, []Type{tBool}),
+			sig(true, []Type{tInt, &Slice{Elem: tString}}, []Type{tBool}),
+			true,
+		},
+		{
+			sig(true, []Type{tInt, &Slice{Elem: tString}}, nil),
+			sig(false, []Type{tInt, &Slice{Elem: tString}}, nil),
+			false,
+		},
+		{sig(false, []Type{tInt}, []Type{tBool}), sig(false, []Type{tInt}, []Type{tBool, tInt}), false},
+		{method("M", "a", noArgs), method("M", "b", noArgs), true},
+		{method("m", "a", noArgs), method("m", "b", noArgs), false},
+		{method("M", "", noArgs), method("M", "", sig(false, []Type{tInt}, nil)), false},
+		{&Interface{}, method("M", "", noArgs), false},
+		{Tuple{tInt, tBool}, Tuple{tInt, tBool}, true},
+		{tInt, nil, false},
+	}
+	for _, test := range tests {
+		if got := Identical(test.x, test.y); got != test.want {
+			t.Errorf("Identical(%v, %v) = %v, want %v", test.x, test.y, got, test.want)
+		}
+		if test.y != nil && Identical(test.y, test.x) != test.want {
+			t.Errorf("Identical(%v, %v) isn't Identical(%v, %v)", test.y, test.x, test.x, test.y)
+		}
+	}
+}
+
+func TestUnderlying(t *testing.T) {
+	point := fields(&Field{Name: "x", Type: tInt}, &Field{Name: "y", Type: tInt})
+	inner := NewNamed("", "inner", nil)
+	outer := NewNamed("", "outer", inner)
+	inner.SetDecl(point)
+	a := NewNamed("", "a", nil)
+	b := NewNamed("", "b", a)
+	a.SetDecl(b)
+	tests := []struct {
+		t, want Type
+	}{
+		{tInt, tInt},
+		{NewNamed("", "celsius", tInt16), tInt16},
+		{outer, point},
+		{&Slice{Elem: outer}, &Slice{Elem: outer}},
+		// a cycle, and a declaration that isn't set yet
+		{a, nil},
+		{NewNamed("", "later", nil), nil},
+	}
+	for _, test := range tests {
+		if got := test.t.Underlying(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("the underlying type of %v is %v, want %v", test.t, got, test.want)
+		}
+	}
+}
+
+func TestSizes(t *testing.T) {
+	amd64 := &Sizes{WordSize: 8, MaxAlign: 8}
+	padded := fields(&Field{Name: "a", Type: tInt8}, &Field{Name: "b", Type: tInt64}, &Field{Name: "c", Type: tInt8})
+	words := fields(&Field{Name: "a", Type: tInt8}, &Field{Name: "b", Type: tInt}, &Field{Name: "c", Type: tInt8})
+	tests := []struct {
+		sizes       *Sizes
+		t           Type
+		size, align int64
+	}{
+		{ARM, tBool, 1, 1},
+		{ARM, tInt, 4, 4},
+		{ARM, tInt64, 8, 8},
+		{ARM, tString, 8, 4},
+		{ARM, &Slice{Elem: tInt}, 12, 4},
+		{ARM, &Array{Len: 3, Elem: tInt16}, 6, 2},
+		{ARM, &Array{Len: 0, Elem: tInt64}, 0, 8},
+		{ARM, &Pointer{Elem: tInt64}, 4, 4},
+		{ARM, &Interface{}, 8, 4},
+		{ARM, NewNamed("", "celsius", tInt16), 2, 2},
+		{ARM, fields(), 0, 1},
+		{ARM, padded, 24, 8},
+		{ARM, words, 12, 4},
+		{ARM, Tuple{tInt8, tInt}, 8, 4},
+		{amd64, tInt, 8, 8},
+		{amd64, tString, 16, 8},
+		{amd64, &Slice{Elem: tInt}, 24, 8},
+		{amd64, &Pointer{Elem: tInt8}, 8, 8},
+		{amd64, words, 24, 8},
+	}
+	for _, test := range tests {
+		if got := test.sizes.Sizeof(test.t); got != test.size {
+			t.Errorf("with %d-byte words, Sizeof(%v) = %d, want %d", test.sizes.WordSize, test.t, got, test.size)
+		}
+		if got := test.sizes.Alignof(test.t); got != test.align {
+			t.Errorf("with %d-byte words, Alignof(%v) = %d, want %d", test.sizes.WordSize, test.t, got, test.align)
+		}
+	}
+	for _, test := range []struct {
+		sizes *Sizes
+		s     *Struct
+		want  []int64
+	}{
+		{ARM, padded, []int64{0, 8, 16}},
+		{ARM, words, []int64{0, 4, 8}},
+		{amd64, words, []int64{0, 8, 16}},
+	} {
+		if got := test.sizes.Offsetsof(test.s.Fields); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("with %d-byte words, the offsets of %v are %v, want %v", test.sizes.WordSize, test.s, got, test.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	reader := NewNamed("io/ioutil", "Reader", &Interface{})
+	intPtr := &Pointer{Elem: tInt}
+	tests := []struct {
+		t    Type
+		want string
+	}{
+		{tInt, "int"},
+		{reader, "ioutil.Reader"},
+		{NewNamed("", "celsius", tInt16), "celsius"},
+		{&Map{Key: tString, Elem: &Slice{Elem: intPtr}}, "map[string][]*int"},
+		{&Array{Len: 3, Elem: tInt8}, "[3]int8"},
+		{&Chan{Dir: SendOnly, Elem: tInt}, "chan<- int"},
+		{&Chan{Elem: &Chan{Dir: RecvOnly, Elem: tInt}}, "chan (<-chan int)"},
+		{fields(), "struct{}"},
+		{fields(&Field{Name: "x", Type: tInt}, &Field{Name: "Reader", Type: reader, Embedded: true}), "struct{x int; ioutil.Reader}"},
+		{&Signature{}, "func()"},
+		{&Signature{Params: []Type{tInt, &Slice{Elem: tString}}, Results: []Type{tBool}, Variadic: true}, "func(int, ...string) bool"},
+		{&Signature{Params: []Type{&Slice{Elem: tString}}, Results: []Type{tBool, tInt}}, "func([]string) (bool, int)"},
+		{&Interface{Methods: []*Method{
+			{Name: "Len", Sig: &Signature{Results: []Type{tInt}}},
+			{Name: "Less", Sig: &Signature{Params: []Type{tInt, tInt}, Results: []Type{tBool}}},
+		}}, "interface{Len() int; Less(int, int) bool}"},
+		{Tuple{tInt, tString}, "(int, string)"},
+	}
+	for _, test := range tests {
+		if got := test.t.String(); got != test.want {
+			t.Errorf("%#v prints as %s, want %s", test.t, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package stable
+
+import "github.com/samertm/chompy/semantic/constant"
+
+// Sizes are worked out by a Sizes, for the target.
+var predeclaredTypes = []*Basic{
+	{Name: "bool"},
+	{Name: "int"},
+	{Name: "int8"},
+	{Name: "int16"},
+	{Name: "int32"},
+	{Name: "int64"},
+	{Name: "uint"},
+	{Name: "uint8"},
+	{Name: "uint16"},
+	{Name: "uint32"},
+	{Name: "uint64"},
+	{Name: "uintptr"},
+	{Name: "float32"},
+	{Name: "float64"},
+	{Name: "string"},
+}
+
+// The types of untyped constants, and of nil.
+var (
+	UntypedBool   = &Basic{Name: "untyped bool"}
+	UntypedInt    = &Basic{Name: "untyped int"}
+	UntypedRune   = &Basic{Name: "untyped rune"}
+	UntypedFloat  = &Basic{Name: "untyped float"}
+	UntypedString = &Basic{Name: "untyped string"}
+	UntypedNil    = &Basic{Name: "untyped nil"}
+)
+
+// ErrorType is the predeclared error interface:
+//
+//	type error interface {
+//		Error() string
+//	}
+var ErrorType = NewNamed("", "error", &Interface{
+	Methods: []*Method{{
+		Name: "Error",
+		Sig:  &Signature{Results: []Type{Predeclared("string")}},
+	}},
+})
+
+// Predeclared returns the predeclared type called name, or nil.
+func Predeclared(name string) *Basic {
+	if n, ok := predeclaredAliases[name]; ok {
+		name = n
+	}
+	for _, b := range predeclaredTypes {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// Default returns the type that an untyped constant of type t gets when
+// the context doesn't decide, and t itself for every other type.
+func Default(t Type) Type {
+	b, ok := t.(*Basic)
+	if !ok || !b.IsUntyped() {
+		return t
+	}
+	switch b.Name {
+	case "untyped bool":
+		return Predeclared("bool")
+	case "untyped int":
+		return Predeclared("int")
+	case "untyped rune":
+		return Predeclared("rune")
+	case "untyped float":
+		return Predeclared("float64")
+	case "untyped string":
+		return Predeclared("string")
+	}
+	return t
+}
+
+// the predeclared functions
+var builtins = []string{"append", "cap", "copy", "delete", "len", "make", "new", "panic", "print", "println"}
+
+// aliases for predeclared types
+var predeclaredAliases = map[string]string{
+	"byte": "uint8",
+	"rune": "int32",
+}
+
+// Universe returns a new scope holding Go's predeclared
+// identifiers. Each call returns a fresh scope, because Get writes
+// to the NodeInfos it finds.
+func Universe() *Stable {
+	u := New(nil)
+	basics := make(map[string]*Basic)
+	for _, b := range predeclaredTypes {
+		basic := *b
+		basics[b.Name] = &basic
+		u.Insert(b.Name, &NodeInfo{Kind: TypeName, Name: b.Name, T: &basic})
+	}
+	for alias, name := range predeclaredAliases {
+		u.Insert(alias, &NodeInfo{Kind: TypeName, Name: alias, T: basics[name]})
+	}
+	u.Insert("true", &NodeInfo{Kind: Const, Name: "true", T: UntypedBool, Val: constant.MakeBool(true)})
+	u.Insert("false", &NodeInfo{Kind: Const, Name: "false", T: UntypedBool, Val: constant.MakeBool(false)})
+	u.Insert("iota", &NodeInfo{Kind: Const, Name: "iota", T: UntypedInt})
+	u.Insert("nil", &NodeInfo{Kind: Nil, Name: "nil"})
+	for _, name := range builtins {
+		u.Insert(name, &NodeInfo{Kind: Builtin, Name: name})
+	}
+	u.Insert("error", &NodeInfo{Kind: TypeName, Name: "error", T: ErrorType})
+	return u
+}
@@ -0,0 +1,303 @@
+package semantic
+
+import (
+	"github.com/samertm/chompy/parse"
+	"github.com/samertm/chompy/semantic/constant"
+	"github.com/samertm/chompy/semantic/stable"
+)
+
+// checkSupported reports the code that is valid Go, but that the
+// lowering can't handle yet: values that don't fit in a word, and the
+// statements and operands that it doesn't lower. It follows the same
+// paths through the code as the lowering does, so that whatever it lets
+// through can be lowered.
+func checkSupported(p *pkg) sErrors {
+	s := &supported{p: p}
+	for _, t := range p.files {
+		s.file = t.Name
+		for _, kid := range t.Kids {
+			switch n := kid.(type) {
+			case *parse.Vars:
+				s.stmt(n)
+			case *parse.Funcdecl:
+				s.funcDecl(n)
+			}
+		}
+	}
+	return s.errs
+}
+
+// supported is the state of checkSupported.
+type supported struct {
+	p    *pkg
+	file string
+	errs sErrors
+}
+
+func (s *supported) errorf(n parse.Node, format string, a ...interface{}) {
+	s.errs = append(s.errs, errorAt(s.file, n, format, a...))
+}
+
+// funcDecl checks the parameters, results and body of the function d.
+func (s *supported) funcDecl(d *parse.Funcdecl) {
+	if d.Func == nil || d.Func.Sig == nil {
+		return
+	}
+	sig := d.Func.Sig
+	s.params(sig.Params, "parameters")
+	if r := sig.Result; r != nil {
+		if r.Typ != nil {
+			if t := typeOf(r.Typ); !isWord(t) {
+				s.errorf(r.Typ, "results of type %s are not supported yet", t)
+			}
+		}
+		s.params(r.Params, "results")
+	}
+	if d.Func.Body != nil {
+		s.block(d.Func.Body)
+	}
+}
+
+// params checks that the parameters ps, which are what, are words.
+func (s *supported) params(ps []*parse.Param, what string) {
+	for _, p := range ps {
+		t := typeOf(p.Typ)
+		if p.DotDotDot {
+			t = &stable.Slice{Elem: t}
+		}
+		if !isWord(t) {
+			s.errorf(p.Typ, "%s of type %s are not supported yet", what, t)
+		}
+	}
+}
+
+func (s *supported) block(b *parse.Block) {
+	for _, stmt := range b.Stmts {
+		s.stmt(stmt)
+	}
+}
+
+func (s *supported) stmt(stmt parse.Node) {
+	switch n := stmt.(type) {
+	case nil, *parse.EmptyStmt, *parse.Consts, *parse.Types,
+		*parse.GotoStmt, *parse.BreakStmt, *parse.ContinueStmt:
+	case *parse.Block:
+		s.block(n)
+	case *parse.Vars:
+		for _, v := range n.Vs {
+			s.vars(v.Idents)
+			s.exprs(v.Exprs)
+		}
+	case *parse.Assign:
+		for _, e := range n.LeftExpr {
+			s.target(e)
+		}
+		s.exprs(n.RightExpr)
+	case *parse.ShortVarDecl:
+		s.vars(n.Idents)
+		s.exprs(n.Exprs)
+	case *parse.ReturnStmt:
+		s.exprs(n.Exprs)
+	case *parse.IfStmt:
+		s.stmt(n.SimpleStmt)
+		s.expr(n.Expr)
+		s.block(n.Body)
+		s.stmt(n.Else)
+	case *parse.ForStmt:
+		switch c := n.Clause.(type) {
+		case *parse.RangeClause:
+			// the checker only lets constant strings be ranged over
+			s.vars(c.Idents)
+			for _, e := range c.Exprs {
+				s.target(e)
+			}
+		case *parse.ForClause:
+			s.stmt(c.InitStmt)
+			s.stmt(c.PostStmt)
+			if c.Condition != nil {
+				s.value(c.Condition)
+			}
+		case parse.Node:
+			s.value(c)
+		}
+		s.block(n.Body)
+	case *parse.IncDecStmt:
+		s.target(n.Expr.(*parse.Expr))
+	case *parse.LabeledStmt:
+		s.stmt(n.Stmt)
+	case *parse.Expr:
+		s.exprStmt(n)
+	case *parse.GoStmt:
+		s.errorf(n, "go statements are not supported yet")
+	case *parse.DeferStmt:
+		s.errorf(n, "defer statements are not supported yet")
+	case *parse.SendStmt:
+		s.errorf(n, "send statements are not supported yet")
+	case *parse.Fallthrough:
+		s.errorf(n, "fallthrough statements are not supported yet")
+	default:
+		s.errorf(n, "this statement is not supported yet")
+	}
+}
+
+// vars checks that the variables ids, which are being declared, are
+// words.
+func (s *supported) vars(ids []*parse.Ident) {
+	for _, id := range ids {
+		if id.Name == "_" || id.Info == nil {
+			continue
+		}
+		if !isWord(id.Info.T) {
+			s.errorf(id, "variables of type %s are not supported yet", id.Info.T)
+		}
+	}
+}
+
+// target checks the left of an assignment, which can only be a variable
+// so far.
+func (s *supported) target(e *parse.Expr) {
+	if identOf(e) == nil {
+		s.errorf(e, "assigning to %s is not supported yet", exprString(e))
+	}
+}
+
+// exprStmt checks the expression statement e: a call of a function, or
+// of one of the built-ins that print.
+func (s *supported) exprStmt(e *parse.Expr) {
+	switch name := calledBuiltin(e); name {
+	case "":
+		s.expr(e)
+	case "print", "println", "panic":
+		for _, a := range callArgs(e) {
+			s.printed(a)
+		}
+	default:
+		s.errorf(e, "%s is not supported yet", name)
+	}
+}
+
+// printed checks an argument of print, println or panic.
+func (s *supported) printed(a *parse.Expr) {
+	v, ok := s.p.consts[a]
+	if !ok {
+		s.expr(a)
+		return
+	}
+	switch v.Kind() {
+	case constant.String, constant.Bool, constant.Int:
+	default:
+		x := &operand{mode: constexpr, typ: s.p.types[a], val: v, node: a}
+		s.errorf(a, "printing %s is not supported yet", x)
+	}
+}
+
+func (s *supported) exprs(exprs []*parse.Expr) {
+	for _, e := range exprs {
+		s.expr(e)
+	}
+}
+
+func (s *supported) expr(e *parse.Expr) {
+	s.value(e.Binary())
+}
+
+// value checks the expression tree n, which the lowering computes the
+// value of.
+func (s *supported) value(n parse.Node) {
+	if e, ok := n.(*parse.Expr); ok {
+		n = e.Binary()
+	}
+	if !s.words(n, s.p.types[n]) {
+		return
+	}
+	if _, ok := s.p.consts[n]; ok {
+		// constants are folded
+		return
+	}
+	switch n := n.(type) {
+	case *parse.BinaryE:
+		s.value(n.X)
+		s.value(n.Y)
+	case *parse.UnaryE:
+		switch n.Op {
+		case "", "+", "-", "^", "!":
+			s.value(n.Expr)
+		default:
+			s.errorf(n, "the %s operator is not supported yet", n.Op)
+		}
+	case *parse.PrimaryE:
+		s.operand(n)
+	default:
+		s.errorf(n, "%s is not supported yet", exprString(n))
+	}
+}
+
+// words reports whether values of type t, the type of n, fit in words,
+// and reports an error if they don't. Calls have a tuple of them.
+func (s *supported) words(n parse.Node, t stable.Type) bool {
+	switch t := t.(type) {
+	case nil:
+		return true
+	case stable.Tuple:
+		for _, t := range t {
+			if !s.words(n, t) {
+				return false
+			}
+		}
+		return true
+	}
+	if !isWord(t) {
+		s.errorf(n, "values of type %s are not supported yet", t)
+		return false
+	}
+	return true
+}
+
+// operand checks the operand e: a variable, a conversion, or a call of
+// a function.
+func (s *supported) operand(e *parse.PrimaryE) {
+	if arg, _ := conversionOf(e); arg != nil {
+		// the checker only lets integer conversions through
+		s.expr(arg)
+		return
+	}
+	switch x := e.Expr.(type) {
+	case *parse.Builtin:
+		s.errorf(e, "%s is not supported yet", x.Name.Name)
+		return
+	case *parse.Ident:
+		if x.Info != nil && x.Info.Kind == stable.Builtin {
+			s.errorf(e, "%s is not supported yet", x.Name)
+			return
+		}
+	}
+	id, ok := e.Expr.(*parse.Ident)
+	switch {
+	case ok && e.Prime == nil:
+		return
+	case ok && e.Prime.Prime == nil && id.Info != nil && id.Info.Kind == stable.Func:
+		if c, ok := e.Prime.Expr.(*parse.Call); ok {
+			if c.Args != nil {
+				s.exprs(c.Args.Exprs)
+			}
+			return
+		}
+	}
+	prime := e.Prime
+	if prime == nil {
+		s.errorf(e, "%s is not supported yet", exprString(e))
+		return
+	}
+	switch prime.Expr.(type) {
+	case *parse.Selector:
+		s.errorf(e, "selector %s is not supported yet", exprString(e))
+	case *parse.Index:
+		s.errorf(e, "index expression %s is not supported yet", exprString(e))
+	case *parse.Slice:
+		s.errorf(e, "slice expression %s is not supported yet", exprString(e))
+	case *parse.TypeAssertion:
+		s.errorf(e, "type assertion %s is not supported yet", exprString(e))
+	default:
+		s.errorf(e, "calling %s is not supported yet", exprString(e))
+	}
+}
@@ -0,0 +1,1787 @@
+package semantic
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/samertm/chompy/parse"
+	"github.com/samertm/chompy/printer"
+	"github.com/samertm/chompy/semantic/constant"
+	"github.com/samertm/chompy/semantic/stable"
+)
+
+// typeCheck works out the type of every expression in the package, and
+// checks that every operator, assignment, call and return is used with
+// operands of the right types. It runs after resolveIdents, so every
+// identifier already points at its NodeInfo.
+//
+// The types are recorded in p.types, for each *parse.Expr and for the
+// *parse.BinaryE, *parse.UnaryE and *parse.PrimaryE nodes that make it
+// up (see parse.Expr.Binary). The types of declared variables and
+// constants that were left out of the source are filled in, and the
+// values of constant expressions are recorded in p.consts.
+func typeCheck(p *pkg) sErrors {
+	c := &checker{
+		p:     p,
+		decls: make(map[*stable.NodeInfo]*pkgDecl),
+	}
+	p.types = make(map[parse.Node]stable.Type)
+	p.consts = make(map[parse.Node]constant.Value)
+	// Package level variables can be used before they're declared, so
+	// their types are worked out on demand.
+	var decls []*pkgDecl
+	for _, t := range p.files {
+		for _, kid := range t.Kids {
+			switch n := kid.(type) {
+			case *parse.Vars:
+				for _, v := range n.Vs {
+					decls = append(decls, c.addDecl(t.Name, v.Idents, v.T, v.Exprs, nil)...)
+				}
+			case *parse.Consts:
+				constSpecs(n.Cs, func(cn *parse.Cnst, typ *parse.Typ, exprs []*parse.Expr, iota int) {
+					decls = append(decls, c.addDecl(t.Name, cn.Is, typ, exprs, constant.MakeInt64(int64(iota)))...)
+				})
+			}
+		}
+	}
+	for _, d := range decls {
+		c.checkDecl(d)
+	}
+	for _, t := range p.files {
+		c.file = t.Name
+		for _, kid := range t.Kids {
+			switch n := kid.(type) {
+			case *parse.Types:
+				c.types(n)
+			case *parse.Funcdecl:
+				c.funcDecl(n)
+			}
+		}
+	}
+	return c.errs
+}
+
+type checker struct {
+	p *pkg
+	// file is the name of the file being checked, for errors
+	file string
+	errs sErrors
+	// package level declarations, by the NodeInfos they declare
+	decls map[*stable.NodeInfo]*pkgDecl
+	// the signature of the function being checked, and whether its
+	// results are named
+	sig          *stable.Signature
+	namedResults bool
+	// iota is the value of iota in the const spec being checked, and
+	// nil outside of const declarations
+	iota constant.Value
+}
+
+func (c *checker) errorf(n parse.Node, format string, a ...interface{}) {
+	c.errs = append(c.errs, errorAt(c.file, n, format, a...))
+}
+
+// states for pkgDecl.state
+const (
+	unvisited = iota
+	visiting
+	visited
+)
+
+// pkgDecl is a package level var or const spec. The type and
+// expressions of a const spec are the ones it has after implicit
+// repetition.
+type pkgDecl struct {
+	file  string
+	ids   []*parse.Ident
+	typ   *parse.Typ
+	exprs []*parse.Expr
+	iota  constant.Value // nil for vars
+	state int            // unvisited, visiting or visited
+}
+
+// addDecl adds the declarations of a spec. Each name with a value of
+// its own is a declaration by itself, so that var x, y = 1, x + 1 only
+// makes y depend on x. Names that share the values of a call, or whose
+// values don't match up with them, are declared together.
+func (c *checker) addDecl(file string, ids []*parse.Ident, typ *parse.Typ, exprs []*parse.Expr, iota constant.Value) []*pkgDecl {
+	if len(ids) > 1 && len(ids) == len(exprs) {
+		var ds []*pkgDecl
+		for i := range ids {
+			ds = append(ds, c.addDecl(file, ids[i:i+1], typ, exprs[i:i+1], iota)...)
+		}
+		return ds
+	}
+	d := &pkgDecl{file: file, ids: ids, typ: typ, exprs: exprs, iota: iota}
+	for _, id := range ids {
+		if id.Info != nil {
+			c.decls[id.Info] = d
+		}
+	}
+	return []*pkgDecl{d}
+}
+
+// checkDecl checks the package level declaration d, if it hasn't been
+// already. It can be called while checking something else.
+func (c *checker) checkDecl(d *pkgDecl) {
+	if d.state != unvisited {
+		return
+	}
+	d.state = visiting
+	file, sig, named, iota := c.file, c.sig, c.namedResults, c.iota
+	c.file, c.sig, c.namedResults, c.iota = d.file, nil, false, d.iota
+	c.valueSpec(d.ids, d.typ, d.exprs, d.iota != nil)
+	c.file, c.sig, c.namedResults, c.iota = file, sig, named, iota
+	d.state = visited
+}
+
+// objType returns the type of the variable or constant ni, working it
+// out first if it's declared at the package level and hasn't been
+// checked yet. id is where ni is used.
+func (c *checker) objType(ni *stable.NodeInfo, id *parse.Ident) stable.Type {
+	if d, ok := c.decls[ni]; ok && ni.T == nil {
+		if d.state == visiting {
+			c.errorf(id, "initialization cycle: %s refers to itself", ni.Name)
+			return nil
+		}
+		c.checkDecl(d)
+	}
+	return ni.T
+}
+
+// types checks that none of the types in t are declared as themselves.
+func (c *checker) types(t *parse.Types) {
+	for _, ts := range t.Typspecs {
+		n, ok := ts.I.Info.T.(*stable.Named)
+		if ok && n.Decl() != nil && n.Underlying() == nil {
+			c.errorf(ts.I, "invalid recursive type %s", n)
+		}
+	}
+}
+
+func (c *checker) funcDecl(f *parse.Funcdecl) {
+	if f.Func == nil || f.Func.Body == nil || f.Name.Info == nil {
+		return
+	}
+	sig, ok := f.Name.Info.T.(*stable.Signature)
+	if !ok {
+		return
+	}
+	c.sig = sig
+	c.namedResults = false
+	if res := f.Func.Sig.Result; res != nil {
+		for _, p := range res.Params {
+			if len(p.Idents) != 0 {
+				c.namedResults = true
+			}
+		}
+	}
+	c.stmts(f.Func.Body.Stmts)
+	c.sig = nil
+}
+
+// valueSpec checks a var or const spec: the values must be assignable
+// to the declared type, and the idents without a declared type get the
+// types of their values.
+func (c *checker) valueSpec(ids []*parse.Ident, typ *parse.Typ, exprs []*parse.Expr, isConst bool) {
+	var t stable.Type
+	if typ != nil {
+		t = typeOf(typ)
+		if t == nil {
+			return // already reported
+		}
+	}
+	if isConst && len(exprs) != len(ids) {
+		for _, e := range exprs {
+			c.expr(e)
+		}
+		if len(exprs) < len(ids) {
+			c.errorf(ids[len(exprs)], "missing init expr for const declaration")
+		} else {
+			c.errorf(exprs[len(ids)], "extra init expr")
+		}
+		return
+	}
+	if len(exprs) == 0 {
+		return
+	}
+	values := c.values(exprs, len(ids))
+	if len(values) != len(ids) {
+		if len(values) != 0 {
+			c.errorf(ids[0], "assignment mismatch: %d variables but %s", len(ids), valueCount(values, exprs))
+		}
+		return
+	}
+	for i, id := range ids {
+		x := values[i]
+		if isConst && x.mode != constexpr && x.mode != invalid {
+			c.errorf(x.node, "%s is not constant", x)
+			continue
+		}
+		if t != nil {
+			context := "variable declaration"
+			if isConst {
+				context = "constant declaration"
+			}
+			c.assignment(x, t, context)
+		} else if x.mode != invalid {
+			c.singleValue(x)
+			if x.mode == invalid {
+				continue
+			}
+			if !isConst {
+				// constants stay untyped
+				c.defaultType(x)
+			}
+		}
+		if id.Info == nil || x.mode == invalid {
+			continue
+		}
+		if id.Info.T == nil {
+			id.Info.T = x.typ
+		}
+		if isConst {
+			id.Info.Val = x.val
+		}
+	}
+}
+
+// constSpecs calls fn for each spec of a const declaration, with the
+// type and expressions that it has after implicit repetition: a spec
+// without either repeats the type and expressions of the last one that
+// had them. iota is the index of the spec in the declaration.
+func constSpecs(cs []*parse.Cnst, fn func(cn *parse.Cnst, typ *parse.Typ, exprs []*parse.Expr, iota int)) {
+	var typ *parse.Typ
+	var exprs []*parse.Expr
+	for i, cn := range cs {
+		if cn.T != nil || len(cn.Es) != 0 {
+			typ, exprs = cn.T, cn.Es
+		}
+		fn(cn, typ, exprs, i)
+	}
+}
+
+// values checks the expressions on the right hand side of an
+// assignment to n things. A single call can provide all n values.
+func (c *checker) values(exprs []*parse.Expr, n int) []*operand {
+	if len(exprs) == 1 && n > 1 {
+		x := c.expr(exprs[0])
+		if tu, ok := x.typ.(stable.Tuple); ok && x.mode == value {
+			var xs []*operand
+			for _, t := range tu {
+				xs = append(xs, &operand{mode: value, typ: t, node: exprs[0]})
+			}
+			return xs
+		}
+		if x.commaOK && n == 2 {
+			// v, ok = m[k], x.(T) or <-ch
+			x.mode = value
+			return []*operand{x, {mode: value, typ: stable.UntypedBool, node: exprs[0]}}
+		}
+		if x.mode == invalid {
+			return nil
+		}
+		return []*operand{x}
+	}
+	var xs []*operand
+	for _, e := range exprs {
+		xs = append(xs, c.expr(e))
+	}
+	return xs
+}
+
+// valueCount describes how many values there are, for errors.
+func valueCount(values []*operand, exprs []*parse.Expr) string {
+	if len(exprs) == 1 && len(values) > 1 {
+		return fmtCount(len(values), "value") + " returned by " + exprString(exprs[0])
+	}
+	return fmtCount(len(values), "value")
+}
+
+func fmtCount(n int, what string) string {
+	s := fmt.Sprintf("%d %s", n, what)
+	if n != 1 {
+		s += "s"
+	}
+	return s
+}
+
+func (c *checker) stmts(stmts []parse.Node) {
+	for _, s := range stmts {
+		c.stmt(s)
+	}
+}
+
+func (c *checker) stmt(stmt parse.Node) {
+	switch n := stmt.(type) {
+	case nil:
+	case *parse.Vars:
+		for _, v := range n.Vs {
+			c.valueSpec(v.Idents, v.T, v.Exprs, false)
+		}
+	case *parse.Consts:
+		constSpecs(n.Cs, func(cn *parse.Cnst, typ *parse.Typ, exprs []*parse.Expr, iota int) {
+			c.iota = constant.MakeInt64(int64(iota))
+			c.valueSpec(cn.Is, typ, exprs, true)
+		})
+		c.iota = nil
+	case *parse.Types:
+		c.types(n)
+	case *parse.Block:
+		c.stmts(n.Stmts)
+	case *parse.LabeledStmt:
+		c.stmt(n.Stmt)
+	case *parse.ExprStmt:
+		c.exprStmt(n.Expr)
+	case *parse.Expr:
+		c.exprStmt(n)
+	case *parse.SendStmt:
+		c.send(n)
+	case *parse.IncDecStmt:
+		x := c.node(n.Expr)
+		if x.mode == invalid {
+			return
+		}
+		if !isNumeric(x.typ) {
+			c.errorf(n, "invalid operation: %s%s (non-numeric type %s)", exprString(n.Expr), n.Postfix, x.typ)
+			return
+		}
+		c.assignable(x)
+	case *parse.Assign:
+		c.assign(n)
+	case *parse.ShortVarDecl:
+		c.shortVarDecl(n)
+	case *parse.IfStmt:
+		c.stmt(n.SimpleStmt)
+		c.condition(n.Expr, "if")
+		if n.Body != nil {
+			c.stmts(n.Body.Stmts)
+		}
+		c.stmt(n.Else)
+	case *parse.ForStmt:
+		switch cl := n.Clause.(type) {
+		case nil:
+		case *parse.ForClause:
+			c.stmt(cl.InitStmt)
+			if cl.Condition != nil {
+				c.condition(cl.Condition, "for")
+			}
+			if _, ok := cl.PostStmt.(*parse.ShortVarDecl); ok {
+				c.errorf(cl.PostStmt, "cannot declare in post statement of for loop")
+			} else {
+				c.stmt(cl.PostStmt)
+			}
+		case *parse.RangeClause:
+			c.rangeClause(cl)
+		default:
+			c.condition(cl, "for")
+		}
+		if n.Body != nil {
+			c.stmts(n.Body.Stmts)
+		}
+	case *parse.GoStmt:
+		c.callStmt(n.Expr, "go")
+	case *parse.DeferStmt:
+		c.callStmt(n.Expr, "defer")
+	case *parse.ReturnStmt:
+		c.returnStmt(n)
+	}
+}
+
+func (c *checker) send(s *parse.SendStmt) {
+	ch := c.node(s.Chan)
+	x := c.node(s.Expr)
+	c.singleValue(ch)
+	if ch.mode == invalid || x.mode == invalid {
+		return
+	}
+	t, ok := ch.typ.Underlying().(*stable.Chan)
+	if !ok {
+		c.errorf(s, "invalid operation: cannot send to non-channel %s", ch)
+		return
+	}
+	if t.Dir == stable.RecvOnly {
+		c.errorf(s, "invalid operation: cannot send to receive-only channel %s", ch)
+		return
+	}
+	c.assignment(x, t.Elem, "send")
+}
+
+// exprStmt checks an expression used as a statement. Only calls may be.
+func (c *checker) exprStmt(n parse.Node) {
+	x := c.node(n)
+	if x.mode == invalid {
+		return
+	}
+	switch calledBuiltin(n) {
+	case "append", "cap", "len", "make", "new":
+		// these only compute values
+	default:
+		if isCall(n) {
+			return
+		}
+	}
+	c.errorf(n, "%s is not used", x)
+}
+
+// isCall reports whether the expression n is a function call (and not a
+// conversion).
+func isCall(n parse.Node) bool {
+	if e, ok := n.(*parse.Expr); ok {
+		n = e.Binary()
+	}
+	u, ok := n.(*parse.UnaryE)
+	if !ok || u.Op != "" {
+		return false
+	}
+	pe, ok := u.Expr.(*parse.PrimaryE)
+	if !ok || pe.Prime == nil {
+		return false
+	}
+	last := pe.Prime
+	for last.Prime != nil {
+		last = last.Prime
+	}
+	if _, ok := last.Expr.(*parse.Call); !ok {
+		return false
+	}
+	if id, ok := pe.Expr.(*parse.Ident); ok && pe.Prime == last && id.Info != nil {
+		return id.Info.Kind != stable.TypeName
+	}
+	return true
+}
+
+func (c *checker) callStmt(n parse.Node, keyword string) {
+	x := c.node(n)
+	if x.mode == invalid {
+		return
+	}
+	if !isCall(n) {
+		c.errorf(n, "expression in %s must be function call", keyword)
+	}
+}
+
+// condition checks the condition of an if or for statement.
+func (c *checker) condition(n parse.Node, keyword string) {
+	x := c.node(n)
+	if x.mode == invalid {
+		return
+	}
+	c.singleValue(x)
+	if x.mode != invalid && !isBoolean(x.typ) {
+		c.errorf(n, "non-boolean condition in %s statement", keyword)
+	}
+}
+
+func (c *checker) assign(a *parse.Assign) {
+	if a.Op != "=" {
+		// x op= y
+		op := strings.TrimSuffix(a.Op, "=")
+		if len(a.LeftExpr) != 1 || len(a.RightExpr) != 1 {
+			c.errorf(a, "assignment operation %s requires single-valued expressions", a.Op)
+			return
+		}
+		x := c.expr(a.LeftExpr[0])
+		y := c.expr(a.RightExpr[0])
+		if x.mode == invalid || y.mode == invalid {
+			return
+		}
+		z := c.binaryOp(a, op, x, y)
+		if z.mode == invalid {
+			return
+		}
+		if c.assignable(x) {
+			c.assignment(z, x.typ, "assignment")
+		}
+		return
+	}
+	values := c.values(a.RightExpr, len(a.LeftExpr))
+	if len(values) != len(a.LeftExpr) {
+		for _, e := range a.LeftExpr {
+			if blank(e) == nil {
+				c.expr(e)
+			}
+		}
+		if len(values) != 0 {
+			c.errorf(a, "assignment mismatch: %s but %s", fmtCount(len(a.LeftExpr), "variable"), valueCount(values, a.RightExpr))
+		}
+		return
+	}
+	for i, e := range a.LeftExpr {
+		y := values[i]
+		if blank(e) != nil {
+			c.singleValue(y)
+			c.defaultType(y)
+			continue
+		}
+		x := c.expr(e)
+		if x.mode == invalid || !c.assignable(x) {
+			continue
+		}
+		c.assignment(y, x.typ, "assignment")
+	}
+}
+
+// assignable reports whether x can be assigned to, and reports an error
+// if it can't.
+func (c *checker) assignable(x *operand) bool {
+	if x.mode == variable || x.mode == mapindex {
+		return true
+	}
+	c.errorf(x.node, "cannot assign to %s (neither addressable nor a map index expression)", exprString(x.node))
+	return false
+}
+
+func (c *checker) shortVarDecl(s *parse.ShortVarDecl) {
+	values := c.values(s.Exprs, len(s.Idents))
+	if len(values) != len(s.Idents) {
+		if len(values) != 0 {
+			c.errorf(s, "assignment mismatch: %s but %s", fmtCount(len(s.Idents), "variable"), valueCount(values, s.Exprs))
+		}
+		return
+	}
+	for i, id := range s.Idents {
+		x := values[i]
+		c.singleValue(x)
+		if id.Info == nil || x.mode == invalid {
+			continue
+		}
+		if id.Info.T != nil {
+			// an existing variable being assigned to
+			if id.Info.Kind != stable.Var {
+				c.errorf(id, "cannot assign to %s (neither addressable nor a map index expression)", id.Name)
+				continue
+			}
+			c.assignment(x, id.Info.T, "assignment")
+			continue
+		}
+		c.defaultType(x)
+		id.Info.T = x.typ
+	}
+}
+
+func (c *checker) rangeClause(r *parse.RangeClause) {
+	x := c.node(r.Expr)
+	if x.mode == invalid {
+		return
+	}
+	c.singleValue(x)
+	if x.mode == invalid {
+		return
+	}
+	integer := stable.Predeclared("int")
+	var types []stable.Type
+	u := x.typ.Underlying()
+	if p, ok := u.(*stable.Pointer); ok {
+		if a, ok := p.Elem.Underlying().(*stable.Array); ok {
+			u = a
+		}
+	}
+	switch t := u.(type) {
+	case *stable.Basic:
+		if t.IsString() {
+			c.defaultType(x)
+			types = []stable.Type{integer, stable.Predeclared("rune")}
+		}
+	case *stable.Array:
+		types = []stable.Type{integer, t.Elem}
+	case *stable.Slice:
+		types = []stable.Type{integer, t.Elem}
+	case *stable.Map:
+		types = []stable.Type{t.Key, t.Elem}
+	case *stable.Chan:
+		if t.Dir != stable.SendOnly {
+			types = []stable.Type{t.Elem}
+		}
+	}
+	if types == nil {
+		c.errorf(r.Expr, "cannot range over %s", x)
+		return
+	}
+	if len(r.Idents) > len(types) || len(r.Exprs) > len(types) {
+		c.errorf(r, "range clause permits at most %s", fmtCount(len(types), "iteration variable"))
+		return
+	}
+	if x.mode != constexpr {
+		// only constant strings are lowered so far
+		// TODO: range over string variables, arrays and slices, once
+		// the IR has values that don't fit in a word
+		c.errorf(r.Expr, "ranging over %s is not supported yet", x)
+	}
+	for i, id := range r.Idents {
+		if id.Info != nil {
+			id.Info.T = types[i]
+		}
+	}
+	for i, e := range r.Exprs {
+		if blank(e) != nil {
+			continue
+		}
+		y := c.expr(e)
+		if y.mode == invalid || !c.assignable(y) {
+			continue
+		}
+		c.assignment(&operand{mode: value, typ: types[i], node: r.Expr}, y.typ, "range")
+	}
+}
+
+func (c *checker) returnStmt(r *parse.ReturnStmt) {
+	if c.sig == nil {
+		return
+	}
+	want := c.sig.Results
+	if len(r.Exprs) == 0 {
+		if len(want) != 0 && !c.namedResults {
+			c.errorf(r, "not enough return values\n\thave ()\n\twant %s", stable.Tuple(want))
+		}
+		return
+	}
+	values := c.values(r.Exprs, len(want))
+	if len(values) != len(want) {
+		if len(values) == 0 {
+			return
+		}
+		var have []stable.Type
+		for _, x := range values {
+			have = append(have, x.typ)
+		}
+		msg := "too many return values"
+		if len(values) < len(want) {
+			msg = "not enough return values"
+		}
+		c.errorf(r, "%s\n\thave %s\n\twant %s", msg, stable.Tuple(have), stable.Tuple(want))
+		return
+	}
+	for i, x := range values {
+		c.assignment(x, want[i], "return statement")
+	}
+}
+
+// operand modes
+const (
+	invalid   = iota
+	novalue   // a call with no results
+	value     // a value that can't be assigned to
+	variable  // an addressable value
+	mapindex  // m[k], which can be assigned to but isn't addressable
+	constexpr // a constant, with a value
+	typexpr   // a type
+	builtin   // a built-in function, which has to be called
+)
+
+// An operand is the result of checking an expression.
+type operand struct {
+	mode int
+	typ  stable.Type
+	// node is the expression, for errors
+	node parse.Node
+	// commaOK is set for map indexes, type assertions and receives,
+	// which can also produce a second, boolean value
+	commaOK bool
+	// val is the value of a constant
+	val constant.Value
+}
+
+// String describes x for errors, like "x (variable of type int)".
+func (x *operand) String() string {
+	s := exprString(x.node)
+	switch x.mode {
+	case novalue:
+		return s + " (no value)"
+	case typexpr:
+		return s + " (type)"
+	case builtin:
+		return s + " (built-in)"
+	case constexpr:
+		// the value is left out if it's what was written
+		var val string
+		if x.val != nil && x.val.String() != s {
+			val = " " + x.val.String()
+		}
+		if isUntyped(x.typ) {
+			return s + " (" + x.typ.String() + " constant" + val + ")"
+		}
+		return s + " (constant" + val + " of type " + x.typ.String() + ")"
+	case variable:
+		return s + " (variable of type " + x.typ.String() + ")"
+	case mapindex:
+		return s + " (map index expression of type " + x.typ.String() + ")"
+	}
+	if isUntyped(x.typ) {
+		return s + " (" + x.typ.String() + " value)"
+	}
+	return s + " (value of type " + x.typ.String() + ")"
+}
+
+// exprString returns the source of the expression n.
+func exprString(n parse.Node) string {
+	var b bytes.Buffer
+	printer.Fprint(&b, n)
+	return b.String()
+}
+
+func (c *checker) record(n parse.Node, x *operand) {
+	if x.mode != invalid && x.mode != typexpr && x.mode != builtin {
+		c.p.types[n] = x.typ
+	}
+	if x.mode == constexpr && x.val != nil {
+		c.p.consts[n] = x.val
+	}
+}
+
+// expr checks the expression e.
+func (c *checker) expr(e *parse.Expr) *operand {
+	x := c.node(e.Binary())
+	x.node = e
+	c.record(e, x)
+	return x
+}
+
+// node checks any of the expression nodes.
+func (c *checker) node(n parse.Node) *operand {
+	var x *operand
+	switch n := n.(type) {
+	case *parse.Expr:
+		return c.expr(n)
+	case *parse.BinaryE:
+		x = c.binary(n)
+	case *parse.UnaryE:
+		x = c.unary(n)
+	case *parse.PrimaryE:
+		x = c.primary(n)
+	default:
+		x = c.operand(n)
+	}
+	x.node = n
+	c.record(n, x)
+	return x
+}
+
+func (c *checker) binary(b *parse.BinaryE) *operand {
+	x := c.node(b.X)
+	y := c.node(b.Y)
+	if x.mode == invalid || y.mode == invalid {
+		return &operand{}
+	}
+	return c.binaryOp(b, b.Op, x, y)
+}
+
+// binaryOp checks x op y. n is the whole expression, for errors.
+func (c *checker) binaryOp(n parse.Node, op string, x, y *operand) *operand {
+	c.singleValue(x)
+	c.singleValue(y)
+	if x.mode == invalid || y.mode == invalid {
+		return &operand{}
+	}
+	mode := value
+	if x.mode == constexpr && y.mode == constexpr {
+		mode = constexpr
+	}
+	if op == "<<" || op == ">>" {
+		return c.shift(n, op, x, y, mode)
+	}
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return c.comparison(n, op, x, y, mode)
+	}
+	if !c.matchTypes(x, y) {
+		if x.mode != invalid && y.mode != invalid {
+			c.errorf(n, "invalid operation: %s (mismatched types %s and %s)", exprString(n), x.typ, y.typ)
+		}
+		return &operand{}
+	}
+	var ok bool
+	switch op {
+	case "&&", "||":
+		ok = isBoolean(x.typ)
+	case "+":
+		ok = isNumeric(x.typ) || isString(x.typ)
+	case "-", "*", "/":
+		ok = isNumeric(x.typ)
+	case "%", "&", "|", "^", "&^":
+		ok = isInteger(x.typ)
+	}
+	if !ok {
+		c.errorf(n, "invalid operation: operator %s not defined on %s", op, x)
+		return &operand{}
+	}
+	if (op == "/" || op == "%") && y.mode == constexpr && constant.Sign(y.val) == 0 &&
+		(x.mode == constexpr || isInteger(x.typ)) {
+		c.errorf(n, "invalid operation: division by zero")
+		return &operand{}
+	}
+	res := &operand{mode: mode, typ: x.typ, node: n}
+	if mode == constexpr {
+		xv, yv := x.val, y.val
+		if isInteger(x.typ) {
+			// untyped integer constants divide like integers too
+			xv, yv = constant.ToInt(xv), constant.ToInt(yv)
+		}
+		res.val = constant.BinaryOp(xv, op, yv)
+		c.overflow(res)
+	}
+	return res
+}
+
+// overflow reports an error if the value of the typed constant x
+// doesn't fit its type, and rounds typed floats.
+func (c *checker) overflow(x *operand) {
+	if x.mode != constexpr || isUntyped(x.typ) {
+		return
+	}
+	if cause := c.representable(x, x.typ); cause != "" {
+		c.errorf(x.node, "%s overflows %s", x, x.typ)
+		x.mode = invalid
+	}
+}
+
+// representable reports why the constant x can't be held by the basic
+// type t: "overflows" or "truncated", or "" if it can. If it can, x's
+// value is converted to t: floats are rounded, and integral floats
+// become ints.
+func (c *checker) representable(x *operand, t stable.Type) string {
+	b := basic(t)
+	if x.mode != constexpr || x.val == nil || b == nil {
+		return ""
+	}
+	v, cause := representable(x.val, b)
+	if cause == "" {
+		x.val = v
+		if x.node != nil {
+			c.p.consts[x.node] = v
+		}
+	}
+	return cause
+}
+
+func representable(v constant.Value, b *stable.Basic) (constant.Value, string) {
+	switch {
+	case b.IsInteger():
+		i := constant.ToInt(v)
+		if i.Kind() != constant.Int {
+			return v, "truncated"
+		}
+		if b.IsUntyped() {
+			return i, ""
+		}
+		bits := uint(stable.ARM.Sizeof(b) * 8)
+		if !constant.Representable(i, bits, b.IsUnsigned()) {
+			return v, "overflows"
+		}
+		return i, ""
+	case b.IsFloat():
+		f := constant.ToFloat(v)
+		switch b.Name {
+		case "float32":
+			r, _ := constant.Float32Val(f)
+			if math.IsInf(float64(r), 0) {
+				return v, "overflows"
+			}
+			return constant.MakeFloat64(float64(r)), ""
+		case "float64":
+			r, _ := constant.Float64Val(f)
+			if math.IsInf(r, 0) {
+				return v, "overflows"
+			}
+			return constant.MakeFloat64(r), ""
+		}
+		return f, ""
+	}
+	return v, ""
+}
+
+// comparison checks x op y where op is one of the comparison operators.
+// The operands need only be assignable to each other, and the result is
+// an untyped bool.
+func (c *checker) comparison(n parse.Node, op string, x, y *operand, mode int) *operand {
+	if !c.matchTypes(x, y) && !stable.AssignableTo(x.typ, y.typ) && !stable.AssignableTo(y.typ, x.typ) {
+		if x.mode == invalid || y.mode == invalid {
+			return &operand{}
+		}
+		c.errorf(n, "invalid operation: %s (mismatched types %s and %s)", exprString(n), x.typ, y.typ)
+		return &operand{}
+	}
+	if mode != constexpr && isUntyped(x.typ) && isUntyped(y.typ) && !isNil(x.typ) {
+		// 1<<s == 2 compares ints
+		c.defaultType(x)
+		c.defaultType(y)
+	}
+	if op == "==" || op == "!=" {
+		// slices, maps and funcs can still be compared with nil
+		xnil, ynil := isNil(x.typ), isNil(y.typ)
+		switch {
+		case xnil && ynil:
+			c.errorf(n, "invalid operation: %s (operator %s not defined on nil)", exprString(n), op)
+			return &operand{}
+		case xnil || ynil:
+		case !stable.Comparable(x.typ):
+			c.errorf(n, "invalid operation: %s (%s cannot be compared)", exprString(n), x.typ)
+			return &operand{}
+		}
+	} else if !isOrdered(x.typ) {
+		c.errorf(n, "invalid operation: %s (operator %s not defined on %s)", exprString(n), op, x)
+		return &operand{}
+	}
+	res := &operand{mode: mode, typ: stable.UntypedBool}
+	if mode == constexpr {
+		res.val = constant.MakeBool(constant.Compare(x.val, op, y.val))
+	}
+	return res
+}
+
+// matchTypes converts an untyped operand to the type of the other one,
+// and reports whether x and y then have identical types.
+func (c *checker) matchTypes(x, y *operand) bool {
+	switch xu, yu := isUntyped(x.typ), isUntyped(y.typ); {
+	case xu && yu:
+		t := untypedJoin(x.typ, y.typ)
+		if t == nil {
+			return false
+		}
+		x.typ, y.typ = t, t
+		return true
+	case xu:
+		if !c.convertUntyped(x, y.typ) {
+			return false
+		}
+	case yu:
+		if !c.convertUntyped(y, x.typ) {
+			return false
+		}
+	}
+	return stable.Identical(x.typ, y.typ)
+}
+
+// convertUntyped gives the untyped operand x the type t of the other
+// operand of a binary operation, if it can have it. It reports an
+// error, and invalidates x, if x is a constant that t can't represent.
+func (c *checker) convertUntyped(x *operand, t stable.Type) bool {
+	if !implicitlyConverts(x.typ, t) {
+		return false
+	}
+	switch c.representable(x, t) {
+	case "overflows":
+		c.errorf(x.node, "%s overflows %s", x, t)
+		x.mode = invalid
+		return false
+	case "truncated":
+		c.errorf(x.node, "%s truncated to %s", x, t)
+		x.mode = invalid
+		return false
+	}
+	it := implicitType(x.typ, t)
+	c.setType(x.node, it)
+	x.typ = it
+	return true
+}
+
+// untypedJoin returns the type of an operation on untyped operands of
+// types x and y, or nil if they can't be mixed.
+func untypedJoin(x, y stable.Type) stable.Type {
+	if stable.Identical(x, y) {
+		return x
+	}
+	// numeric kinds mix, and the result is the later kind
+	rank := map[string]int{"untyped int": 1, "untyped rune": 2, "untyped float": 3}
+	xr, yr := rank[x.(*stable.Basic).Name], rank[y.(*stable.Basic).Name]
+	if xr == 0 || yr == 0 {
+		return nil
+	}
+	if xr > yr {
+		return x
+	}
+	return y
+}
+
+// shiftBound is the largest constant shift count allowed: enough to
+// shift 1 to the largest float64.
+const shiftBound = 1023 - 1 + 52
+
+func (c *checker) shift(n parse.Node, op string, x, y *operand, mode int) *operand {
+	if x.mode == constexpr && isUntyped(x.typ) && !isInteger(x.typ) {
+		// an untyped constant with an integral value can be shifted
+		if i := constant.ToInt(x.val); i.Kind() == constant.Int {
+			x.typ, x.val = stable.UntypedInt, i
+		}
+	}
+	if !isInteger(y.typ) {
+		c.errorf(n, "invalid operation: shift count %s must be integer", y)
+		return &operand{}
+	}
+	if y.mode == constexpr {
+		if constant.Sign(y.val) < 0 {
+			c.errorf(y.node, "invalid shift count %s", y)
+			return &operand{}
+		}
+		if isUntyped(y.typ) {
+			y.val = constant.ToInt(y.val)
+		}
+	}
+	if isUntyped(y.typ) {
+		c.setType(y.node, stable.Predeclared("uint"))
+		y.typ = stable.Predeclared("uint")
+	}
+	if !isInteger(x.typ) {
+		c.errorf(n, "invalid operation: shifted operand %s must be integer", x)
+		return &operand{}
+	}
+	// A non-constant shift of an untyped constant stays untyped, like
+	// the constant would on its own, until the context gives it a type
+	// (see setType). var b uint8 = 1 << s shifts a uint8.
+	res := &operand{mode: mode, typ: x.typ, node: n}
+	if mode == constexpr {
+		s, ok := constant.Int64Val(y.val)
+		if !ok || s > shiftBound {
+			c.errorf(y.node, "invalid shift count %s", y)
+			return &operand{}
+		}
+		res.val = constant.Shift(x.val, op, uint(s))
+		c.overflow(res)
+	}
+	return res
+}
+
+func (c *checker) unary(u *parse.UnaryE) *operand {
+	x := c.node(u.Expr)
+	if u.Op == "" || x.mode == invalid {
+		return x
+	}
+	if u.Op == "*" && x.mode == typexpr {
+		// *T is a pointer type
+		return &operand{mode: typexpr, typ: &stable.Pointer{Elem: x.typ}}
+	}
+	c.singleValue(x)
+	if x.mode == invalid {
+		return x
+	}
+	switch u.Op {
+	case "&":
+		if x.mode != variable {
+			c.errorf(u, "invalid operation: cannot take address of %s", x)
+			return &operand{}
+		}
+		return &operand{mode: value, typ: &stable.Pointer{Elem: x.typ}}
+	case "*":
+		p, ok := underlying(x.typ).(*stable.Pointer)
+		if !ok {
+			c.errorf(u, "invalid operation: cannot indirect %s", x)
+			return &operand{}
+		}
+		return &operand{mode: variable, typ: p.Elem}
+	case "<-":
+		ch, ok := underlying(x.typ).(*stable.Chan)
+		if !ok {
+			c.errorf(u, "invalid operation: cannot receive from non-channel %s", x)
+			return &operand{}
+		}
+		if ch.Dir == stable.SendOnly {
+			c.errorf(u, "invalid operation: cannot receive from send-only channel %s", x)
+			return &operand{}
+		}
+		return &operand{mode: value, typ: ch.Elem, commaOK: true}
+	}
+	var ok bool
+	switch u.Op {
+	case "+", "-":
+		ok = isNumeric(x.typ)
+	case "!":
+		ok = isBoolean(x.typ)
+	case "^":
+		ok = isInteger(x.typ)
+	}
+	if !ok {
+		c.errorf(u, "invalid operation: operator %s not defined on %s", u.Op, x)
+		return &operand{}
+	}
+	if x.mode != constexpr {
+		return &operand{mode: value, typ: x.typ}
+	}
+	var prec uint
+	if b := basic(x.typ); b.IsUnsigned() {
+		prec = uint(stable.ARM.Sizeof(b) * 8)
+	}
+	res := &operand{mode: constexpr, typ: x.typ, node: u, val: constant.UnaryOp(u.Op, x.val, prec)}
+	c.overflow(res)
+	return res
+}
+
+// operand checks an Operand, a Conversion or a BuiltinCall.
+func (c *checker) operand(n parse.Node) *operand {
+	switch n := n.(type) {
+	case *parse.Lit:
+		t, ok := map[string]stable.Type{
+			"Int":    stable.UntypedInt,
+			"Float":  stable.UntypedFloat,
+			"Rune":   stable.UntypedRune,
+			"String": stable.UntypedString,
+		}[n.Typ]
+		if !ok {
+			break
+		}
+		v := constant.MakeFromLiteral(n.Val, n.Typ)
+		if v.Kind() == constant.Unknown {
+			c.errorf(n, "invalid literal %s", exprString(n))
+			return &operand{}
+		}
+		return &operand{mode: constexpr, typ: t, val: v}
+	case *parse.Ident:
+		return c.ident(n)
+	case *parse.Conversion:
+		t := typeOf(n.Typ)
+		if t == nil {
+			return &operand{}
+		}
+		e, ok := n.Expr.(*parse.Expr)
+		if !ok {
+			break
+		}
+		return c.conversion(n, t, []*parse.Expr{e})
+	case *parse.Builtin:
+		x := c.ident(n.Name)
+		x.node = n.Name
+		if x.mode == invalid {
+			return x
+		}
+		if x.mode != builtin {
+			c.errorf(n.Typ, "%s (type) is not an expression", exprString(n.Typ))
+			return &operand{}
+		}
+		var args []*parse.Expr
+		var dotdotdot bool
+		if n.Args != nil {
+			args, dotdotdot = n.Args.Exprs, n.Args.DotDotDot
+		}
+		return c.builtin(x, n, n.Typ, args, dotdotdot)
+	}
+	c.errorf(n, "unexpected expression %s", exprString(n))
+	return &operand{}
+}
+
+func (c *checker) ident(id *parse.Ident) *operand {
+	ni := id.Info
+	if ni == nil {
+		return &operand{} // already reported
+	}
+	switch ni.Kind {
+	case stable.Var:
+		if t := c.objType(ni, id); t != nil {
+			return &operand{mode: variable, typ: t}
+		}
+	case stable.Const:
+		t := c.objType(ni, id)
+		if t == nil {
+			break
+		}
+		if ni.Val != nil {
+			return &operand{mode: constexpr, typ: t, val: ni.Val}
+		}
+		// Every other constant has a value once it's been checked
+		// without errors, so this is the predeclared iota.
+		if ni.Name != "iota" {
+			break
+		}
+		if c.iota == nil {
+			c.errorf(id, "cannot use iota outside constant declaration")
+			break
+		}
+		return &operand{mode: constexpr, typ: t, val: c.iota}
+	case stable.TypeName:
+		if ni.T != nil {
+			return &operand{mode: typexpr, typ: ni.T}
+		}
+	case stable.Func:
+		if ni.T != nil {
+			return &operand{mode: value, typ: ni.T}
+		}
+	case stable.Nil:
+		return &operand{mode: value, typ: stable.UntypedNil}
+	case stable.Builtin:
+		return &operand{mode: builtin}
+	case stable.Package:
+		c.errorf(id, "use of package %s without selector", id.Name)
+	}
+	return &operand{}
+}
+
+// primary checks an operand followed by selectors, indexes, slices, type
+// assertions and calls.
+func (c *checker) primary(pe *parse.PrimaryE) *operand {
+	x := c.node(pe.Expr)
+	for pr := pe.Prime; pr != nil && x.mode != invalid; pr = pr.Prime {
+		// for errors, x is everything up to pr
+		x.node = prefix(pe, pr)
+		if _, ok := pr.Expr.(*parse.Call); !ok {
+			c.singleValue(x)
+			if x.mode == invalid {
+				break
+			}
+		}
+		switch p := pr.Expr.(type) {
+		case *parse.Selector:
+			x = c.selector(x, p)
+		case *parse.Index:
+			x = c.index(x, p)
+		case *parse.Slice:
+			x = c.slice(x, p)
+		case *parse.TypeAssertion:
+			x = c.typeAssertion(x, p)
+		case *parse.Call:
+			x = c.call(x, p)
+		}
+	}
+	return x
+}
+
+// prefix returns the part of the primary expression pe that comes
+// before pr. The result shares nodes with pe, and is only for printing.
+func prefix(pe, pr *parse.PrimaryE) parse.Node {
+	first := &parse.PrimaryE{Expr: pe.Expr}
+	last := first
+	for p := pe.Prime; p != nil && p != pr; p = p.Prime {
+		next := &parse.PrimaryE{Expr: p.Expr}
+		last.Prime = next
+		last = next
+	}
+	return first
+}
+
+// selector checks x.f, where f is a field or a method of x's type. A
+// pointer to a struct is dereferenced automatically.
+func (c *checker) selector(x *operand, s *parse.Selector) *operand {
+	name := s.Ident.Name
+	if x.mode != typexpr {
+		if f := field(x.typ, name, c.p.path); f != nil {
+			mode := x.mode
+			if _, ok := underlying(x.typ).(*stable.Pointer); ok {
+				// p.f is (*p).f
+				mode = variable
+			} else if mode != variable {
+				mode = value
+			}
+			return &operand{mode: mode, typ: f.Type}
+		}
+	}
+	if m := method(x.typ, name); m != nil {
+		if x.mode == typexpr {
+			// a method expression takes the receiver first
+			params := append([]stable.Type{x.typ}, m.Sig.Params...)
+			return &operand{mode: value, typ: &stable.Signature{Params: params, Results: m.Sig.Results, Variadic: m.Sig.Variadic}}
+		}
+		return &operand{mode: value, typ: m.Sig}
+	}
+	c.errorf(s, "%s.%s undefined (type %s has no field or method %s)", exprString(x.node), name, x.typ, name)
+	return &operand{}
+}
+
+// field finds the field called name in the struct t or *t, searching
+// embedded structs breadth first. Unexported fields are only found from
+// the package pkg that declared them.
+func field(t stable.Type, name, pkg string) *stable.Field {
+	if p, ok := underlying(t).(*stable.Pointer); ok {
+		t = p.Elem
+	}
+	st, ok := underlying(t).(*stable.Struct)
+	if !ok {
+		return nil
+	}
+	var embedded []stable.Type
+	for _, f := range st.Fields {
+		if f.Name == name && (stable.IsExported(name) || f.Pkg == pkg) {
+			return f
+		}
+		if f.Embedded {
+			embedded = append(embedded, f.Type)
+		}
+	}
+	for _, e := range embedded {
+		if f := field(e, name, pkg); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// method finds the method called name of t, *t or of the interface t.
+func method(t stable.Type, name string) *stable.Method {
+	if i, ok := underlying(t).(*stable.Interface); ok {
+		return i.Method(name)
+	}
+	if p, ok := t.(*stable.Pointer); ok {
+		t = p.Elem
+	}
+	n, ok := t.(*stable.Named)
+	if !ok {
+		return nil
+	}
+	for _, m := range n.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+func (c *checker) index(x *operand, i *parse.Index) *operand {
+	u := underlying(x.typ)
+	if p, ok := u.(*stable.Pointer); ok {
+		// a pointer to an array can be indexed like the array
+		if a, ok := underlying(p.Elem).(*stable.Array); ok {
+			c.integerIndex(i.Expr)
+			return &operand{mode: variable, typ: a.Elem}
+		}
+	}
+	switch t := u.(type) {
+	case *stable.Basic:
+		if t.IsString() {
+			c.integerIndex(i.Expr)
+			return &operand{mode: value, typ: stable.Predeclared("byte")}
+		}
+	case *stable.Array:
+		c.integerIndex(i.Expr)
+		mode := value
+		if x.mode == variable {
+			mode = variable
+		}
+		return &operand{mode: mode, typ: t.Elem}
+	case *stable.Slice:
+		c.integerIndex(i.Expr)
+		return &operand{mode: variable, typ: t.Elem}
+	case *stable.Map:
+		k := c.node(i.Expr)
+		c.assignment(k, t.Key, "map index")
+		return &operand{mode: mapindex, typ: t.Elem, commaOK: true}
+	}
+	c.errorf(i, "invalid operation: cannot index %s", x)
+	return &operand{}
+}
+
+func (c *checker) slice(x *operand, s *parse.Slice) *operand {
+	var t stable.Type
+	switch u := underlying(x.typ).(type) {
+	case *stable.Basic:
+		if u.IsString() {
+			if s.Cap != nil {
+				c.errorf(s, "invalid operation: 3-index slice of string")
+				return &operand{}
+			}
+			t = x.typ
+			if isUntyped(t) {
+				t = stable.Predeclared("string")
+			}
+		}
+	case *stable.Array:
+		if x.mode != variable {
+			c.errorf(s, "invalid operation: %s (slice of unaddressable value)", exprString(x.node))
+			return &operand{}
+		}
+		t = &stable.Slice{Elem: u.Elem}
+	case *stable.Pointer:
+		if a, ok := underlying(u.Elem).(*stable.Array); ok {
+			t = &stable.Slice{Elem: a.Elem}
+		}
+	case *stable.Slice:
+		t = x.typ
+	}
+	if t == nil {
+		c.errorf(s, "cannot slice %s", x)
+		return &operand{}
+	}
+	for _, n := range []parse.Node{s.Start, s.End, s.Cap} {
+		if n != nil {
+			c.integerIndex(n)
+		}
+	}
+	return &operand{mode: value, typ: t}
+}
+
+func (c *checker) integerIndex(n parse.Node) {
+	x := c.node(n)
+	c.singleValue(x)
+	if x.mode == invalid {
+		return
+	}
+	if !isInteger(x.typ) {
+		c.errorf(n, "invalid argument: index %s must be integer", x)
+		return
+	}
+	c.defaultType(x)
+}
+
+// typeAssertion checks x.(T).
+func (c *checker) typeAssertion(x *operand, a *parse.TypeAssertion) *operand {
+	i, ok := underlying(x.typ).(*stable.Interface)
+	if !ok {
+		c.errorf(a, "invalid operation: %s is not an interface", x)
+		return &operand{}
+	}
+	t := typeOf(a.Typ)
+	if t == nil {
+		return &operand{}
+	}
+	if _, ok := underlying(t).(*stable.Interface); !ok && !stable.Implements(t, i) {
+		c.errorf(a, "impossible type assertion: %s.(%s)\n\t%s does not implement %s", exprString(x.node), t, t, x.typ)
+		return &operand{}
+	}
+	return &operand{mode: value, typ: t, commaOK: true}
+}
+
+func (c *checker) call(x *operand, call *parse.Call) *operand {
+	var args []*parse.Expr
+	if call.Args != nil {
+		args = call.Args.Exprs
+	}
+	switch x.mode {
+	case typexpr:
+		return c.conversion(call, x.typ, args)
+	case builtin:
+		whole := &parse.PrimaryE{Expr: x.node, Prime: &parse.PrimaryE{Expr: call}}
+		return c.builtin(x, whole, nil, args, call.Args != nil && call.Args.DotDotDot)
+	}
+	sig, ok := underlying(x.typ).(*stable.Signature)
+	if !ok {
+		for _, a := range args {
+			c.expr(a)
+		}
+		c.errorf(x.node, "invalid operation: cannot call non-function %s", x)
+		return &operand{}
+	}
+	fn := exprString(x.node)
+	dotdotdot := call.Args != nil && call.Args.DotDotDot
+	if dotdotdot && !sig.Variadic {
+		c.errorf(x.node, "have (...) in call to non-variadic %s", fn)
+		return &operand{}
+	}
+	values := c.values(args, len(sig.Params))
+	if len(args) != 0 && len(values) == 0 {
+		return &operand{}
+	}
+	// the parameter types that the arguments line up with
+	params := sig.Params
+	if sig.Variadic && !dotdotdot && len(values) >= len(params)-1 {
+		last := len(params) - 1
+		elem := params[last].(*stable.Slice).Elem
+		params = params[:last:last]
+		for len(params) < len(values) {
+			params = append(params, elem)
+		}
+	}
+	if len(values) != len(params) {
+		msg := "too many arguments"
+		if len(values) < len(params) {
+			msg = "not enough arguments"
+		}
+		var have []stable.Type
+		for _, v := range values {
+			have = append(have, v.typ)
+		}
+		c.errorf(x.node, "%s in call to %s\n\thave %s\n\twant %s", msg, fn, stable.Tuple(have), paramList(sig))
+		return &operand{}
+	}
+	for i, v := range values {
+		c.assignment(v, params[i], "argument to "+fn)
+	}
+	switch len(sig.Results) {
+	case 0:
+		return &operand{mode: novalue}
+	case 1:
+		return &operand{mode: value, typ: sig.Results[0]}
+	}
+	return &operand{mode: value, typ: stable.Tuple(sig.Results)}
+}
+
+// paramList prints the parameters of sig as they're declared, like
+// (int, ...string).
+func paramList(sig *stable.Signature) string {
+	params := &stable.Signature{Params: sig.Params, Variadic: sig.Variadic}
+	return strings.TrimPrefix(params.String(), "func")
+}
+
+// conversion checks T(args).
+func (c *checker) conversion(n parse.Node, t stable.Type, args []*parse.Expr) *operand {
+	if len(args) != 1 {
+		for _, a := range args {
+			c.expr(a)
+		}
+		c.errorf(n, "wrong number of arguments in conversion to %s", t)
+		return &operand{}
+	}
+	x := c.expr(args[0])
+	c.singleValue(x)
+	if x.mode == invalid {
+		return x
+	}
+	if !convertible(x.typ, t) {
+		c.errorf(n, "cannot convert %s to type %s", x, t)
+		return &operand{}
+	}
+	res := &operand{mode: value, typ: t}
+	if x.mode == constexpr && isBasic(t) {
+		res.mode = constexpr
+		if isString(t) && isInteger(x.typ) {
+			res.val = constant.RuneString(x.val)
+		} else if cause := c.representable(x, t); cause != "" {
+			if isInteger(x.typ) && isInteger(t) {
+				c.errorf(n, "constant %s overflows %s", x.val, t)
+			} else {
+				c.errorf(n, "cannot convert %s to type %s (%s)", x, t, cause)
+			}
+			return &operand{}
+		} else {
+			res.val = x.val
+		}
+	}
+	if res.mode != constexpr && !(isInteger(x.typ) && isInteger(t)) {
+		// the backends only convert integers to integers
+		// TODO: convert between integers and floats, integers to
+		// strings, and strings to and from []byte and []rune, once the
+		// IR has values that don't fit in a word
+		c.errorf(n, "converting %s to %s is not supported yet", x.typ, t)
+		return &operand{}
+	}
+	if isUntyped(x.typ) {
+		c.setType(args[0], implicitType(x.typ, t))
+	}
+	return res
+}
+
+// convertible reports whether a value of type from can be converted to
+// type to.
+func convertible(from, to stable.Type) bool {
+	if isUntyped(from) && implicitlyConverts(from, to) {
+		return true
+	}
+	if stable.AssignableTo(from, to) {
+		return true
+	}
+	fu, tu := underlying(from), underlying(to)
+	if fu == nil || tu == nil {
+		return false
+	}
+	if stable.Identical(fu, tu) {
+		return true
+	}
+	// unnamed pointers to identical underlying types
+	if fp, ok := from.(*stable.Pointer); ok {
+		if tp, ok := to.(*stable.Pointer); ok {
+			return stable.Identical(underlying(fp.Elem), underlying(tp.Elem))
+		}
+	}
+	if isNumeric(from) && isNumeric(to) {
+		return true
+	}
+	if isString(to) {
+		// integers convert to the string holding the rune
+		if isInteger(from) {
+			return true
+		}
+		if s, ok := fu.(*stable.Slice); ok {
+			return isByteOrRune(s.Elem)
+		}
+	}
+	if isString(from) {
+		if s, ok := tu.(*stable.Slice); ok {
+			return isByteOrRune(s.Elem)
+		}
+	}
+	return false
+}
+
+func isByteOrRune(t stable.Type) bool {
+	b, ok := underlying(t).(*stable.Basic)
+	return ok && (b.Name == "uint8" || b.Name == "int32")
+}
+
+// singleValue reports an error if x isn't a single value.
+func (c *checker) singleValue(x *operand) {
+	switch x.mode {
+	case novalue:
+		c.errorf(x.node, "%s (no value) used as value", exprString(x.node))
+		x.mode = invalid
+	case typexpr:
+		c.errorf(x.node, "%s (type) is not an expression", exprString(x.node))
+		x.mode = invalid
+	case builtin:
+		c.errorf(x.node, "%s (built-in) must be called", exprString(x.node))
+		x.mode = invalid
+	case invalid:
+	default:
+		if _, ok := x.typ.(stable.Tuple); ok {
+			c.errorf(x.node, "multiple-value %s (value of type %s) in single-value context", exprString(x.node), x.typ)
+			x.mode = invalid
+		}
+	}
+}
+
+// assignment checks that x can be assigned to a variable of type t.
+// context says what sort of assignment it is, for errors.
+func (c *checker) assignment(x *operand, t stable.Type, context string) {
+	c.singleValue(x)
+	if x.mode == invalid {
+		return
+	}
+	if isUntyped(x.typ) && !isNil(x.typ) {
+		if implicitlyConverts(x.typ, t) {
+			if cause := c.representable(x, implicitType(x.typ, t)); cause != "" {
+				c.errorf(x.node, "cannot use %s as %s value in %s (%s)", x, t, context, cause)
+				x.mode = invalid
+				return
+			}
+			it := implicitType(x.typ, t)
+			c.setType(x.node, it)
+			x.typ = it
+			return
+		}
+	} else if stable.AssignableTo(x.typ, t) {
+		return
+	}
+	c.errorf(x.node, "cannot use %s as %s value in %s", x, t, context)
+}
+
+// defaultType gives an untyped x its default type.
+func (c *checker) defaultType(x *operand) {
+	if x.mode == invalid || !isUntyped(x.typ) {
+		return
+	}
+	if isNil(x.typ) {
+		c.errorf(x.node, "use of untyped nil in assignment")
+		x.mode = invalid
+		return
+	}
+	t := stable.Default(x.typ)
+	if cause := c.representable(x, t); cause != "" {
+		c.errorf(x.node, "%s overflows %s", x, t)
+		x.mode = invalid
+		return
+	}
+	c.setType(x.node, t)
+	x.typ = t
+}
+
+// setType records that the untyped expression n ended up with the type
+// t, along with the untyped operands that it was built from. The
+// constants among them have to fit t, and the operands of non-constant
+// shifts have to be integers.
+func (c *checker) setType(n parse.Node, t stable.Type) {
+	old, ok := c.p.types[n]
+	if !ok || !isUntyped(old) {
+		return
+	}
+	c.p.types[n] = t
+	if v, ok := c.p.consts[n]; ok {
+		x := &operand{mode: constexpr, typ: old, val: v, node: n}
+		if cause := c.representable(x, t); cause != "" {
+			c.errorf(n, "%s %s %s", x, cause, t)
+			return
+		}
+	}
+	switch n := n.(type) {
+	case *parse.Expr:
+		c.setType(n.Binary(), t)
+	case *parse.BinaryE:
+		switch n.Op {
+		case "==", "!=", "<", "<=", ">", ">=":
+			// the operands have their own types
+		case "<<", ">>":
+			if _, ok := c.p.consts[n]; !ok && !isInteger(t) {
+				c.errorf(n, "invalid operation: shifted operand %s (type %s) must be integer", exprString(n.X), t)
+				return
+			}
+			c.setType(n.X, t)
+		default:
+			c.setType(n.X, t)
+			c.setType(n.Y, t)
+		}
+	case *parse.UnaryE:
+		c.setType(n.Expr, t)
+	}
+}
+
+// implicitlyConverts reports whether an untyped value of type from can
+// be used where a value of type to is expected.
+func implicitlyConverts(from, to stable.Type) bool {
+	if i, ok := underlying(to).(*stable.Interface); ok {
+		// the value is boxed with its default type
+		return !isNil(from) && len(i.Methods) == 0
+	}
+	b, ok := underlying(to).(*stable.Basic)
+	if !ok {
+		return false
+	}
+	switch from.(*stable.Basic).Name {
+	case "untyped bool":
+		return b.IsBoolean()
+	case "untyped int", "untyped rune", "untyped float":
+		// an untyped float constant can be an integer if its value
+		// is integral; see representable
+		return b.IsNumeric()
+	case "untyped string":
+		return b.IsString()
+	}
+	return false
+}
+
+// implicitType returns the type that an untyped value of type from
+// takes when it's used where a value of type to is expected.
+func implicitType(from, to stable.Type) stable.Type {
+	if _, ok := underlying(to).(*stable.Interface); ok {
+		return stable.Default(from)
+	}
+	return to
+}
+
+// underlying is t.Underlying(), but nil for a nil t.
+func underlying(t stable.Type) stable.Type {
+	if t == nil {
+		return nil
+	}
+	return t.Underlying()
+}
+
+// basic returns the underlying basic type of t, or nil.
+func basic(t stable.Type) *stable.Basic {
+	b, _ := underlying(t).(*stable.Basic)
+	return b
+}
+
+// The predicates below look at the underlying type, and are false for
+// types that aren't basic.
+
+func isBasic(t stable.Type) bool {
+	return basic(t) != nil
+}
+
+func isBoolean(t stable.Type) bool {
+	b := basic(t)
+	return b != nil && b.IsBoolean()
+}
+
+func isInteger(t stable.Type) bool {
+	b := basic(t)
+	return b != nil && b.IsInteger()
+}
+
+func isNumeric(t stable.Type) bool {
+	b := basic(t)
+	return b != nil && b.IsNumeric()
+}
+
+func isString(t stable.Type) bool {
+	b := basic(t)
+	return b != nil && b.IsString()
+}
+
+func isOrdered(t stable.Type) bool {
+	b := basic(t)
+	return b != nil && b.IsOrdered()
+}
+
+func isUntyped(t stable.Type) bool {
+	b, ok := t.(*stable.Basic)
+	return ok && b.IsUntyped()
+}
+
+func isNil(t stable.Type) bool {
+	return stable.Identical(t, stable.UntypedNil)
+}
@@ -0,0 +1,205 @@
+package semantic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/samertm/chompy/lex"
+	"github.com/samertm/chompy/parse"
+)
+
+// checkSrc parses src as the only file of package main and checks it.
+func checkSrc(t *testing.T, src string) (*pkg, error) {
+	_, tokens := lex.Lex("test.go", src)
+	n, err := parse.Start(tokens)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, src)
+	}
+	return check("main", []*parse.Tree{n.(*parse.Tree)}, nil)
+}
+
+func TestCheckGood(t *testing.T) {
+	good := []string{
+		`package main
+
+const big = 1 << 40
+const small = big >> 38
+
+type celsius int16
+
+func f(a int8, b uint) (int8, bool) {
+	return a + 1, b > small
+}
+
+func main() {
+	x, ok := f(3, 4)
+	var c celsius = 100
+	c = c * 2
+	const s = "héllo"
+	for i, r := range s {
+		println(i, r)
+	}
+	println(x, ok, c, int(c)+1, len(s), ^uint8(1))
+}
+`,
+		`package main
+
+var total = count()
+
+func count() int {
+	n := 0
+outer:
+	for i := 0; i < 10; i++ {
+		for j := 0; ; j++ {
+			if j > i {
+				continue outer
+			}
+			if j == 7 {
+				break outer
+			}
+			n += j
+		}
+	}
+	return n
+}
+
+func main() {
+	println(total)
+}
+`,
+		`package main
+
+var x, y = 1, x + 1
+
+const a, b = 1, a + 1
+
+func main() {
+	println(x, y, a, b)
+}
+`,
+		`package main
+
+var s uint = 2
+var x int8 = 3
+var z uint8 = 1 << s
+
+func main() {
+	println(x+1<<s, z, 1<<s == 4)
+}
+`,
+	}
+	for _, src := range good {
+		if _, err := checkSrc(t, src); err != nil {
+			t.Errorf("%s\n%s", err, src)
+		}
+	}
+}
+
+func TestCheckBad(t *testing.T) {
+	bad := []struct {
+		src, err string
+	}{
+		{"var a int8 = 200", "cannot use 200 (untyped int constant) as int8 value in variable declaration (overflows)"},
+		{"var a = 1 + \"a\"", "mismatched types"},
+		{"const a = 1 / 0", "division by zero"},
+		{"var a, b = 1", "assignment mismatch: 2 variables but 1 value"},
+		{"var a int = 1.5", "as int value in variable declaration (truncated)"},
+		{"var a = !1", "operator ! not defined"},
+		{"func f() int {\n\treturn\n}", "not enough return values"},
+		{"func f() int {\n\tfor {\n\t\tbreak\n\t}\n}", "missing return"},
+		{"func f() {\n\tx := 1\n}", "declared and not used: x"},
+		{"func f() {\n\tif 1 {\n\t}\n}", "non-boolean condition in if statement"},
+		{"func f() {\n\tf(1)\n}", "too many arguments in call to f"},
+		{"func f() {\n\tfor i := range 5 {\n\t\tprintln(i)\n\t}\n}", "cannot range over 5"},
+		{"func f(s string) {\n\tfor i := range s {\n\t\tprintln(i)\n\t}\n}", "ranging over s (variable of type string) is not supported yet"},
+		{"var a = a", "initialization cycle"},
+		{"var u, v = v, u", "initialization cycle: u refers to itself"},
+		{"var s uint\nvar f float64 = 1 << s", "invalid operation: shifted operand 1 (type float64) must be integer"},
+		{"var s uint\nvar b int8 = 300 << s", "300 (untyped int constant) overflows int8"},
+		{"func f() {\n\tgoto L\n}", "label L not defined"},
+		{"func f() {\n\tbreak\n}", "break is not in a loop, switch, or select"},
+		{"func f() {\nL:\n\tfor {\n\t}\n\tfor {\n\t\tcontinue L\n\t}\n}", "invalid continue label L"},
+		{"func f(r int) string {\n\treturn string(r)\n}", "converting int to string is not supported yet"},
+		{"type b bool\n\nfunc f(x bool) b {\n\treturn b(x)\n}", "converting bool to b is not supported yet"},
+		{"var x int64", "3:5: variables of type int64 are not supported yet"},
+		{"var f float64", "3:5: variables of type float64 are not supported yet"},
+		{"func f() {\n\ts := \"hi\"\n\tprintln(s)\n}", "4:2: variables of type string are not supported yet"},
+		{"func f() {\n\tp := new(int)\n\tprintln(p)\n}", "4:7: values of type *int are not supported yet"},
+		{"func f() {\n\t_ = make([]int, 3)\n}", "4:6: values of type []int are not supported yet"},
+		{"func f() {\n\tprintln(1.5)\n}", "printing 1.5 (constant of type float64) is not supported yet"},
+		{"func f(m map[string]int) {\n}", "parameters of type map[string]int are not supported yet"},
+		{"func f() []int {\n\treturn nil\n}", "results of type []int are not supported yet"},
+		{"func f() {\n\tdefer f()\n}", "defer statements are not supported yet"},
+	}
+	for _, test := range bad {
+		src := "package main\n\n" + test.src + "\n\nfunc main() {\n}\n"
+		_, err := checkSrc(t, src)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("checking\n%s\ngave %v, want %q", src, err, test.err)
+		}
+	}
+}
+
+func TestCheckPositions(t *testing.T) {
+	_, err := checkSrc(t, "package main\n\nfunc main() {\n\tvar x uint8 = 1\n\tprintln(x + 256)\n}\n")
+	if err == nil || err.Error() != "5:14: 256 (untyped int constant) overflows uint8" {
+		t.Errorf("got %v, want an error at 256", err)
+	}
+}
+
+// TestCheckShiftTypes checks that non-constant shifts of untyped
+// constants get their types from where they're used.
+func TestCheckShiftTypes(t *testing.T) {
+	p, err := checkSrc(t, "package main\n\nfunc main() {\n\tvar s uint\n\tvar x int8\n\tvar z uint8 = 1 << s\n\tprintln(x + 1<<s, z)\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the binary expressions hang off the Exprs, not the tree
+	var shifts []string
+	var visit func(n parse.Node) bool
+	var binary func(n parse.Node)
+	binary = func(n parse.Node) {
+		b, ok := n.(*parse.BinaryE)
+		if !ok {
+			parse.Inspect(n, visit)
+			return
+		}
+		binary(b.X)
+		binary(b.Y)
+		if b.Op == "<<" {
+			shifts = append(shifts, p.types[b].String()+" "+p.types[b.X].String())
+		}
+	}
+	visit = func(n parse.Node) bool {
+		if e, ok := n.(*parse.Expr); ok {
+			binary(e.Binary())
+			return false
+		}
+		return true
+	}
+	parse.Inspect(p.files[0], visit)
+	want := []string{"uint8 uint8", "int8 int8"}
+	if len(shifts) != len(want) || shifts[0] != want[0] || shifts[1] != want[1] {
+		t.Errorf("the shifts and their operands have types %v, want %v", shifts, want)
+	}
+}
+
+func TestCheckTypes(t *testing.T) {
+	p, err := checkSrc(t, "package main\n\nfunc main() {\n\tvar a int8 = 1\n\tb := a + 2\n\tprintln(b)\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	parse.Inspect(p.files[0], func(n parse.Node) bool {
+		if s, ok := n.(*parse.ShortVarDecl); ok {
+			found = true
+			if typ := p.types[s.Exprs[0]]; typ == nil || typ.String() != "int8" {
+				t.Errorf("a + 2 has type %v, want int8", typ)
+			}
+		}
+		return true
+	})
+	if !found {
+		t.Error("no short variable declaration")
+	}
+}
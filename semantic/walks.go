@@ -1,16 +1,28 @@
 package semantic
 
-import "github.com/samertm/chompy/parse"
+import (
+	"strconv"
 
-func treeWalks(t *parse.Tree) sErrors {
-	walks := []func(*parse.Tree) sErrors {
-		checkPackage,
-		checkImports,
+	"github.com/samertm/chompy/parse"
+	"github.com/samertm/chompy/semantic/stable"
+)
+
+func treeWalks(p *pkg) sErrors {
+	walks := []func(*pkg) sErrors{
+		eachFile(checkPackage),
+		eachFile(checkImports),
+		checkPackageNames,
+		resolveIdents,
+		typeCheck,
+		initOrder,
+		eachFile(checkUnused),
+		checkReturns,
+		checkLabels,
 		checkMain,
-		// rewriteShorVar,
+		checkSupported,
 	}
 	for _, fn := range walks {
-		s := fn(t)
+		s := fn(p)
 		if len(s) != 0 {
 			return s
 		}
@@ -18,24 +30,17 @@ func treeWalks(t *parse.Tree) sErrors {
 	return nil
 }
 
-// // TODO finish this function
-// func rewriteShorVar(t *parse.Tree) sErrors {
-// 	var rewriteBlocks func(*parse.Block)
-// 	rewriteBlocks = func(b *parse.Block) {
-// 		for _, s := range b.Stmts {
-// 			// TODO fill this out
-// 		}
-// 	}
-// 	for _, k := range t.Kids {
-// 		var fn *parse.Funcdecl
-// 		var ok bool
-// 		if fn, ok := k.(*parse.Funcdecl); !ok {
-// 			continue
-// 		}
-// 		rewriteBlocks(fn.Func.Body)
-// 	}
-// 	return nil
-// }
+// eachFile turns a walk over a single file into a walk over every file
+// in the package.
+func eachFile(fn func(*parse.Tree) sErrors) func(*pkg) sErrors {
+	return func(p *pkg) sErrors {
+		var errs sErrors
+		for _, t := range p.files {
+			errs = append(errs, fn(t)...)
+		}
+		return errs
+	}
+}
 
 func checkPackage(t *parse.Tree) sErrors {
 	if len(t.Kids) == 0 {
@@ -66,17 +71,108 @@ func checkImports(t *parse.Tree) sErrors {
 	return nil
 }
 
-func checkMain(t *parse.Tree) sErrors {
-	for _, kid := range t.Kids {
-		switch f := kid.(type) {
-		case *parse.Funcdecl:
-			if f.Name.Name == "main" {
-				if f.Func.Sig.Params == nil &&
-					f.Func.Sig.Result == nil {
-					return nil
+// checkPackageNames makes sure that every file is in the same package,
+// and records the package's name.
+func checkPackageNames(p *pkg) sErrors {
+	for _, t := range p.files {
+		if len(t.Kids) == 0 {
+			continue
+		}
+		name := t.Kids[0].(*parse.Pkg).Name
+		if p.name == "" {
+			p.name = name
+		} else if name != p.name {
+			return sErrors{"found packages " + p.name + " and " + name + " in " + p.path}
+		}
+	}
+	return nil
+}
+
+func checkMain(p *pkg) sErrors {
+	if p.name != "main" {
+		return nil
+	}
+	for _, t := range p.files {
+		for _, kid := range t.Kids {
+			switch f := kid.(type) {
+			case *parse.Funcdecl:
+				if f.Name.Name == "main" {
+					if f.Func.Sig.Params == nil &&
+						f.Func.Sig.Result == nil {
+						return nil
+					}
 				}
 			}
 		}
 	}
 	return sErrors{"Did not find main"}
 }
+
+// checkUnused reports the imports, and the variables declared in
+// function bodies, that are never used. The resolver records uses in
+// NodeInfo.Used.
+func checkUnused(t *parse.Tree) sErrors {
+	var errs sErrors
+	for _, kid := range t.Kids {
+		impts, ok := kid.(*parse.Impts)
+		if !ok {
+			continue
+		}
+		for _, i := range impts.Imports {
+			if i.Info == nil || i.Info.Used {
+				continue
+			}
+			path := strconv.Quote(i.ImptName)
+			if i.PkgName == "" || i.PkgName == "." || i.PkgName == i.Info.Pkg.Name {
+				errs = append(errs, errorAt(t.Name, i, "%s imported and not used", path))
+			} else {
+				errs = append(errs, errorAt(t.Name, i, "%s imported as %s and not used", path, i.PkgName))
+			}
+		}
+	}
+	// A short variable declaration can redeclare a variable, so
+	// only the first ident bound to a variable declares it.
+	seen := make(map[*stable.NodeInfo]bool)
+	unused := func(ids []*parse.Ident) {
+		for _, id := range ids {
+			ni := id.Info
+			if ni == nil || id.Name == "_" || seen[ni] {
+				continue
+			}
+			seen[ni] = true
+			if !ni.Used {
+				errs = append(errs, errorAt(t.Name, id, "declared and not used: %s", id.Name))
+			}
+		}
+	}
+	for _, kid := range t.Kids {
+		f, ok := kid.(*parse.Funcdecl)
+		if !ok || f.Func == nil || f.Func.Body == nil {
+			continue
+		}
+		// parameters and results don't have to be used
+		if sig := f.Func.Sig; sig != nil {
+			params := sig.Params
+			if sig.Result != nil {
+				params = append(params[:len(params):len(params)], sig.Result.Params...)
+			}
+			for _, p := range params {
+				for _, id := range p.Idents {
+					seen[id.Info] = true
+				}
+			}
+		}
+		parse.Inspect(f.Func.Body, func(n parse.Node) bool {
+			switch n := n.(type) {
+			case *parse.Varspec:
+				unused(n.Idents)
+			case *parse.ShortVarDecl:
+				unused(n.Idents)
+			case *parse.RangeClause:
+				unused(n.Idents)
+			}
+			return true
+		})
+	}
+	return errs
+}
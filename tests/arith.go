@@ -0,0 +1,51 @@
+//go:build ignore
+
+package main
+
+type celsius int16
+
+func f(a, b int) bool {
+	return a < b && b != 3 || !b2(a)
+}
+
+func b2(a int) bool {
+	return a >= 0
+}
+
+func main() {
+	var x int
+	x = 7
+	y := x*3 - 4/x%2 + x<<2>>1
+	var u uint8
+	u = 200
+	u += 100
+	u = u / 3
+	z := -x ^ 5&^2
+	println(x, y, z, u, f(1, 2), x < y && y <= 30, ^x)
+
+	var m int32 = 2147483647
+	m = m + 1
+	var i8 int8 = 127
+	i8++
+	var one uint8 = 1
+	one = -one
+	n := 123456789
+	n = n * 100
+	println(m, i8, one, n)
+
+	var big uint32 = 4000000000
+	println(big, big+1, big/3)
+
+	c := 300
+	var b uint8
+	b = uint8(c)
+	t := celsius(c) + 1
+	println(b, t, int8(b), uint16(b))
+
+	// the shifts of untyped constants take their types from the context
+	var s uint = 2
+	var w uint8 = 255
+	w = w + 1<<s
+	var v uint8 = 1 << s
+	println(i8+1<<s, w, v, 1<<s == 4, -1<<s)
+}
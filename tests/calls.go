@@ -0,0 +1,36 @@
+//go:build ignore
+
+package main
+
+var x, y = pair(1)
+
+func pair(a int) (int, int) {
+	return a, a + 1
+}
+
+func named(a int) (s, t int) {
+	s = a
+	return
+}
+
+func fact(n int) int {
+	if n < 5 {
+		return fact(n+1) + n
+	}
+	return 0
+}
+
+func six(a, b, c, d, e, f int) int {
+	return a + f
+}
+
+func sum(a, b int) int {
+	return a + b
+}
+
+func main() {
+	p, q := pair(3)
+	_, r := named(4)
+	println(p, q, r, fact(5), six(1, 2, 3, 4, 5, 6), sum(pair(7)))
+	pair(0)
+}
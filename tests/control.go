@@ -0,0 +1,52 @@
+//go:build ignore
+
+package main
+
+func ok() bool {
+	return true
+}
+
+func main() {
+	var x int
+L:
+	for x < 10 {
+		y := x
+		if y == 3 {
+			x = x + 2
+			continue L
+		}
+		if y == 7 {
+			break
+		}
+		x = x + 1
+	}
+	println(x)
+	for i := 0; i < 3; i++ {
+		for j := 0; ; j++ {
+			if j > i {
+				break
+			}
+			print(i, j, " ")
+		}
+	}
+	println()
+	a, b := 1, 2
+	if x := a + b; x == 4 {
+		println(x)
+	} else if y := x * 2; y > 4 && ok() {
+		println(y, x)
+		goto done
+	} else {
+		println("no")
+	}
+	println("skipped")
+done:
+	k := 4
+	if k > 3 {
+		println("folded")
+	} else {
+		z := k - 4
+		println(k / z)
+	}
+	println("end")
+}
@@ -0,0 +1,32 @@
+//go:build ignore
+
+package main
+
+var a = b + 1
+var b = c + 2
+var c = 3
+var n int
+var _ = 4
+var x, y = 1, x + 1
+var p, q = q + 1, f()
+
+const k, m = 1, k + 1
+
+func f() int {
+	return 7
+}
+
+func init() {
+	n = a
+}
+
+func init() {
+	n += 1
+}
+
+func main() {
+	a := 7
+	println(a, b, n)
+	println(x, y, p, q, k, m)
+	c = 5
+}
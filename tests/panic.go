@@ -0,0 +1,29 @@
+//go:build ignore
+
+package main
+
+var g = 10
+
+func div(a, b int) int {
+	return a / b
+}
+
+func main() {
+	var u uint8 = 250
+	u += 10
+	var i8 int8 = 127
+	i8++
+	println(u, i8, g)
+	for i, r := range "héllo, 世界" {
+		print(i, r, " ")
+	}
+	println()
+	b := u == 4
+	x := 1
+	x = x << 20
+	println(x, x>>40, -7/2, -7%2)
+	if g > 5 && !b {
+		println("and")
+	}
+	println(div(g, 0))
+}
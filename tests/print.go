@@ -0,0 +1,18 @@
+//go:build ignore
+
+package main
+
+const greeting = "hello, \"world\""
+
+func main() {
+	x := 42
+	x -= 50
+	b := true
+	println(greeting, x, len(greeting), b, 'a')
+	print("no newline")
+	println()
+	if x == 0 {
+		panic("boom")
+	}
+	return
+}
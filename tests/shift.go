@@ -0,0 +1,16 @@
+//go:build ignore
+
+package main
+
+func shl(x int, n int8) int {
+	return x << n
+}
+
+func main() {
+	var n int = 3
+	var u uint8 = 200
+	println(1<<n, -64>>n, u>>n, shl(5, 2), shl(1, 40))
+	n = n - 4
+	println(shl(1, 0))
+	println(7 >> n)
+}
@@ -0,0 +1,38 @@
+//go:build ignore
+
+package main
+
+func swap(a, b int) (int, int) {
+	for i := 0; i < 3; i++ {
+		a, b = b, a
+	}
+	return a, b
+}
+
+func fib(n int) int {
+	a := 0
+	b := 1
+	for n > 0 {
+		t := a + b
+		a = b
+		b = t
+		n--
+	}
+	return a
+}
+
+func pick(x int) (r int) {
+	if x > 5 {
+		r = 1
+	} else if x > 2 {
+		r = 2
+	}
+	return
+}
+
+func main() {
+	x, y := swap(1, 2)
+	println(x, y)
+	println(fib(10))
+	println(pick(7), pick(3), pick(0))
+}